@@ -0,0 +1,128 @@
+//go:build go1.21
+// +build go1.21
+
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const redacted = "[REDACTED]"
+
+// AccessLogOptions options of AccessLog
+type AccessLogOptions struct {
+	// Logger default is slog.Default()
+	Logger *slog.Logger
+	// SampleRate the fraction of successful requests logged, the requests
+	// responded with status code >= 400 are always logged, 0 logs all
+	SampleRate float64
+	// Headers the request headers logged
+	Headers []string
+	// Redact the case-insensitive names of query parameters and headers
+	// whose values are replaced by `[REDACTED]`
+	Redact []string
+	// Route returns the route template of request, default is the pattern
+	// of http.ServeMux
+	Route func(r *http.Request) string
+}
+
+// AccessLog returns a middleware logs each request by log/slog, the status
+// >= 500 is logged at error level and >= 400 at warn level
+func AccessLog(opts AccessLogOptions) Middleware {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	if opts.Route == nil {
+		opts.Route = routePattern
+	}
+	redact := make(map[string]bool, len(opts.Redact))
+	for _, name := range opts.Redact {
+		redact[strings.ToLower(name)] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			next.ServeHTTP(w, r)
+			info, _ := RequestInfoFromContext(r.Context())
+			if info.Status < 400 && opts.SampleRate > 0 && rand.Float64() >= opts.SampleRate {
+				return
+			}
+			level := slog.LevelInfo
+			switch {
+			case info.Status >= 500:
+				level = slog.LevelError
+			case info.Status >= 400:
+				level = slog.LevelWarn
+			}
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+			}
+			if query := redactQuery(r, redact); query != "" {
+				attrs = append(attrs, slog.String("query", query))
+			}
+			if route := opts.Route(r); route != "" {
+				attrs = append(attrs, slog.String("route", route))
+			}
+			attrs = append(attrs,
+				slog.Int("status", info.Status),
+				slog.Int("bytes", info.Bytes),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("handler", info.Handler),
+			)
+			if info.RequestID != "" {
+				attrs = append(attrs, slog.String("request_id", info.RequestID))
+			}
+			if len(opts.Headers) > 0 {
+				headers := make([]any, 0, len(opts.Headers))
+				for _, name := range opts.Headers {
+					value := r.Header.Get(name)
+					if value == "" {
+						continue
+					}
+					if redact[strings.ToLower(name)] {
+						value = redacted
+					}
+					headers = append(headers, slog.String(name, value))
+				}
+				attrs = append(attrs, slog.Group("headers", headers...))
+			}
+			if info.Err != nil {
+				attrs = append(attrs, slog.String("error", info.Err.Error()))
+			}
+			opts.Logger.LogAttrs(r.Context(), level, "request", attrs...)
+		})
+	}
+}
+
+func redactQuery(r *http.Request, redact map[string]bool) string {
+	if r.URL.RawQuery == "" || len(redact) == 0 {
+		return r.URL.RawQuery
+	}
+	query := r.URL.Query()
+	for key, values := range query {
+		if redact[strings.ToLower(key)] {
+			for i := range values {
+				values[i] = redacted
+			}
+		}
+	}
+	return query.Encode()
+}
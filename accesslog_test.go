@@ -0,0 +1,84 @@
+//go:build go1.21
+// +build go1.21
+
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/pingcap/check"
+)
+
+type accessLogSuite struct{}
+
+var _ = Suite(&accessLogSuite{})
+
+func (s *accessLogSuite) TestAccessLog(c *C) {
+	buf := &bytes.Buffer{}
+	group := New()
+	group.Use(AccessLog(AccessLogOptions{
+		Logger:  slog.New(slog.NewJSONHandler(buf, nil)),
+		Headers: []string{"Authorization", "User-Agent"},
+		Redact:  []string{"authorization", "token"},
+		Route:   func(*http.Request) string { return "/users/{id}" },
+	}))
+	group.Plugin(RequestIDPlugin(RequestIDOptions{Generate: func() string { return "rid" }}))
+	handler := group.Wrap(func() (string, error) { return "ok", nil })
+
+	request, _ := http.NewRequest(http.MethodGet, "/users/1?token=secret&page=1", nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	request.Header.Set("User-Agent", "test")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	var entry map[string]interface{}
+	c.Assert(json.Unmarshal(buf.Bytes(), &entry), IsNil)
+	c.Assert(entry["level"], Equals, "INFO")
+	c.Assert(entry["method"], Equals, "GET")
+	c.Assert(entry["path"], Equals, "/users/1")
+	c.Assert(entry["query"], Equals, "page=1&token=%5BREDACTED%5D")
+	c.Assert(entry["route"], Equals, "/users/{id}")
+	c.Assert(entry["status"], Equals, float64(200))
+	c.Assert(entry["bytes"], Equals, float64(5))
+	c.Assert(entry["request_id"], Equals, "rid")
+	c.Assert(entry["headers"], DeepEquals, map[string]interface{}{"Authorization": "[REDACTED]", "User-Agent": "test"})
+	c.Assert(entry["handler"], Matches, "github.com/pingcap/fn.*")
+	c.Assert(entry["duration"], NotNil)
+}
+
+func (s *accessLogSuite) TestSampling(c *C) {
+	buf := &bytes.Buffer{}
+	group := New()
+	group.Use(AccessLog(AccessLogOptions{
+		Logger:     slog.New(slog.NewJSONHandler(buf, nil)),
+		SampleRate: 1e-9,
+	}))
+	ok := group.Wrap(func() (string, error) { return "ok", nil })
+	fail := group.Wrap(func() (string, error) { return "", errTest })
+
+	request, _ := http.NewRequest(http.MethodGet, "/", nil)
+	ok.ServeHTTP(httptest.NewRecorder(), request)
+	c.Assert(buf.Len(), Equals, 0)
+
+	fail.ServeHTTP(httptest.NewRecorder(), request)
+	var entry map[string]interface{}
+	c.Assert(json.Unmarshal(buf.Bytes(), &entry), IsNil)
+	c.Assert(entry["level"], Equals, "WARN")
+	c.Assert(entry["error"], Equals, "test")
+}
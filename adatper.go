@@ -16,6 +16,7 @@ package fn
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"reflect"
 )
@@ -23,10 +24,15 @@ import (
 // adapter represents a container that contain a handler function
 // and convert a it to a http.Handler
 type adapter interface {
-	invoke(context.Context, http.ResponseWriter, *http.Request) (interface{}, error)
+	// bind binds the arguments of handler from the request, the returned call
+	// runs the handler with them
+	bind(context.Context, *http.Request) (handlerCall, error)
 	clone(c *Container) adapter
 }
 
+// handlerCall runs the bound handler with the context
+type handlerCall func(ctx context.Context) (interface{}, error)
+
 // genericAdapter represents a common adapter
 type genericAdapter struct {
 	container *Container
@@ -34,11 +40,11 @@ type genericAdapter struct {
 	method    reflect.Value
 	numIn     int
 	types     []reflect.Type
-	cacheArgs []reflect.Value // cache args
 }
 
 // Accept zero parameter adapter
 type simplePlainAdapter struct {
+	container *Container
 	inContext bool
 	method    reflect.Value
 	cacheArgs []reflect.Value
@@ -47,9 +53,59 @@ type simplePlainAdapter struct {
 // Accept only one parameter adapter
 type simpleUnaryAdapter struct {
 	//outContext bool
+	container *Container
 	argType   reflect.Type
 	method    reflect.Value
-	cacheArgs []reflect.Value // cache args
+}
+
+// decodeRequest decode request to the customized type, multipart requests are
+// bound by the `file` and `form` tags, urlencoded requests and the query of
+// request without body are bound by the `form` tags if the type has any,
+// others are decoded as json, the `cookie` tags are bound at last, the request
+// bound by Invoke or RPC is not decoded
+func (c *Container) decodeRequest(ctx context.Context, r *http.Request, typ reflect.Type) (reflect.Value, error) {
+	if state := requestStateFromContext(ctx); state != nil && state.bind != nil {
+		return state.bind(typ)
+	}
+	value := reflect.New(typ.Elem())
+	if err := c.decodeBody(r, value); err != nil {
+		return value, err
+	}
+	return value, bindCookies(r, value)
+}
+
+func (c *Container) decodeBody(r *http.Request, value reflect.Value) error {
+	switch {
+	case isMultipartRequest(r):
+		return c.bindMultipart(r, value)
+	case isURLEncodedRequest(r) && hasFormTags(value.Type().Elem()):
+		if err := c.parseForm(r); err != nil {
+			return err
+		}
+		return decodeForm(r.PostForm, value, c.maxFormSliceLen)
+	case isBodyless(r) && hasFormTags(value.Type().Elem()):
+		return decodeForm(r.URL.Query(), value, c.maxFormSliceLen)
+	}
+	if r.Body == nil {
+		return nil
+	}
+	err := json.NewDecoder(r.Body).Decode(value.Interface())
+	if err == io.EOF && r.ContentLength == 0 {
+		// empty body, the request may be bound by tags only
+		return nil
+	}
+	return err
+}
+
+// isBodyless reports whether the request has no body, such as GET requests
+func isBodyless(r *http.Request) bool {
+	return (r.Body == nil || r.Body == http.NoBody) && r.ContentLength <= 0 && r.Header.Get("Content-Type") == ""
+}
+
+// checkRequestType validate the tags of customized type at wrap time
+func checkRequestType(typ reflect.Type) {
+	structFileFields(typ.Elem())
+	structCookieFields(typ.Elem())
 }
 
 func makeGenericAdapter(c *Container, method reflect.Value, inContext bool) *genericAdapter {
@@ -63,7 +119,6 @@ func makeGenericAdapter(c *Container, method reflect.Value, inContext bool) *gen
 		method:    method,
 		numIn:     numIn,
 		types:     make([]reflect.Type, numIn),
-		cacheArgs: make([]reflect.Value, numIn),
 	}
 
 	for i := 0; i < numIn; i++ {
@@ -76,6 +131,7 @@ func makeGenericAdapter(c *Container, method reflect.Value, inContext bool) *gen
 			if in.Kind() != reflect.Ptr {
 				panic("customize type should be a pointer(" + in.PkgPath() + "." + in.Name() + ")")
 			}
+			checkRequestType(in)
 			noSupportExists = true
 		}
 		a.types[i] = in
@@ -87,7 +143,7 @@ func makeGenericAdapter(c *Container, method reflect.Value, inContext bool) *gen
 // invokeParams params handler
 func (a *genericAdapter) invokeParams(ctx context.Context, r *http.Request) ([]reflect.Value, error) {
 	var (
-		values = a.cacheArgs
+		values = make([]reflect.Value, a.numIn)
 		value  reflect.Value
 		err    error
 	)
@@ -96,17 +152,13 @@ func (a *genericAdapter) invokeParams(ctx context.Context, r *http.Request) ([]r
 		v, ok := a.container.builtinType(typ)
 		if ok {
 			// support type param
-			value, err = v(ctx, r)
+			value, err = v(ctx, a.container, r)
 		} else if typ == contextType {
 			// context type param
 			value = reflect.ValueOf(ctx)
 		} else {
 			// *struct
-			d := reflect.New(typ.Elem()).Interface()
-			err = json.NewDecoder(r.Body).Decode(d)
-			if err == nil {
-				value = reflect.ValueOf(d)
-			}
+			value, err = a.container.decodeRequest(ctx, r, typ)
 		}
 		if err != nil {
 			return nil, err
@@ -123,63 +175,92 @@ func (a *genericAdapter) clone(container *Container) adapter {
 		method:    a.method,
 		numIn:     a.numIn,
 		types:     a.types[:],
-		cacheArgs: a.cacheArgs[:],
 	}
 }
 
-func (a *genericAdapter) invoke(ctx context.Context, _ http.ResponseWriter, r *http.Request) (interface{}, error) {
-	values, err := a.invokeParams(ctx, r)
-
-	results := a.method.Call(values)
-	payload := results[0].Interface()
-	if e := results[1].Interface(); e != nil {
-		err = e.(error)
+func (a *genericAdapter) bind(ctx context.Context, r *http.Request) (handlerCall, error) {
+	bindCtx, span := a.container.startSpan(ctx, SpanBind)
+	values, err := a.invokeParams(bindCtx, r)
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
 	}
-	return payload, err
+
+	return func(ctx context.Context) (interface{}, error) {
+		ctx, span := a.container.startSpan(ctx, SpanHandler)
+		for i, typ := range a.types {
+			if typ == contextType {
+				// the handler runs in the handler span
+				values[i] = reflect.ValueOf(ctx)
+			}
+		}
+		var err error
+		results := a.method.Call(values)
+		payload := results[0].Interface()
+		if e := results[1].Interface(); e != nil {
+			err = e.(error)
+		}
+		endSpan(span, err)
+		return payload, err
+	}, nil
+}
+
+func (a *simplePlainAdapter) bind(context.Context, *http.Request) (handlerCall, error) {
+	return a.call, nil
 }
 
-func (a *simplePlainAdapter) invoke(ctx context.Context, _ http.ResponseWriter, _ *http.Request) (interface{}, error) {
+func (a *simplePlainAdapter) call(ctx context.Context) (interface{}, error) {
+	ctx, span := a.container.startSpan(ctx, SpanHandler)
+	args := a.cacheArgs
 	if a.inContext {
-		a.cacheArgs[0] = reflect.ValueOf(ctx)
+		// the cached args are shared by concurrent requests
+		args = []reflect.Value{reflect.ValueOf(ctx)}
 	}
 
 	var err error
-	results := a.method.Call(a.cacheArgs)
+	results := a.method.Call(args)
 	payload := results[0].Interface()
 	if e := results[1].Interface(); e != nil {
 		err = e.(error)
 	}
+	endSpan(span, err)
 	return payload, err
 }
 
-func (a *simplePlainAdapter) clone(_ *Container) adapter {
+func (a *simplePlainAdapter) clone(container *Container) adapter {
 	return &simplePlainAdapter{
+		container: container,
 		inContext: a.inContext,
 		method:    a.method,
 		cacheArgs: a.cacheArgs[:],
 	}
 }
 
-func (a *simpleUnaryAdapter) invoke(_ context.Context, _ http.ResponseWriter, r *http.Request) (interface{}, error) {
-	data := reflect.New(a.argType.Elem()).Interface()
-	err := json.NewDecoder(r.Body).Decode(data)
+func (a *simpleUnaryAdapter) bind(ctx context.Context, r *http.Request) (handlerCall, error) {
+	_, span := a.container.startSpan(ctx, SpanBind)
+	data, err := a.container.decodeRequest(ctx, r, a.argType)
+	endSpan(span, err)
 	if err != nil {
 		return nil, err
 	}
 
-	a.cacheArgs[0] = reflect.ValueOf(data)
-	results := a.method.Call(a.cacheArgs)
-	payload := results[0].Interface()
-	if e := results[1].Interface(); e != nil {
-		err = e.(error)
-	}
-	return payload, err
+	return func(ctx context.Context) (interface{}, error) {
+		_, span := a.container.startSpan(ctx, SpanHandler)
+		var err error
+		results := a.method.Call([]reflect.Value{data})
+		payload := results[0].Interface()
+		if e := results[1].Interface(); e != nil {
+			err = e.(error)
+		}
+		endSpan(span, err)
+		return payload, err
+	}, nil
 }
 
-func (a *simpleUnaryAdapter) clone(_ *Container) adapter {
+func (a *simpleUnaryAdapter) clone(container *Container) adapter {
 	return &simpleUnaryAdapter{
+		container: container,
 		argType:   a.argType,
 		method:    a.method,
-		cacheArgs: a.cacheArgs[:],
 	}
 }
@@ -0,0 +1,277 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+var (
+	principalType    = reflect.TypeOf(Principal{})
+	principalPtrType = reflect.TypeOf((*Principal)(nil))
+
+	// ErrNoCredentials returned by Authenticator if the request carries no
+	// credentials of its scheme, the next authenticator will be tried
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrUnauthenticated returned if no authenticator accepts the request
+	ErrUnauthenticated = errors.New("unauthenticated")
+	// ErrInvalidCredentials returned if the credentials are rejected
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Principal represents the authenticated subject of request
+type Principal struct {
+	// Subject the user name, the key owner or the `sub` claim of JWT
+	Subject string
+	// Scheme the authentication scheme, e.g: Bearer, Basic, APIKey
+	Scheme string
+	Scopes []string
+	Roles  []string
+	// Claims the claims of JWT or any attributes set by the verify function
+	Claims map[string]interface{}
+}
+
+// copy returns a shallow copy of principal for setting the fields
+func (p *Principal) copy() *Principal {
+	cp := *p
+	return &cp
+}
+
+// HasScope reports whether the principal was granted scope
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRole reports whether the principal has role
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator authenticate the request and returns the principal
+type Authenticator interface {
+	// Authenticate returns ErrNoCredentials if the request carries no
+	// credentials of the scheme
+	Authenticate(ctx context.Context, r *http.Request) (*Principal, error)
+	// Challenge returns the `WWW-Authenticate` value of the scheme
+	Challenge() string
+}
+
+// ChallengeError represents an error with `WWW-Authenticate` challenges
+type ChallengeError interface {
+	Challenges() []string
+}
+
+type authError struct {
+	err        error
+	challenges []string
+}
+
+func (a *authError) Error() string {
+	return a.err.Error()
+}
+
+func (a *authError) Unwrap() error {
+	return a.err
+}
+
+func (a *authError) StatusCode() int {
+	return http.StatusUnauthorized
+}
+
+func (a *authError) Challenges() []string {
+	return a.challenges
+}
+
+// UnauthorizedError wrap error as 401 response with the challenges
+func UnauthorizedError(err error, challenges ...string) error {
+	return &authError{err: err, challenges: challenges}
+}
+
+// UnwrapErrorChallenges unwrap error challenges
+func UnwrapErrorChallenges(err error) ([]string, bool) {
+	for err != nil {
+		if v, ok := err.(ChallengeError); ok {
+			return v.Challenges(), true
+		}
+		err = Unwrap(err)
+	}
+	return nil, false
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carries the principal
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal authenticated by Authenticate
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// Authenticate returns a plugin authenticate the request by authenticators in
+// order, the first accepted principal is stored in the context and injected
+// as the Principal parameter, 401 is responded if no authenticator accepts
+func Authenticate(authenticators ...Authenticator) PluginFunc {
+	if len(authenticators) == 0 {
+		panic("authenticate requires at least one authenticator")
+	}
+	challenges := make([]string, len(authenticators))
+	for i, a := range authenticators {
+		challenges[i] = a.Challenge()
+	}
+	return func(ctx context.Context, r *http.Request) (context.Context, error) {
+		for _, a := range authenticators {
+			p, err := a.Authenticate(ctx, r)
+			if err == ErrNoCredentials {
+				continue
+			}
+			if err != nil {
+				if _, ok := UnwrapErrorStatusCode(err); ok {
+					return ctx, err
+				}
+				return ctx, UnauthorizedError(err, a.Challenge())
+			}
+			return WithPrincipal(ctx, p), nil
+		}
+		return ctx, UnauthorizedError(ErrUnauthenticated, challenges...)
+	}
+}
+
+func principalValuer(ctx context.Context, _ *http.Request) (Principal, error) {
+	p, ok := PrincipalFromContext(ctx)
+	if !ok {
+		return Principal{}, UnauthorizedError(ErrUnauthenticated)
+	}
+	return *p, nil
+}
+
+func principalPtrValuer(ctx context.Context, _ *http.Request) (*Principal, error) {
+	p, ok := PrincipalFromContext(ctx)
+	if !ok {
+		return nil, UnauthorizedError(ErrUnauthenticated)
+	}
+	return p, nil
+}
+
+type basicAuthenticator struct {
+	realm  string
+	verify func(ctx context.Context, username, password string) (*Principal, error)
+}
+
+// BasicAuth returns an authenticator of HTTP Basic scheme, verify returns
+// the principal of the user or an error if the password is wrong
+func BasicAuth(realm string, verify func(ctx context.Context, username, password string) (*Principal, error)) Authenticator {
+	return &basicAuthenticator{realm: realm, verify: verify}
+}
+
+func (b *basicAuthenticator) Authenticate(ctx context.Context, r *http.Request) (*Principal, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	p, err := b.verify(ctx, username, password)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, ErrInvalidCredentials
+	}
+	// the verify function may return a shared principal
+	p = p.copy()
+	if p.Subject == "" {
+		p.Subject = username
+	}
+	p.Scheme = "Basic"
+	return p, nil
+}
+
+func (b *basicAuthenticator) Challenge() string {
+	return `Basic realm="` + b.realm + `", charset="UTF-8"`
+}
+
+// BasicAuthUsers returns the verify function of BasicAuth checks the static
+// username and password pairs
+func BasicAuthUsers(users map[string]string) func(ctx context.Context, username, password string) (*Principal, error) {
+	return func(_ context.Context, username, password string) (*Principal, error) {
+		expected, ok := users[username]
+		if !ok || subtle.ConstantTimeCompare([]byte(expected), []byte(password)) != 1 {
+			return nil, ErrInvalidCredentials
+		}
+		return &Principal{Subject: username}, nil
+	}
+}
+
+type apiKeyAuthenticator struct {
+	header string
+	query  string
+	verify func(ctx context.Context, key string) (*Principal, error)
+}
+
+// APIKeyAuth returns an authenticator reads the key from header or query
+// parameter, either of which can be empty
+func APIKeyAuth(header, query string, verify func(ctx context.Context, key string) (*Principal, error)) Authenticator {
+	if header == "" && query == "" {
+		panic("api key requires a header or a query parameter")
+	}
+	return &apiKeyAuthenticator{header: header, query: query, verify: verify}
+}
+
+func (a *apiKeyAuthenticator) Authenticate(ctx context.Context, r *http.Request) (*Principal, error) {
+	var key string
+	if a.header != "" {
+		key = r.Header.Get(a.header)
+	}
+	if key == "" && a.query != "" {
+		key = r.URL.Query().Get(a.query)
+	}
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	p, err := a.verify(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, ErrInvalidCredentials
+	}
+	p = p.copy()
+	p.Scheme = "APIKey"
+	return p, nil
+}
+
+func (a *apiKeyAuthenticator) Challenge() string {
+	name := a.header
+	if name == "" {
+		name = a.query
+	}
+	return `APIKey realm="` + strings.ToLower(name) + `"`
+}
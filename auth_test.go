@@ -0,0 +1,236 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+type authSuite struct{}
+
+var _ = Suite(&authSuite{})
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signTestToken(c *C, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	c.Assert(err, IsNil)
+	payload, err := json.Marshal(claims)
+	c.Assert(err, IsNil)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		c.Assert(err, IsNil)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		c.Assert(err, IsNil)
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signed + "." + b64(sig)
+}
+
+func serveWithAuth(handler http.Handler, setup func(r *http.Request)) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(http.MethodGet, "/?api_key=k2", nil)
+	setup(request)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func newAuthHandler(authenticators ...Authenticator) http.Handler {
+	group := New()
+	group.RequestPlugin(principalPtrValuer)
+	group.Plugin(Authenticate(authenticators...))
+	group.SetErrorEncoder(defaultErrorEncoder)
+	return group.Wrap(func(p *Principal) (*Principal, error) {
+		return p, nil
+	})
+}
+
+func (s *authSuite) TestBasicAndAPIKey(c *C) {
+	handler := newAuthHandler(
+		BasicAuth("api", BasicAuthUsers(map[string]string{"admin": "secret"})),
+		APIKeyAuth("X-API-Key", "api_key", func(ctx context.Context, key string) (*Principal, error) {
+			if key != "k1" {
+				return nil, ErrInvalidCredentials
+			}
+			return &Principal{Subject: "service"}, nil
+		}),
+	)
+
+	recorder := serveWithAuth(handler, func(r *http.Request) { r.SetBasicAuth("admin", "secret") })
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), Matches, `.*"Subject":"admin","Scheme":"Basic".*\n`)
+
+	recorder = serveWithAuth(handler, func(r *http.Request) { r.SetBasicAuth("admin", "wrong") })
+	c.Assert(recorder.Code, Equals, http.StatusUnauthorized)
+	c.Assert(recorder.Header().Get("WWW-Authenticate"), Equals, `Basic realm="api", charset="UTF-8"`)
+
+	recorder = serveWithAuth(handler, func(r *http.Request) { r.Header.Set("X-API-Key", "k1") })
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), Matches, `.*"Scheme":"APIKey".*\n`)
+
+	// the query key k2 is rejected
+	recorder = serveWithAuth(handler, func(r *http.Request) {})
+	c.Assert(recorder.Code, Equals, http.StatusUnauthorized)
+
+	recorder = serveWithAuth(handler, func(r *http.Request) { r.URL.RawQuery = "" })
+	c.Assert(recorder.Code, Equals, http.StatusUnauthorized)
+	c.Assert(recorder.Header()["Www-Authenticate"], HasLen, 2)
+}
+
+func (s *authSuite) TestSharedPrincipal(c *C) {
+	// the principals returned by verify are not modified
+	shared := &Principal{Subject: "service"}
+	basic := BasicAuth("api", func(ctx context.Context, username, password string) (*Principal, error) {
+		return shared, nil
+	})
+	apiKey := APIKeyAuth("X-API-Key", "", func(ctx context.Context, key string) (*Principal, error) {
+		return shared, nil
+	})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.SetBasicAuth("admin", "secret")
+	r.Header.Set("X-API-Key", "k1")
+	p, err := basic.Authenticate(context.Background(), r)
+	c.Assert(err, IsNil)
+	c.Assert(p.Scheme, Equals, "Basic")
+	p, err = apiKey.Authenticate(context.Background(), r)
+	c.Assert(err, IsNil)
+	c.Assert(p.Scheme, Equals, "APIKey")
+	c.Assert(shared, DeepEquals, &Principal{Subject: "service"})
+}
+
+func (s *authSuite) TestJWT(c *C) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, IsNil)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	secret := []byte("hmac-secret")
+
+	jwks, err := json.Marshal(map[string]interface{}{"keys": []JWK{
+		{Kty: "oct", Kid: "hs", Alg: "HS256", K: b64(secret)},
+		{Kty: "RSA", Kid: "rs", Alg: "RS256", N: b64(rsaKey.N.Bytes()), E: b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{Kty: "EC", Kid: "es", Crv: "P-256", X: b64(ecKey.X.Bytes()), Y: b64(ecKey.Y.Bytes())},
+	}})
+	c.Assert(err, IsNil)
+	path := filepath.Join(c.MkDir(), "jwks.json")
+	c.Assert(ioutil.WriteFile(path, jwks, 0600), IsNil)
+	keys, err := LoadJWKS(path)
+	c.Assert(err, IsNil)
+
+	handler := newAuthHandler(JWTAuth(keys, JWTOptions{Realm: "api", Issuer: "fn", Audience: "web"}))
+	claims := map[string]interface{}{
+		"sub":   "alice",
+		"iss":   "fn",
+		"aud":   []string{"web"},
+		"scope": "read write",
+		"roles": []string{"admin"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+	for _, token := range []string{
+		signTestToken(c, "HS256", "hs", secret, claims),
+		signTestToken(c, "RS256", "rs", rsaKey, claims),
+		signTestToken(c, "ES256", "es", ecKey, claims),
+	} {
+		recorder := serveWithAuth(handler, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) })
+		c.Assert(recorder.Code, Equals, http.StatusOK)
+		var p Principal
+		c.Assert(json.Unmarshal(recorder.Body.Bytes(), &p), IsNil)
+		c.Assert(p.Subject, Equals, "alice")
+		c.Assert(p.Scopes, DeepEquals, []string{"read", "write"})
+		c.Assert(p.HasRole("admin"), IsTrue)
+	}
+
+	// the RSA key can not verify a HMAC token
+	token := signTestToken(c, "HS256", "rs", secret, claims)
+	recorder := serveWithAuth(handler, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) })
+	c.Assert(recorder.Code, Equals, http.StatusUnauthorized)
+
+	claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	token = signTestToken(c, "HS256", "hs", secret, claims)
+	recorder = serveWithAuth(handler, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) })
+	c.Assert(recorder.Code, Equals, http.StatusUnauthorized)
+	c.Assert(recorder.Header().Get("WWW-Authenticate"), Matches, `Bearer realm="api", error="invalid_token".*`)
+
+	// the time claims of wrong type are rejected
+	for _, name := range []string{"exp", "nbf"} {
+		malformed := map[string]interface{}{"sub": "alice", "iss": "fn", "aud": "web", name: "never"}
+		token = signTestToken(c, "HS256", "hs", secret, malformed)
+		recorder = serveWithAuth(handler, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) })
+		c.Assert(recorder.Code, Equals, http.StatusUnauthorized)
+		c.Assert(recorder.Header().Get("WWW-Authenticate"), Matches, `.*malformed `+name+` claim.*`)
+	}
+
+	// the invalid token errors are identified
+	malformed := map[string]interface{}{"sub": "alice", "exp": "never"}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+signTestToken(c, "HS256", "hs", secret, malformed))
+	_, err = JWTAuth(keys, JWTOptions{}).Authenticate(context.Background(), r)
+	c.Assert(err, ErrorMatches, "invalid token: malformed exp claim")
+	for err != nil && err != ErrInvalidToken {
+		err = Unwrap(err)
+	}
+	c.Assert(err, Equals, ErrInvalidToken)
+
+	// the single HMAC secret verifies the token of any kid
+	hmac := newAuthHandler(JWTAuth(HMACKeySet(secret), JWTOptions{}))
+	for _, kid := range []string{"", "v1"} {
+		token = signTestToken(c, "HS256", kid, secret, map[string]interface{}{"sub": "alice"})
+		recorder = serveWithAuth(hmac, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) })
+		c.Assert(recorder.Code, Equals, http.StatusOK)
+	}
+
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	claims["aud"] = "mobile"
+	token = signTestToken(c, "HS256", "hs", secret, claims)
+	recorder = serveWithAuth(handler, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) })
+	c.Assert(recorder.Code, Equals, http.StatusUnauthorized)
+}
+
+func (s *authSuite) TestPrincipalWithoutAuthenticate(c *C) {
+	handler := NewGroup().Wrap(func(p Principal) (string, error) {
+		return p.Subject, nil
+	})
+	recorder := serveWithAuth(handler, func(r *http.Request) {})
+	c.Assert(recorder.Code, Equals, http.StatusUnauthorized)
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ErrForbidden returned if the principal is not authorized
+var ErrForbidden = errors.New("forbidden")
+
+// Policy authorizes the principal to access the request, the error without
+// status code is responded as 403
+type Policy func(ctx context.Context, p Principal, r *http.Request) error
+
+type namedPolicy struct {
+	name   string
+	policy Policy
+}
+
+// authorize evaluate the scopes and policies of handler, it runs after the
+// plugins so that the principal is authenticated
+func (f *fn) authorize(ctx context.Context, r *http.Request) error {
+	if len(f.scopes) == 0 && len(f.policies) == 0 {
+		return nil
+	}
+	p, ok := PrincipalFromContext(ctx)
+	if !ok {
+		return UnauthorizedError(ErrUnauthenticated)
+	}
+	for _, scope := range f.scopes {
+		if !p.HasScope(scope) {
+			return ErrorWithStatusCode(&FieldError{Field: scope, Err: ErrForbidden}, http.StatusForbidden)
+		}
+	}
+	for _, np := range f.policies {
+		err := np.policy(ctx, *p, r)
+		if err == nil {
+			continue
+		}
+		if _, ok := UnwrapErrorStatusCode(err); ok {
+			return err
+		}
+		return ErrorWithStatusCode(err, http.StatusForbidden)
+	}
+	return nil
+}
+
+// Require returns a handler requires the principal to be granted all scopes
+func (f *fn) Require(scopes ...string) Fn {
+	ff := f.with()
+	ff.scopes = append(ff.scopes, scopes...)
+	return ff
+}
+
+// Authorize returns a handler evaluates the policy before the adapter runs,
+// name describes the policy in the handler description
+func (f *fn) Authorize(name string, policy Policy) Fn {
+	if policy == nil {
+		panic("nil pointer to policy")
+	}
+	ff := f.with()
+	ff.policies = append(ff.policies, namedPolicy{name: name, policy: policy})
+	return ff
+}
+
+// RequireRoles returns a policy requires the principal to have any of roles
+func RequireRoles(roles ...string) Policy {
+	return func(_ context.Context, p Principal, _ *http.Request) error {
+		for _, role := range roles {
+			if p.HasRole(role) {
+				return nil
+			}
+		}
+		return ErrForbidden
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+
+	. "github.com/pingcap/check"
+)
+
+type authorizeSuite struct{}
+
+var _ = Suite(&authorizeSuite{})
+
+func withTestPrincipal(p *Principal) PluginFunc {
+	return func(ctx context.Context, r *http.Request) (context.Context, error) {
+		if p == nil {
+			return ctx, nil
+		}
+		return WithPrincipal(ctx, p), nil
+	}
+}
+
+func deleteUser() (string, error) { return "deleted", nil }
+
+func (s *authorizeSuite) TestRequire(c *C) {
+	serve := func(p *Principal) int {
+		group := New()
+		group.Plugin(withTestPrincipal(p))
+		handler := group.Wrap(deleteUser).Require("users:write")
+		recorder := httptest.NewRecorder()
+		request, _ := http.NewRequest(http.MethodDelete, "/users/1", nil)
+		handler.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+	c.Assert(serve(nil), Equals, http.StatusUnauthorized)
+	c.Assert(serve(&Principal{Scopes: []string{"users:read"}}), Equals, http.StatusForbidden)
+	c.Assert(serve(&Principal{Scopes: []string{"users:write"}}), Equals, http.StatusOK)
+}
+
+func (s *authorizeSuite) TestAuthorize(c *C) {
+	errOwner := errors.New("not the owner")
+	group := New()
+	group.Plugin(withTestPrincipal(&Principal{Subject: "bob", Roles: []string{"user"}}))
+	handler := group.Wrap(deleteUser).
+		Authorize("owner", func(ctx context.Context, p Principal, r *http.Request) error {
+			if r.URL.Query().Get("owner") != p.Subject {
+				return errOwner
+			}
+			return nil
+		}).
+		Authorize("admin", RequireRoles("admin", "user"))
+
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest(http.MethodDelete, "/users/1?owner=alice", nil)
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, Equals, http.StatusForbidden)
+	c.Assert(recorder.Body.String(), Equals, "\"not the owner\"\n")
+
+	recorder = httptest.NewRecorder()
+	request, _ = http.NewRequest(http.MethodDelete, "/users/1?owner=bob", nil)
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+}
+
+func (s *authorizeSuite) TestDescribe(c *C) {
+	handler := New().Wrap(deleteUser).Require("users:write").Authorize("admin", RequireRoles("admin"))
+	d, ok := Describe(handler)
+	c.Assert(ok, IsTrue)
+	c.Assert(d.Name, Equals, "github.com/pingcap/fn.deleteUser")
+	c.Assert(d.Scopes, DeepEquals, []string{"users:write"})
+	c.Assert(d.Policies, DeepEquals, []string{"admin"})
+	c.Assert(d.Request, IsNil)
+
+	d, _ = Describe(New().Wrap(func(ctx context.Context, req *invokeRequest) (string, error) { return "", nil }))
+	c.Assert(d.Request, Equals, reflect.TypeOf(&invokeRequest{}))
+
+	_, ok = Describe(http.NotFoundHandler())
+	c.Assert(ok, IsFalse)
+}
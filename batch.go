@@ -0,0 +1,256 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const defaultBatchMaxRequests = 20
+
+var (
+	// ErrNestedBatch returned if a sub-request of batch is a batch request
+	ErrNestedBatch = errors.New("nested batch request")
+	// ErrBatchTooLarge returned if the batch contains too many sub-requests
+	ErrBatchTooLarge = errors.New("too many batch requests")
+)
+
+// BatchOptions options of NewBatch
+type BatchOptions struct {
+	// Handler serves the sub-requests, default is http.DefaultServeMux
+	Handler http.Handler
+	// MaxRequests the maximum sub-requests of a batch, default is 20
+	MaxRequests int
+	// Concurrency the sub-requests served in parallel, 0 or 1 serves them
+	// sequentially in order
+	Concurrency int
+}
+
+// BatchRequest a sub-request of batch, the headers of the batch request are
+// inherited and overridden by Header, except the content, encoding and
+// conditional headers
+type BatchRequest struct {
+	Method string            `json:"method"`
+	Path   string            `json:"path"`
+	Header map[string]string `json:"headers,omitempty"`
+	Body   json.RawMessage   `json:"body,omitempty"`
+}
+
+// BatchResponse the response of a sub-request, the non-json body is encoded
+// as a string
+type BatchResponse struct {
+	Status int             `json:"status"`
+	Header http.Header     `json:"headers,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+type batchKey struct{}
+
+// batchStrippedHeaders the headers of batch request not inherited by the
+// sub-requests, they describe the batch body or negotiate its representation
+var batchStrippedHeaders = []string{
+	"Content-Length", "Content-Type", "Content-Encoding", "Accept-Encoding",
+	"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since",
+	"If-Range", "Range",
+}
+
+// Batch serves an array of sub-requests in process and responds the array of
+// their responses, each sub-request passes the plugins of its handler
+//
+// e.g:
+//
+//	mux := http.NewServeMux()
+//	mux.Handle("/login", fn.Wrap(login))
+//	mux.Handle("/batch", fn.NewBatch(fn.BatchOptions{Handler: mux, Concurrency: 4}))
+type Batch struct {
+	opts BatchOptions
+}
+
+// NewBatch returns a batch endpoint
+func NewBatch(opts BatchOptions) *Batch {
+	if opts.Handler == nil {
+		opts.Handler = http.DefaultServeMux
+	}
+	if opts.MaxRequests <= 0 {
+		opts.MaxRequests = defaultBatchMaxRequests
+	}
+	return &Batch{opts: opts}
+}
+
+func (b *Batch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if r.Context().Value(batchKey{}) != nil {
+		writeBatchError(w, http.StatusBadRequest, ErrNestedBatch)
+		return
+	}
+	var requests []BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&requests); err != nil {
+		writeBatchError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(requests) > b.opts.MaxRequests {
+		writeBatchError(w, http.StatusRequestEntityTooLarge, ErrBatchTooLarge)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), batchKey{}, true)
+	responses := make([]BatchResponse, len(requests))
+	if b.opts.Concurrency <= 1 {
+		for i := range requests {
+			responses[i] = b.serve(ctx, r, &requests[i])
+		}
+	} else {
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, b.opts.Concurrency)
+		for i := range requests {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				responses[i] = b.serve(ctx, r, &requests[i])
+			}(i)
+		}
+		wg.Wait()
+	}
+
+	body, err := encodeJSON(responses)
+	if err != nil {
+		writeBatchError(w, http.StatusInternalServerError, err)
+		return
+	}
+	_, _ = w.Write(body)
+}
+
+// serve a sub-request by the handler
+func (b *Batch) serve(ctx context.Context, parent *http.Request, req *BatchRequest) BatchResponse {
+	if req.Method == "" {
+		req.Method = http.MethodGet
+	}
+	if !strings.HasPrefix(req.Path, "/") {
+		return batchFailure(http.StatusBadRequest, fmt.Errorf("illegal path %q", req.Path))
+	}
+	var body io.Reader
+	if len(req.Body) > 0 && string(req.Body) != "null" {
+		body = bytes.NewReader(req.Body)
+	}
+	r, err := http.NewRequest(req.Method, req.Path, body)
+	if err != nil {
+		return batchFailure(http.StatusBadRequest, err)
+	}
+	r = r.WithContext(ctx)
+	r.Host = parent.Host
+	r.RemoteAddr = parent.RemoteAddr
+	for k, v := range parent.Header {
+		r.Header[k] = append([]string(nil), v...)
+	}
+	for _, k := range batchStrippedHeaders {
+		r.Header.Del(k)
+	}
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range req.Header {
+		r.Header.Set(k, v)
+	}
+	// the response is embedded in the json array, it is never compressed
+	r.Header.Del("Accept-Encoding")
+
+	recorder := &batchRecorder{header: http.Header{}}
+	if err := serveRecovered(b.opts.Handler, recorder, r); err != nil {
+		return batchFailure(http.StatusInternalServerError, err)
+	}
+	return recorder.response()
+}
+
+// serveRecovered serve the sub-request, the panic is returned as an error so
+// it does not crash the goroutine serves the sub-requests concurrently
+func serveRecovered(h http.Handler, w http.ResponseWriter, r *http.Request) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	h.ServeHTTP(w, r)
+	return nil
+}
+
+// batchRecorder records the response of sub-request
+type batchRecorder struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *batchRecorder) Header() http.Header {
+	return w.header
+}
+
+func (w *batchRecorder) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.status, w.wroteHeader = status, true
+}
+
+func (w *batchRecorder) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(p)
+}
+
+func (w *batchRecorder) response() BatchResponse {
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.header.Del("Content-Length")
+	w.header.Del("Content-Type")
+	w.header.Del("Content-Encoding")
+	resp := BatchResponse{Status: status}
+	if len(w.header) > 0 {
+		resp.Header = w.header
+	}
+	body := bytes.TrimSpace(w.body.Bytes())
+	if len(body) == 0 {
+		return resp
+	}
+	if json.Valid(body) {
+		resp.Body = body
+	} else {
+		resp.Body, _ = json.Marshal(string(body))
+	}
+	return resp
+}
+
+func batchFailure(status int, err error) BatchResponse {
+	body, _ := json.Marshal(err.Error())
+	return BatchResponse{Status: status, Body: body}
+}
+
+func writeBatchError(w http.ResponseWriter, status int, err error) {
+	body, _ := encodeJSON(err.Error())
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,139 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+type batchSuite struct{}
+
+var _ = Suite(&batchSuite{})
+
+type batchAddRequest struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+func (s *batchSuite) serve(c *C, h http.Handler, body string) *httptest.ResponseRecorder {
+	request, err := http.NewRequest(http.MethodPost, "/batch", strings.NewReader(body))
+	c.Assert(err, IsNil)
+	request.Header.Set("X-Token", "secret")
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (s *batchSuite) TestBatch(c *C) {
+	group := New()
+	group.Plugin(func(ctx context.Context, r *http.Request) (context.Context, error) {
+		if r.Header.Get("X-Token") != "secret" {
+			return ctx, ErrorWithStatusCode(errors.New("bad token"), http.StatusUnauthorized)
+		}
+		return ctx, nil
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/add", group.Wrap(func(req *batchAddRequest) (int, error) {
+		return req.A + req.B, nil
+	}))
+	mux.Handle("/text", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", r.Method)
+		_, _ = w.Write([]byte("plain"))
+	}))
+	batch := NewBatch(BatchOptions{Handler: mux, MaxRequests: 5})
+	mux.Handle("/batch", batch)
+
+	recorder := s.serve(c, batch, `[
+		{"method":"POST","path":"/add","body":{"a":1,"b":2}},
+		{"method":"POST","path":"/add","headers":{"X-Token":"bad"},"body":{"a":1}},
+		{"path":"/text"},
+		{"path":"/missing"},
+		{"path":"/batch","method":"POST","body":[]},
+		{"path":"missing"}
+	]`)
+	c.Assert(recorder.Code, Equals, http.StatusRequestEntityTooLarge)
+
+	recorder = s.serve(c, batch, `[
+		{"method":"POST","path":"/add","body":{"a":1,"b":2}},
+		{"method":"POST","path":"/add","headers":{"X-Token":"bad"},"body":{"a":1}},
+		{"path":"/text"},
+		{"path":"/batch","method":"POST","body":[]},
+		{"path":"missing"}
+	]`)
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(strings.TrimSpace(recorder.Body.String()), Equals, `[`+
+		`{"status":200,"body":3},`+
+		`{"status":401,"body":"bad token"},`+
+		`{"status":200,"headers":{"X-Method":["GET"]},"body":"plain"},`+
+		`{"status":400,"body":"nested batch request"},`+
+		`{"status":400,"body":"illegal path \"missing\""}`+
+		`]`)
+
+	recorder = s.serve(c, batch, `{}`)
+	c.Assert(recorder.Code, Equals, http.StatusBadRequest)
+}
+
+func (s *batchSuite) TestConcurrency(c *C) {
+	var running, peak int32
+	handler := New().Wrap(func() (string, error) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return "ok", nil
+	})
+	batch := NewBatch(BatchOptions{Handler: handler, Concurrency: 2})
+	recorder := s.serve(c, batch, `[{"path":"/"},{"path":"/"},{"path":"/"},{"path":"/"},{"path":"/"}]`)
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(strings.Count(recorder.Body.String(), `{"status":200,"body":"ok"}`), Equals, 5)
+	c.Assert(atomic.LoadInt32(&peak), Equals, int32(2))
+}
+
+func (s *batchSuite) TestPanicAndHeaders(c *C) {
+	mux := http.NewServeMux()
+	mux.Handle("/panic", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	mux.Handle("/echo", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "identity")
+		_, _ = w.Write([]byte(r.Header.Get("Accept-Encoding") + r.Header.Get("If-None-Match") + r.Header.Get("X-Token")))
+	}))
+	batch := NewBatch(BatchOptions{Handler: mux, Concurrency: 2})
+
+	request, err := http.NewRequest(http.MethodPost, "/batch", strings.NewReader(`[{"path":"/panic"},{"path":"/echo"}]`))
+	c.Assert(err, IsNil)
+	request.Header.Set("X-Token", "secret")
+	request.Header.Set("Accept-Encoding", "gzip")
+	request.Header.Set("If-None-Match", `"v1"`)
+	recorder := httptest.NewRecorder()
+	batch.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(strings.TrimSpace(recorder.Body.String()), Equals, `[`+
+		`{"status":500,"body":"panic: boom"},`+
+		`{"status":200,"body":"secret"}`+
+		`]`)
+}
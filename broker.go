@@ -0,0 +1,181 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"strconv"
+	"sync"
+)
+
+// MemoryBroker an in-memory broker for tests and single process apps, the
+// messages are delivered at least once, the rejected messages without requeue
+// are kept as dead letters
+type MemoryBroker struct {
+	mu     sync.Mutex
+	seq    int
+	closed bool
+	topics map[string]*memoryTopic
+}
+
+type memoryTopic struct {
+	queue chan *Message
+	acked []*Message
+	dead  []*Message
+}
+
+type memoryDelivery struct {
+	broker *MemoryBroker
+	msg    *Message
+	once   sync.Once
+}
+
+// NewMemoryBroker returns an empty broker
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{topics: map[string]*memoryTopic{}}
+}
+
+func (b *MemoryBroker) topic(name string) *memoryTopic {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.topics[name]
+	if !ok {
+		t = &memoryTopic{queue: make(chan *Message, 1024)}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// Publish enqueues a copy of the message, the ID is generated if it is empty
+func (b *MemoryBroker) Publish(ctx context.Context, topic string, msg *Message) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrBrokerClosed
+	}
+	b.seq++
+	m := *msg
+	m.Topic = topic
+	m.Attempt = 0
+	if m.ID == "" {
+		m.ID = strconv.Itoa(b.seq)
+	}
+	b.mu.Unlock()
+	return b.enqueue(ctx, &m)
+}
+
+func (b *MemoryBroker) enqueue(ctx context.Context, msg *Message) error {
+	select {
+	case b.topic(msg.Topic).queue <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// requeue returns the message to the queue without blocking, the consumer
+// nacks the message is the reader of the queue, so the full queue is waited
+// on another goroutine
+func (b *MemoryBroker) requeue(msg *Message) {
+	queue := b.topic(msg.Topic).queue
+	select {
+	case queue <- msg:
+	default:
+		go func() { queue <- msg }()
+	}
+}
+
+// Consume delivers the messages of topic until ctx is done
+func (b *MemoryBroker) Consume(ctx context.Context, topic string) (<-chan Delivery, error) {
+	b.mu.Lock()
+	closed := b.closed
+	b.mu.Unlock()
+	if closed {
+		return nil, ErrBrokerClosed
+	}
+	queue := b.topic(topic).queue
+	deliveries := make(chan Delivery)
+	go func() {
+		defer close(deliveries)
+		for {
+			select {
+			case msg := <-queue:
+				msg.Attempt++
+				select {
+				case deliveries <- &memoryDelivery{broker: b, msg: msg}:
+				case <-ctx.Done():
+					// return the message to the queue for other consumers
+					msg.Attempt--
+					go func() { queue <- msg }()
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return deliveries, nil
+}
+
+// Close rejects the later publishing and consuming
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	return nil
+}
+
+// Acked returns the acknowledged messages of topic
+func (b *MemoryBroker) Acked(topic string) []*Message {
+	t := b.topic(topic)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*Message(nil), t.acked...)
+}
+
+// Dead returns the messages of topic rejected without requeue
+func (b *MemoryBroker) Dead(topic string) []*Message {
+	t := b.topic(topic)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*Message(nil), t.dead...)
+}
+
+func (d *memoryDelivery) Message() *Message {
+	return d.msg
+}
+
+func (d *memoryDelivery) Ack() error {
+	d.once.Do(func() {
+		t := d.broker.topic(d.msg.Topic)
+		d.broker.mu.Lock()
+		t.acked = append(t.acked, d.msg)
+		d.broker.mu.Unlock()
+	})
+	return nil
+}
+
+func (d *memoryDelivery) Nack(requeue bool) error {
+	d.once.Do(func() {
+		if requeue {
+			d.broker.requeue(d.msg)
+			return
+		}
+		t := d.broker.topic(d.msg.Topic)
+		d.broker.mu.Lock()
+		t.dead = append(t.dead, d.msg)
+		d.broker.mu.Unlock()
+	})
+	return nil
+}
@@ -0,0 +1,457 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultResponseCacheTTL the default time the cached responses are fresh
+	DefaultResponseCacheTTL = time.Minute
+	// DefaultLRUStoreCapacity the default capacity of the in-memory store
+	DefaultLRUStoreCapacity = 1024
+)
+
+// errCacheFillPanicked returned to the requests waiting for a panicked fill
+var errCacheFillPanicked = errors.New("fn: cached handler panicked")
+
+// cachedHeaders the representation headers stored with the cached responses,
+// other headers set by plugins and handlers are of the filling request
+var cachedHeaders = []string{
+	"Cache-Control", "Content-Language", "Content-Type", "ETag", "Expires", "Last-Modified", "Vary",
+}
+
+// CachedResponse an encoded response stored by CacheStore
+type CachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	// Expires the response is fresh before Expires
+	Expires time.Time
+	// StaleUntil the stale response is served while revalidating before
+	// StaleUntil, it is not before Expires
+	StaleUntil time.Time
+}
+
+// CacheStore stores the encoded responses by key, it should be safe for
+// concurrent use
+type CacheStore interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, resp *CachedResponse)
+	Delete(key string)
+}
+
+// ResponseCacheOptions options of NewResponseCache
+type ResponseCacheOptions struct {
+	// Store default is an in-memory LRU store of DefaultLRUStoreCapacity
+	Store CacheStore
+	// TTL default is DefaultResponseCacheTTL
+	TTL time.Duration
+	// StaleWhileRevalidate the time the expired response is served while it
+	// is revalidated in the background
+	StaleWhileRevalidate time.Duration
+	// VaryHeaders the request headers are part of the cache key, such as
+	// `Accept-Language`
+	VaryHeaders []string
+	// VaryPrincipal caches the responses per authenticated principal, the
+	// responses of handlers bind fn.Principal are always cached per principal,
+	// it should be set if the handler reads the principal from the context
+	VaryPrincipal bool
+}
+
+// ResponseCache caches the encoded responses of GET and HEAD requests, the
+// key is the handler, path, query and the vary headers and principal, the
+// handlers bind fn.Principal vary by principal always. The
+// plugins and authorization run for every request and the hits are served
+// without calling the handler, the concurrent misses of a key call the
+// handler once. The errors are not cached and only the representation headers
+// such as Content-Type, ETag, Cache-Control and Vary are stored, the handlers
+// depend on sessions should not be cached.
+//
+// e.g:
+//
+//	cache := fn.NewResponseCache(fn.ResponseCacheOptions{TTL: time.Minute, StaleWhileRevalidate: time.Hour})
+//	http.Handle("/products", fn.Wrap(products).CacheResponse(cache))
+type ResponseCache struct {
+	store     CacheStore
+	ttl       time.Duration
+	stale     time.Duration
+	headers   []string
+	principal bool
+	flights   flightGroup
+	now       func() time.Time
+}
+
+// NewResponseCache returns a response cache shared by handlers
+func NewResponseCache(opts ResponseCacheOptions) *ResponseCache {
+	if opts.Store == nil {
+		opts.Store = NewLRUStore(DefaultLRUStoreCapacity)
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultResponseCacheTTL
+	}
+	headers := make([]string, len(opts.VaryHeaders))
+	for i, h := range opts.VaryHeaders {
+		headers[i] = http.CanonicalHeaderKey(h)
+	}
+	return &ResponseCache{
+		store:     opts.Store,
+		ttl:       opts.TTL,
+		stale:     opts.StaleWhileRevalidate,
+		headers:   headers,
+		principal: opts.VaryPrincipal,
+		now:       time.Now,
+	}
+}
+
+// CacheResponse returns a handler serves GET and HEAD requests from cache
+func (f *fn) CacheResponse(cache *ResponseCache) Fn {
+	ff := f.with()
+	ff.responses = cache
+	return ff
+}
+
+func isCacheable(r *http.Request) bool {
+	return r.Method == http.MethodGet || r.Method == http.MethodHead
+}
+
+// key returns the cache key of request, the parts are separated by NUL
+func (rc *ResponseCache) key(ctx context.Context, f *fn, r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(f.name)
+	b.WriteByte(0)
+	b.WriteString(r.URL.Path)
+	b.WriteByte(0)
+	b.WriteString(r.URL.Query().Encode())
+	for _, h := range rc.headers {
+		b.WriteByte(0)
+		b.WriteString(strings.Join(r.Header[h], ","))
+	}
+	if rc.principal || bindsPrincipal(f.adapter) {
+		b.WriteByte(0)
+		if p, ok := PrincipalFromContext(ctx); ok {
+			b.WriteString(p.Scheme + ":" + p.Subject)
+		}
+	}
+	return b.String()
+}
+
+// serveCached serves the request from cache after plugins and authorization,
+// the stale response is revalidated in the background and the `X-Cache`
+// header tells HIT, STALE or MISS
+func (f *fn) serveCached(ctx context.Context, state *requestState, w http.ResponseWriter, r *http.Request) {
+	ctx, err := f.prepare(ctx, r)
+	if err != nil {
+		f.respond(ctx, state, w, r, nil, err)
+		return
+	}
+	rc := f.responses
+	key := rc.key(ctx, f, r)
+	entry, ok := rc.store.Get(key)
+	now := rc.now()
+	switch {
+	case ok && now.Before(entry.Expires):
+		w.Header().Set("X-Cache", "HIT")
+	case ok && now.Before(entry.StaleUntil):
+		w.Header().Set("X-Cache", "STALE")
+		go f.revalidate(ctx, fillRequest(r), key)
+	default:
+		w.Header().Set("X-Cache", "MISS")
+		entry, err = rc.flights.do(ctx, key, f.filler(ctx, fillRequest(r), key))
+	}
+	f.writeCached(ctx, state, w, r, entry, err)
+}
+
+// revalidate refreshes the stale response, the error is dropped because there
+// is no request to respond
+func (f *fn) revalidate(ctx context.Context, r *http.Request, key string) {
+	_, _ = f.responses.flights.do(detachedContext{ctx}, key, f.filler(ctx, r, key))
+}
+
+// fillRequest copies the request for the fill outlives it, the conditional
+// headers of the filling request are not cached
+func fillRequest(r *http.Request) *http.Request {
+	rr := r.WithContext(r.Context())
+	rr.Header = make(http.Header, len(r.Header))
+	for k, v := range r.Header {
+		rr.Header[k] = v
+	}
+	rr.Header.Del("If-Match")
+	rr.Header.Del("If-None-Match")
+	rr.Body = http.NoBody
+	return rr
+}
+
+// filler returns the fill shared by the concurrent requests of key, it runs
+// under the values of ctx without its cancellation, and is bounded by the
+// handler timeout instead of the deadline of any request
+func (f *fn) filler(ctx context.Context, r *http.Request, key string) func() (*CachedResponse, error) {
+	return func() (*CachedResponse, error) {
+		var fillCtx context.Context = detachedContext{ctx}
+		if d := f.effectiveTimeout(); d > 0 {
+			var cancel context.CancelFunc
+			fillCtx, cancel = context.WithTimeout(fillCtx, d)
+			defer cancel()
+		}
+		return f.fill(fillCtx, r, key)
+	}
+}
+
+// fill invokes the handler and encodes the response into the cache, the
+// conditional headers are evaluated per request when the response is written
+func (f *fn) fill(ctx context.Context, r *http.Request, key string) (*CachedResponse, error) {
+	rec := &cacheRecorder{header: http.Header{}}
+	rec.header.Set("Content-Type", "application/json; charset=utf-8")
+	ctx, state := withRequestState(ctx, f)
+	state.header = rec.header
+	r = r.WithContext(ctx)
+
+	resp, err := f.invoke(ctx, r)
+	encodeCtx, span := f.container.startSpan(ctx, SpanEncode)
+	if err != nil {
+		failure(encodeCtx, f.container, rec, state, err)
+	} else {
+		f.success(encodeCtx, rec, r, state, resp)
+	}
+	span.End()
+
+	header := http.Header{}
+	for _, k := range cachedHeaders {
+		k = http.CanonicalHeaderKey(k)
+		if v, ok := rec.header[k]; ok {
+			header[k] = v
+		}
+	}
+	rc := f.responses
+	now := rc.now()
+	entry := &CachedResponse{
+		Status:     rec.status,
+		Header:     header,
+		Body:       rec.body,
+		Expires:    now.Add(rc.ttl),
+		StaleUntil: now.Add(rc.ttl + rc.stale),
+	}
+	if err == nil && entry.Status < http.StatusMultipleChoices {
+		rc.store.Set(key, entry)
+	}
+	return entry, err
+}
+
+// writeCached writes the cached response with its headers, the headers set on
+// w by plugins are kept except the default Content-Type, the conditional
+// headers of request are evaluated against the cached ETag
+func (f *fn) writeCached(ctx context.Context, state *requestState, w http.ResponseWriter, r *http.Request, entry *CachedResponse, err error) {
+	if entry == nil {
+		f.respond(ctx, state, w, r, nil, err)
+		return
+	}
+	if e := saveSession(ctx, f.container, w, state); e != nil && err == nil {
+		failure(ctx, f.container, w, state, e)
+		return
+	}
+	header := w.Header()
+	for k, v := range entry.Header {
+		switch {
+		case k == "Vary":
+			for _, token := range v {
+				if !containsToken(header["Vary"], token) {
+					header.Add("Vary", token)
+				}
+			}
+		case k == "Content-Type" || len(header[k]) == 0:
+			header[k] = append([]string(nil), v...)
+		}
+	}
+	state.info.Err = err
+	status, body := entry.Status, entry.Body
+	if err == nil {
+		s, e := f.precondition(header, r, entry.Header.Get("ETag"))
+		if e != nil {
+			failure(ctx, f.container, w, state, e)
+			return
+		}
+		if s == http.StatusNotModified {
+			status, body = s, nil
+		}
+	}
+	state.write(w, status, body)
+}
+
+// cacheRecorder records the encoded response of fill
+type cacheRecorder struct {
+	header http.Header
+	status int
+	body   []byte
+}
+
+func (r *cacheRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *cacheRecorder) WriteHeader(status int) {
+	r.status = status
+}
+
+func (r *cacheRecorder) Write(p []byte) (int, error) {
+	r.body = append(r.body, p...)
+	return len(p), nil
+}
+
+// detachedContext keeps the values of parent without its deadline and
+// cancellation, the revalidation outlives the request
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+// flightGroup deduplicates the concurrent fills of a key
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done  chan struct{}
+	entry *CachedResponse
+	err   error
+}
+
+// do calls fill once for the concurrent calls of key, fill runs on its own
+// goroutine so that no caller ends it, each call waits until fill returns or
+// its own ctx is done
+func (g *flightGroup) do(ctx context.Context, key string, fill func() (*CachedResponse, error)) (*CachedResponse, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*flightCall{}
+	}
+	c, ok := g.calls[key]
+	if !ok {
+		c = &flightCall{done: make(chan struct{})}
+		g.calls[key] = c
+		go g.run(key, c, fill)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.entry, c.err
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, ErrorWithStatusCode(ErrTimeout, http.StatusGatewayTimeout)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// run calls fill and releases the waiting calls, the panic of fill is an error
+func (g *flightGroup) run(key string, c *flightCall, fill func() (*CachedResponse, error)) {
+	defer func() {
+		if p := recover(); p != nil || c.entry == nil && c.err == nil {
+			c.entry, c.err = nil, ErrorWithStatusCode(errCacheFillPanicked, http.StatusInternalServerError)
+		}
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	c.entry, c.err = fill()
+}
+
+// lruStore an in-memory CacheStore evicts the least recently used responses
+type lruStore struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+	now      func() time.Time
+}
+
+type lruItem struct {
+	key   string
+	entry *CachedResponse
+}
+
+// NewLRUStore returns an in-memory store keeps at most capacity responses,
+// the responses are removed after StaleUntil
+func NewLRUStore(capacity int) CacheStore {
+	if capacity <= 0 {
+		capacity = DefaultLRUStoreCapacity
+	}
+	return &lruStore{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    map[string]*list.Element{},
+		now:      time.Now,
+	}
+}
+
+func (s *lruStore) Get(key string) (*CachedResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elem, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	item := elem.Value.(*lruItem)
+	if !s.now().Before(item.entry.StaleUntil) {
+		s.ll.Remove(elem)
+		delete(s.items, key)
+		return nil, false
+	}
+	s.ll.MoveToFront(elem)
+	return item.entry, true
+}
+
+func (s *lruStore) Set(key string, entry *CachedResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, ok := s.items[key]; ok {
+		elem.Value.(*lruItem).entry = entry
+		s.ll.MoveToFront(elem)
+		return
+	}
+	s.items[key] = s.ll.PushFront(&lruItem{key: key, entry: entry})
+	for s.ll.Len() > s.capacity {
+		elem := s.ll.Back()
+		s.ll.Remove(elem)
+		delete(s.items, elem.Value.(*lruItem).key)
+	}
+}
+
+func (s *lruStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, ok := s.items[key]; ok {
+		s.ll.Remove(elem)
+		delete(s.items, key)
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+type cacheSuite struct{}
+
+var _ = Suite(&cacheSuite{})
+
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func serveCache(handler http.Handler, method, target string, header map[string]string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest(method, target, nil)
+	for k, v := range header {
+		request.Header.Set(k, v)
+	}
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (s *cacheSuite) TestResponseCache(c *C) {
+	var calls int32
+	cache := NewResponseCache(ResponseCacheOptions{VaryHeaders: []string{"accept-language"}})
+	// the global encoders are modified by other suites
+	group := NewGroup()
+	group.SetResponseEncoder(defaultResponseEncoder)
+	group.SetErrorEncoder(defaultErrorEncoder)
+	handler := group.Wrap(func(ctx context.Context, form *Form) (string, error) {
+		n := atomic.AddInt32(&calls, 1)
+		if form.Get("page") == "fail" {
+			return "", errors.New("invalid page")
+		}
+		ResponseHeader(ctx).Set("X-Page", form.Get("page"))
+		return form.Get("page") + "#" + strconv.Itoa(int(n)), nil
+	}).CacheResponse(cache)
+
+	recorder := serveCache(handler, http.MethodGet, "/products?page=1", nil)
+	c.Assert(recorder.Header().Get("X-Cache"), Equals, "MISS")
+	c.Assert(recorder.Body.String(), Equals, "\"1#1\"\n")
+
+	recorder = serveCache(handler, http.MethodGet, "/products?page=1", nil)
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("X-Cache"), Equals, "HIT")
+	// only the representation headers are cached
+	c.Assert(recorder.Header().Get("X-Page"), Equals, "")
+	c.Assert(recorder.Header().Get("Content-Type"), Equals, "application/json; charset=utf-8")
+	c.Assert(recorder.Body.String(), Equals, "\"1#1\"\n")
+	c.Assert(atomic.LoadInt32(&calls), Equals, int32(1))
+
+	// the query and vary headers are part of key
+	recorder = serveCache(handler, http.MethodGet, "/products?page=2", nil)
+	c.Assert(recorder.Body.String(), Equals, "\"2#2\"\n")
+	recorder = serveCache(handler, http.MethodGet, "/products?page=1", map[string]string{"Accept-Language": "zh"})
+	c.Assert(recorder.Body.String(), Equals, "\"1#3\"\n")
+
+	// the other methods and errors are not cached
+	recorder = serveCache(handler, http.MethodDelete, "/products?page=1", nil)
+	c.Assert(recorder.Header().Get("X-Cache"), Equals, "")
+	c.Assert(recorder.Body.String(), Equals, "\"1#4\"\n")
+	for i := 0; i < 2; i++ {
+		recorder = serveCache(handler, http.MethodGet, "/products?page=fail", nil)
+		c.Assert(recorder.Code, Equals, http.StatusBadRequest)
+		c.Assert(recorder.Header().Get("X-Cache"), Equals, "MISS")
+	}
+	c.Assert(atomic.LoadInt32(&calls), Equals, int32(6))
+}
+
+func (s *cacheSuite) TestConditional(c *C) {
+	cache := NewResponseCache(ResponseCacheOptions{})
+	handler := New().ETag(ETagStrong).Wrap(func() (string, error) {
+		return "hello", nil
+	}).Cache(CachePolicy{Public: true, MaxAge: time.Minute}).CacheResponse(cache)
+
+	recorder := serveCache(handler, http.MethodGet, "/", nil)
+	tag := recorder.Header().Get("ETag")
+	c.Assert(tag, Not(Equals), "")
+
+	// the conditional headers of the filling request are not cached
+	recorder = serveCache(handler, http.MethodGet, "/?v=2", map[string]string{"If-None-Match": tag})
+	c.Assert(recorder.Code, Equals, http.StatusNotModified)
+	c.Assert(recorder.Header().Get("X-Cache"), Equals, "MISS")
+	recorder = serveCache(handler, http.MethodGet, "/?v=2", nil)
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), Equals, "\"hello\"\n")
+
+	recorder = serveCache(handler, http.MethodGet, "/", map[string]string{"If-None-Match": tag})
+	c.Assert(recorder.Code, Equals, http.StatusNotModified)
+	c.Assert(recorder.Header().Get("X-Cache"), Equals, "HIT")
+	c.Assert(recorder.Header().Get("Cache-Control"), Equals, "public, max-age=60")
+	c.Assert(recorder.Body.Len(), Equals, 0)
+
+	// If-Match of GET is not evaluated
+	recorder = serveCache(handler, http.MethodGet, "/", map[string]string{"If-Match": `"other"`})
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+}
+
+func (s *cacheSuite) TestStaleWhileRevalidate(c *C) {
+	clock := &testClock{now: time.Now()}
+	cache := NewResponseCache(ResponseCacheOptions{TTL: time.Minute, StaleWhileRevalidate: time.Hour})
+	cache.now = clock.Now
+	var calls int32
+	refreshed := make(chan struct{}, 1)
+	handler := New().Wrap(func() (string, error) {
+		n := atomic.AddInt32(&calls, 1)
+		if n > 1 {
+			defer func() { refreshed <- struct{}{} }()
+		}
+		return "v" + strconv.Itoa(int(n)), nil
+	}).CacheResponse(cache)
+
+	recorder := serveCache(handler, http.MethodGet, "/", nil)
+	c.Assert(recorder.Body.String(), Equals, "\"v1\"\n")
+
+	clock.Advance(2 * time.Minute)
+	recorder = serveCache(handler, http.MethodGet, "/", nil)
+	c.Assert(recorder.Header().Get("X-Cache"), Equals, "STALE")
+	c.Assert(recorder.Body.String(), Equals, "\"v1\"\n")
+	select {
+	case <-refreshed:
+	case <-time.After(5 * time.Second):
+		c.Fatal("timeout waiting for revalidation")
+	}
+	// the revalidated response is stored after the handler returns
+	for i := 0; i < 100; i++ {
+		recorder = serveCache(handler, http.MethodGet, "/", nil)
+		if recorder.Header().Get("X-Cache") == "HIT" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(recorder.Header().Get("X-Cache"), Equals, "HIT")
+	c.Assert(recorder.Body.String(), Equals, "\"v2\"\n")
+
+	clock.Advance(2 * time.Hour)
+	recorder = serveCache(handler, http.MethodGet, "/", nil)
+	c.Assert(recorder.Header().Get("X-Cache"), Equals, "MISS")
+	c.Assert(recorder.Body.String(), Equals, "\"v3\"\n")
+}
+
+func (s *cacheSuite) TestSingleflight(c *C) {
+	var calls int32
+	entered, release := make(chan struct{}), make(chan struct{})
+	handler := New().Wrap(func() (string, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(entered)
+		}
+		<-release
+		return "hello", nil
+	}).CacheResponse(NewResponseCache(ResponseCacheOptions{}))
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 8)
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			bodies[i] = serveCache(handler, http.MethodGet, "/", nil).Body.String()
+		}(i)
+	}
+	<-entered
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	c.Assert(atomic.LoadInt32(&calls), Equals, int32(1))
+	for _, body := range bodies {
+		c.Assert(body, Equals, "\"hello\"\n")
+	}
+}
+
+func (s *cacheSuite) TestVaryPrincipal(c *C) {
+	var calls int32
+	group := New()
+	group.Plugin(func(ctx context.Context, r *http.Request) (context.Context, error) {
+		user := r.Header.Get("X-User")
+		if user == "" {
+			return ctx, ErrorWithStatusCode(errors.New("unauthorized"), http.StatusUnauthorized)
+		}
+		return WithPrincipal(ctx, &Principal{Subject: user, Scheme: "Test"}), nil
+	})
+	cache := NewResponseCache(ResponseCacheOptions{VaryPrincipal: true})
+	handler := group.Wrap(func(ctx context.Context) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		p, _ := PrincipalFromContext(ctx)
+		return p.Subject, nil
+	}).CacheResponse(cache)
+
+	for i := 0; i < 2; i++ {
+		c.Assert(serveCache(handler, http.MethodGet, "/me", map[string]string{"X-User": "alice"}).Body.String(), Equals, "\"alice\"\n")
+		c.Assert(serveCache(handler, http.MethodGet, "/me", map[string]string{"X-User": "bob"}).Body.String(), Equals, "\"bob\"\n")
+	}
+	c.Assert(atomic.LoadInt32(&calls), Equals, int32(2))
+
+	// the plugins run for the cached responses
+	recorder := serveCache(handler, http.MethodGet, "/me", nil)
+	c.Assert(recorder.Code, Equals, http.StatusUnauthorized)
+	// the handler binds the principal varies by principal without the option
+	group.RequestPlugin(principalPtrValuer)
+	bound := group.Wrap(func(p *Principal) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		return p.Subject, nil
+	}).CacheResponse(NewResponseCache(ResponseCacheOptions{}))
+	for i := 0; i < 2; i++ {
+		c.Assert(serveCache(bound, http.MethodGet, "/me", map[string]string{"X-User": "alice"}).Body.String(), Equals, "\"alice\"\n")
+		c.Assert(serveCache(bound, http.MethodGet, "/me", map[string]string{"X-User": "bob"}).Body.String(), Equals, "\"bob\"\n")
+	}
+	c.Assert(atomic.LoadInt32(&calls), Equals, int32(4))
+	d, _ := Describe(bound)
+	c.Assert(d.Principal, IsTrue)
+}
+
+func (s *cacheSuite) TestLRUStore(c *C) {
+	clock := &testClock{now: time.Now()}
+	store := NewLRUStore(2).(*lruStore)
+	store.now = clock.Now
+	entry := func(body string) *CachedResponse {
+		return &CachedResponse{Status: http.StatusOK, Body: []byte(body), StaleUntil: clock.Now().Add(time.Minute)}
+	}
+	store.Set("a", entry("a"))
+	store.Set("b", entry("b"))
+	_, ok := store.Get("a")
+	c.Assert(ok, IsTrue)
+	// b is the least recently used
+	store.Set("c", entry("c"))
+	_, ok = store.Get("b")
+	c.Assert(ok, IsFalse)
+	v, ok := store.Get("c")
+	c.Assert(ok, IsTrue)
+	c.Assert(string(v.Body), Equals, "c")
+
+	store.Delete("c")
+	_, ok = store.Get("c")
+	c.Assert(ok, IsFalse)
+
+	clock.Advance(time.Minute)
+	_, ok = store.Get("a")
+	c.Assert(ok, IsFalse)
+	c.Assert(store.ll.Len(), Equals, 0)
+}
+
+func (s *cacheSuite) TestDetachedFill(c *C) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	group := New()
+	group.Plugin(func(ctx context.Context, r *http.Request) (context.Context, error) {
+		if v := r.Header.Get("X-Policy"); v != "" {
+			ResponseHeader(ctx).Set("Cache-Control", v)
+		}
+		return ctx, nil
+	})
+	handler := group.Wrap(func(ctx context.Context) (string, error) {
+		close(entered)
+		<-release
+		return "hello", ctx.Err()
+	}).Cache(CachePolicy{Public: true, MaxAge: time.Minute}).CacheResponse(NewResponseCache(ResponseCacheOptions{}))
+
+	// the request fills the cache is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		recorder := httptest.NewRecorder()
+		request, _ := http.NewRequest(http.MethodGet, "/", nil)
+		handler.ServeHTTP(recorder, request.WithContext(ctx))
+		leader <- recorder
+	}()
+	<-entered
+	waiter := make(chan *httptest.ResponseRecorder, 1)
+	go func() { waiter <- serveCache(handler, http.MethodGet, "/", nil) }()
+	cancel()
+	c.Assert((<-leader).Code, Equals, http.StatusBadRequest)
+	close(release)
+
+	// the waiter is served by the fill not ended by the leader
+	recorder := <-waiter
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), Equals, "\"hello\"\n")
+
+	// the header set by plugins is not overwritten
+	recorder = serveCache(handler, http.MethodGet, "/", map[string]string{"X-Policy": "no-store"})
+	c.Assert(recorder.Header().Get("X-Cache"), Equals, "HIT")
+	c.Assert(recorder.Header().Get("Cache-Control"), Equals, "no-store")
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/fn"
+	"github.com/pingcap/fn/cmd/fngen/testdata/api"
+	"github.com/pingcap/fn/fnclient"
+)
+
+func TestFngen(t *testing.T) {
+	TestingT(t)
+}
+
+type fngenSuite struct{}
+
+var _ = Suite(&fngenSuite{})
+
+func (s *fngenSuite) TestGenerate(c *C) {
+	dir := c.MkDir()
+	err := run(config{
+		dir:     "testdata/api",
+		routes:  filepath.Join(dir, "fn_routes_gen.go"),
+		client:  filepath.Join(dir, "fn_client_gen.go"),
+		openapi: filepath.Join(dir, "openapi.json"),
+		title:   "api",
+		version: "1.0.0",
+	})
+	c.Assert(err, IsNil)
+	// the generated files of testdata/api are the golden files
+	for _, name := range []string{"fn_routes_gen.go", "fn_client_gen.go", "openapi.json"} {
+		got, err := ioutil.ReadFile(filepath.Join(dir, name))
+		c.Assert(err, IsNil)
+		want, err := ioutil.ReadFile(filepath.Join("testdata/api", name))
+		c.Assert(err, IsNil)
+		c.Assert(string(got), Equals, string(want), Commentf("regenerate by `go run . -dir testdata/api -openapi openapi.json`"))
+	}
+}
+
+func (s *fngenSuite) TestGenerated(c *C) {
+	mux := http.NewServeMux()
+	api.RegisterRoutes(mux, fn.NewGroup())
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/login")
+	c.Assert(err, IsNil)
+	res.Body.Close()
+	c.Assert(res.StatusCode, Equals, http.StatusMethodNotAllowed)
+	c.Assert(res.Header.Get("Allow"), Equals, "POST")
+
+	base, err := fnclient.New(fnclient.Options{BaseURL: server.URL})
+	c.Assert(err, IsNil)
+	client := api.NewClient(base)
+	user, err := client.Login(context.Background(), &api.LoginRequest{Name: "fn"})
+	c.Assert(err, IsNil)
+	c.Assert(user.Name, Equals, "fn")
+	version, err := client.Version(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(version, Equals, "v1")
+
+	// no principal is authenticated
+	_, err = client.Profile(context.Background())
+	code, _ := fn.UnwrapErrorStatusCode(err)
+	c.Assert(code, Equals, http.StatusUnauthorized)
+	// the scopes of fn:require are applied
+	_, err = client.Logout(context.Background())
+	code, _ = fn.UnwrapErrorStatusCode(err)
+	c.Assert(code, Equals, http.StatusUnauthorized)
+}
+
+func (s *fngenSuite) TestInvalid(c *C) {
+	cases := []struct {
+		src   string
+		types string
+		err   string
+	}{
+		{"func A() (string, error)", "", ".*no fn:route directive found"},
+		{"//fn:route POST /a\nfunc A() string", "", ".*A: function return values should contain response data & error"},
+		{"//fn:route POST /a\nfunc A() (string, string)", "", ".*A: the second return value should be error"},
+		{"//fn:route POST /a\nfunc A(r *R, ctx context.Context) (string, error)", "", ".*A: the .context.Context. must be the first parameter.*"},
+		{"//fn:route POST /a\nfunc A(r R) (string, error)", "", ".*A: customize type should be a pointer\\(R\\)"},
+		{"//fn:route POST /a\nfunc A(r *R, s *S) (string, error)", "", ".*A: function should accept only one customize type"},
+		{"//fn:route POST /a\nfunc A(r *R, s *S) (string, error)", "*S", ""},
+		{"//fn:route POST /a\nfunc A(r *R, h http.Header, u *url.URL) (string, error)", "", ""},
+		{"//fn:route SEND /a\nfunc A() (string, error)", "", ".*directive should be .//fn:route METHOD /path."},
+		{"//fn:route POST /a\nfunc (R) A() (string, error)", "", ".*fn:route only supports functions, A is a method"},
+		{"//fn:route POST /a\nfunc A() (string, error)\n//fn:route POST /a\nfunc B() (string, error)", "", ".*duplicate route POST /a .*"},
+		{"//fn:route POST /a\n//fn:require \nfunc A() (string, error)", "", ".*directive should be .//fn:require scope...."},
+	}
+	for _, cas := range cases {
+		dir := c.MkDir()
+		src := "package p\n\nimport (\n\t\"context\"\n\t\"net/http\"\n\t\"net/url\"\n)\n\ntype R struct{}\n\ntype S struct{}\n\n" + cas.src + "\n"
+		c.Assert(ioutil.WriteFile(filepath.Join(dir, "p.go"), []byte(src), 0644), IsNil)
+		err := run(config{dir: dir, routes: "routes_gen.go", types: cas.types})
+		if cas.err == "" {
+			c.Assert(err, IsNil, Commentf(cas.src))
+		} else {
+			c.Assert(err, ErrorMatches, cas.err, Commentf(cas.src))
+		}
+	}
+
+	err := run(config{dir: "testdata/api", routes: "", client: "", openapi: filepath.Join(c.MkDir(), "openapi.json"), security: "oauth"})
+	c.Assert(err, ErrorMatches, "unknown security scheme \"oauth\".*")
+}
@@ -0,0 +1,189 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const header = "// Code generated by fngen. DO NOT EDIT.\n\n"
+
+var routesTemplate = template.Must(template.New("routes").Parse(header + `package {{.Package}}
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/fn"
+)
+
+// RegisterRoutes registers the annotated handlers to mux, the handlers are
+// wrapped by c
+func RegisterRoutes(mux *http.ServeMux, c *fn.Container) {
+{{- range .Paths}}
+	mux.Handle({{.Path}}, fngenRoute{
+	{{- range .Routes}}
+		{{.Method}}: c.Wrap({{.Func}}){{.Require}},
+	{{- end}}
+	})
+{{- end}}
+}
+
+// fngenRoute dispatches the request by method
+type fngenRoute map[string]http.Handler
+
+func (m fngenRoute) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h, ok := m[r.Method]; ok {
+		h.ServeHTTP(w, r)
+		return
+	}
+	methods := make([]string, 0, len(m))
+	for method := range m {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	w.WriteHeader(http.StatusMethodNotAllowed)
+}
+`))
+
+var clientTemplate = template.Must(template.New("client").Parse(header + `package {{.Package}}
+
+import (
+{{- range .Imports}}
+	{{.}}
+{{- end}}
+{{/* blank line between the standard and the third party imports */}}
+{{- range .ThirdParty}}
+	{{.}}
+{{- end}}
+)
+
+// Client the typed client of the annotated handlers
+type Client struct {
+{{- range .Routes}}
+	{{- if .Doc}}
+	// {{.Doc}}
+	{{- end}}
+	{{.Func}} func(ctx context.Context{{if .Request}}, req {{.Request}}{{end}}) ({{.Response}}, error) {{.Tag}}
+{{- end}}
+}
+
+// NewClient returns the client sends requests by c
+func NewClient(c *fnclient.Client) *Client {
+	client := &Client{}
+	c.Bind(client, nil)
+	return client
+}
+`))
+
+type pathRoutes struct {
+	Path   string
+	Routes []struct{ Method, Func, Require string }
+}
+
+// generateRoutes generates the route registration of package
+func generateRoutes(p *pkg) ([]byte, error) {
+	byPath := map[string]*pathRoutes{}
+	var paths []*pathRoutes
+	for _, r := range p.routes {
+		pr, ok := byPath[r.Path]
+		if !ok {
+			pr = &pathRoutes{Path: strconv.Quote(r.Path)}
+			byPath[r.Path] = pr
+			paths = append(paths, pr)
+		}
+		var require string
+		if len(r.Scopes) > 0 {
+			quoted := make([]string, len(r.Scopes))
+			for i, scope := range r.Scopes {
+				quoted[i] = strconv.Quote(scope)
+			}
+			require = ".Require(" + strings.Join(quoted, ", ") + ")"
+		}
+		pr.Routes = append(pr.Routes, struct{ Method, Func, Require string }{strconv.Quote(r.Method), r.Func, require})
+	}
+	return execute(routesTemplate, map[string]interface{}{
+		"Package": p.name,
+		"Paths":   paths,
+	})
+}
+
+type clientRoute struct {
+	Func     string
+	Doc      string
+	Request  string
+	Response string
+	Tag      string
+}
+
+// generateClient generates the typed client of package
+func generateClient(p *pkg) ([]byte, error) {
+	imports := map[string]bool{
+		strconv.Quote("context"):            true,
+		strconv.Quote(fnPath + "/fnclient"): true,
+	}
+	for name, path := range p.imports {
+		spec := strconv.Quote(path)
+		if path != name && !strings.HasSuffix(path, "/"+name) {
+			spec = name + " " + spec
+		}
+		imports[spec] = true
+	}
+	var std, thirdParty []string
+	for spec := range imports {
+		path, _ := strconv.Unquote(spec[strings.Index(spec, `"`):])
+		if strings.Contains(strings.Split(path, "/")[0], ".") {
+			thirdParty = append(thirdParty, spec)
+		} else {
+			std = append(std, spec)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(thirdParty)
+
+	var routes []clientRoute
+	for _, r := range p.routes {
+		cr := clientRoute{
+			Func:     r.Func,
+			Doc:      r.Doc,
+			Response: p.expr(r.Response),
+			Tag:      "`route:" + strconv.Quote(r.Method+" "+r.Path) + "`",
+		}
+		if r.Request != nil {
+			cr.Request = p.expr(r.Request)
+		}
+		routes = append(routes, cr)
+	}
+	return execute(clientTemplate, map[string]interface{}{
+		"Package":    p.name,
+		"Imports":    std,
+		"ThirdParty": thirdParty,
+		"Routes":     routes,
+	})
+}
+
+func execute(t *template.Template, data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command fngen generates the route registration, the typed client and the
+// OpenAPI document of the handlers annotated by `//fn:route METHOD /path`,
+// the handler signatures are validated like fn.Wrap at generate time
+//
+// e.g:
+//
+//	//go:generate fngen -openapi openapi.json
+//
+//	// Login logs in by name
+//	//fn:route POST /login
+//	func Login(ctx context.Context, req *LoginRequest) (*LoginResponse, error)
+//
+// The generated RegisterRoutes(mux, container) registers the handlers, and
+// NewClient(fnclient) returns a Client mirrors the handler signatures. The
+// scopes of `//fn:require scope...` are required by the registered handler
+// and the OpenAPI security of the operation.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type config struct {
+	dir      string
+	routes   string
+	client   string
+	openapi  string
+	title    string
+	version  string
+	types    string
+	security string
+}
+
+func main() {
+	var cfg config
+	flag.StringVar(&cfg.dir, "dir", ".", "the directory of package")
+	flag.StringVar(&cfg.routes, "routes", "fn_routes_gen.go", "the route registration file, empty to skip")
+	flag.StringVar(&cfg.client, "client", "fn_client_gen.go", "the typed client file, empty to skip")
+	flag.StringVar(&cfg.openapi, "openapi", "", "the OpenAPI document file, empty to skip")
+	flag.StringVar(&cfg.title, "title", "", "the title of OpenAPI document, default is the package name")
+	flag.StringVar(&cfg.version, "version", "1.0.0", "the version of OpenAPI document")
+	flag.StringVar(&cfg.security, "security", "bearer", "the OpenAPI security scheme of authenticated handlers, bearer, basic or header:Name")
+	flag.StringVar(&cfg.types, "types", "", "comma separated types registered by fn.RequestPlugin, e.g. `User,example.com/auth.Token`")
+	flag.Parse()
+
+	if err := run(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, "fngen:", err)
+		os.Exit(1)
+	}
+}
+
+// run generates the files in the package directory, the relative output
+// paths are resolved against the directory
+func run(cfg config) error {
+	pluginTypes := map[string]bool{}
+	for _, t := range strings.Split(cfg.types, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			pluginTypes[t] = true
+		}
+	}
+	p, err := parsePackage(cfg.dir, pluginTypes)
+	if err != nil {
+		return err
+	}
+	if len(p.routes) == 0 {
+		return fmt.Errorf("%s: no fn:route directive found", cfg.dir)
+	}
+	if cfg.title == "" {
+		cfg.title = p.name
+	}
+	if cfg.security == "" {
+		cfg.security = "bearer"
+	}
+
+	outputs := []struct {
+		path     string
+		generate func() ([]byte, error)
+	}{
+		{cfg.routes, func() ([]byte, error) { return generateRoutes(p) }},
+		{cfg.client, func() ([]byte, error) { return generateClient(p) }},
+		{cfg.openapi, func() ([]byte, error) { return generateOpenAPI(p, cfg.title, cfg.version, cfg.security) }},
+	}
+	for _, out := range outputs {
+		if out.path == "" {
+			continue
+		}
+		data, err := out.generate()
+		if err != nil {
+			return err
+		}
+		path := out.path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(cfg.dir, path)
+		}
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
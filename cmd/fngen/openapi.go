@@ -0,0 +1,275 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type openAPI struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       openAPIInfo                      `json:"info"`
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components openAPIComponents                `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*schema         `json:"schemas"`
+	SecuritySchemes map[string]*securityScheme `json:"securitySchemes,omitempty"`
+}
+
+type operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary,omitempty"`
+	RequestBody *requestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*response `json:"responses"`
+	// Security the scheme and scopes of the authenticated handlers, the
+	// scopes of any scheme are allowed since OpenAPI 3.1
+	Security []map[string][]string `json:"security,omitempty"`
+}
+
+type securityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+}
+
+// parseSecurityScheme returns the scheme of fn authenticators by the -security
+// flag, `header:Name` is the API key of header
+func parseSecurityScheme(v string) (string, *securityScheme, error) {
+	switch {
+	case v == "bearer":
+		return "bearerAuth", &securityScheme{Type: "http", Scheme: "bearer", BearerFormat: "JWT"}, nil
+	case v == "basic":
+		return "basicAuth", &securityScheme{Type: "http", Scheme: "basic"}, nil
+	case strings.HasPrefix(v, "header:") && len(v) > len("header:"):
+		return "apiKeyAuth", &securityScheme{Type: "apiKey", Name: strings.TrimPrefix(v, "header:"), In: "header"}, nil
+	}
+	return "", nil, fmt.Errorf("unknown security scheme %q, want bearer, basic or header:Name", v)
+}
+
+type requestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*mediaType `json:"content"`
+}
+
+type response struct {
+	Description string                `json:"description"`
+	Content     map[string]*mediaType `json:"content,omitempty"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	AdditionalProperties *schema            `json:"additionalProperties,omitempty"`
+}
+
+var basicSchemas = map[string]schema{
+	"bool":      {Type: "boolean"},
+	"string":    {Type: "string"},
+	"int":       {Type: "integer"},
+	"int8":      {Type: "integer", Format: "int32"},
+	"int16":     {Type: "integer", Format: "int32"},
+	"int32":     {Type: "integer", Format: "int32"},
+	"int64":     {Type: "integer", Format: "int64"},
+	"uint":      {Type: "integer"},
+	"uint8":     {Type: "integer", Format: "int32"},
+	"uint16":    {Type: "integer", Format: "int32"},
+	"uint32":    {Type: "integer", Format: "int64"},
+	"uint64":    {Type: "integer", Format: "int64"},
+	"float32":   {Type: "number", Format: "float"},
+	"float64":   {Type: "number", Format: "double"},
+	"byte":      {Type: "integer", Format: "int32"},
+	"rune":      {Type: "integer", Format: "int32"},
+	"time.Time": {Type: "string", Format: "date-time"},
+	// time.Duration is encoded as nanoseconds
+	"time.Duration": {Type: "integer", Format: "int64"},
+}
+
+// schemaBuilder builds the schemas of types, the named types of package are
+// collected as components
+type schemaBuilder struct {
+	p          *pkg
+	components map[string]*schema
+}
+
+// generateOpenAPI generates the OpenAPI 3.1 document of package, the handlers
+// require a principal or scopes are secured by the scheme of security
+func generateOpenAPI(p *pkg, title, version, security string) ([]byte, error) {
+	schemeName, scheme, err := parseSecurityScheme(security)
+	if err != nil {
+		return nil, err
+	}
+	b := &schemaBuilder{p: p, components: map[string]*schema{}}
+	doc := &openAPI{
+		OpenAPI:    "3.1.0",
+		Info:       openAPIInfo{Title: title, Version: version},
+		Paths:      map[string]map[string]*operation{},
+		Components: openAPIComponents{Schemas: b.components},
+	}
+	errorResponse := &response{
+		Description: "error",
+		Content:     map[string]*mediaType{"application/json": {Schema: &schema{Type: "string"}}},
+	}
+	for _, r := range p.routes {
+		op := &operation{
+			OperationID: r.Func,
+			Summary:     r.Doc,
+			Responses: map[string]*response{
+				"200": {
+					Description: "OK",
+					Content:     map[string]*mediaType{"application/json": {Schema: b.schema(r.file, r.Response)}},
+				},
+				"default": errorResponse,
+			},
+		}
+		if _, ok := r.Response.(*ast.StarExpr); ok {
+			op.Responses["204"] = &response{Description: "No Content"}
+		}
+		if r.Request != nil {
+			op.RequestBody = &requestBody{
+				Required: true,
+				Content:  map[string]*mediaType{"application/json": {Schema: b.schema(r.file, r.Request)}},
+			}
+		}
+		if r.Authenticated {
+			scopes := append([]string{}, r.Scopes...)
+			op.Security = []map[string][]string{{schemeName: scopes}}
+			doc.Components.SecuritySchemes = map[string]*securityScheme{schemeName: scheme}
+		}
+		if doc.Paths[r.Path] == nil {
+			doc.Paths[r.Path] = map[string]*operation{}
+		}
+		doc.Paths[r.Path][strings.ToLower(r.Method)] = op
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func (b *schemaBuilder) schema(file *ast.File, expr ast.Expr) *schema {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return b.schema(file, expr.X)
+	case *ast.Ident:
+		if s, ok := basicSchemas[expr.Name]; ok {
+			return &s
+		}
+		if spec, ok := b.p.types[expr.Name]; ok {
+			return b.component(spec)
+		}
+	case *ast.SelectorExpr:
+		if ident, ok := expr.X.(*ast.Ident); ok {
+			if s, ok := basicSchemas[importPath(file, ident.Name)+"."+expr.Sel.Name]; ok {
+				return &s
+			}
+		}
+	case *ast.ArrayType:
+		if ident, ok := expr.Elt.(*ast.Ident); ok && ident.Name == "byte" && expr.Len == nil {
+			return &schema{Type: "string", Format: "byte"}
+		}
+		return &schema{Type: "array", Items: b.schema(file, expr.Elt)}
+	case *ast.MapType:
+		return &schema{Type: "object", AdditionalProperties: b.schema(file, expr.Value)}
+	case *ast.StructType:
+		return b.structSchema(file, expr)
+	}
+	// any value
+	return &schema{}
+}
+
+// component returns the reference of the named type
+func (b *schemaBuilder) component(spec *ast.TypeSpec) *schema {
+	name := spec.Name.Name
+	ref := &schema{Ref: "#/components/schemas/" + name}
+	if _, ok := b.components[name]; ok {
+		return ref
+	}
+	// placeholder for recursive types
+	b.components[name] = &schema{}
+	*b.components[name] = *b.schema(b.p.typeFiles[name], spec.Type)
+	return ref
+}
+
+func (b *schemaBuilder) structSchema(file *ast.File, st *ast.StructType) *schema {
+	s := &schema{Type: "object", Properties: map[string]*schema{}}
+	for _, field := range st.Fields.List {
+		var tag reflect.StructTag
+		if field.Tag != nil {
+			v, _ := strconv.Unquote(field.Tag.Value)
+			tag = reflect.StructTag(v)
+		}
+		name := strings.Split(tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if len(field.Names) == 0 {
+			// embedded struct of package is flattened
+			typ := field.Type
+			if star, ok := typ.(*ast.StarExpr); ok {
+				typ = star.X
+			}
+			if ident, ok := typ.(*ast.Ident); ok && name == "" {
+				if spec, ok := b.p.types[ident.Name]; ok {
+					if embedded, ok := spec.Type.(*ast.StructType); ok {
+						for k, v := range b.structSchema(b.p.typeFiles[ident.Name], embedded).Properties {
+							s.Properties[k] = v
+						}
+						continue
+					}
+				}
+			}
+			if name == "" {
+				name = b.p.expr(typ)
+				if sel, ok := typ.(*ast.SelectorExpr); ok {
+					name = sel.Sel.Name
+				}
+			}
+			s.Properties[name] = b.schema(file, field.Type)
+			continue
+		}
+		for _, ident := range field.Names {
+			if !ident.IsExported() {
+				continue
+			}
+			key := name
+			if key == "" {
+				key = ident.Name
+			}
+			s.Properties[key] = b.schema(file, field.Type)
+		}
+	}
+	return s
+}
@@ -0,0 +1,317 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	directive        = "//fn:route "
+	requireDirective = "//fn:require "
+	fnPath           = "github.com/pingcap/fn"
+)
+
+// builtinTypes the types bound by the valuers of fn, keyed by the canonical
+// type name
+var builtinTypes = map[string]bool{
+	"io.ReadCloser":             true,
+	"net/http.Header":           true,
+	"*net/url.URL":              true,
+	"*net/http.Request":         true,
+	"*mime/multipart.Form":      true,
+	fnPath + ".Form":            true,
+	"*" + fnPath + ".Form":      true,
+	fnPath + ".PostForm":        true,
+	"*" + fnPath + ".PostForm":  true,
+	fnPath + ".Cookies":         true,
+	"*" + fnPath + ".Cookies":   true,
+	fnPath + ".Principal":       true,
+	"*" + fnPath + ".Principal": true,
+	fnPath + ".Session":         true,
+	fnPath + ".RequestID":       true,
+}
+
+var httpMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+// route a handler function annotated by `//fn:route METHOD /path`
+type route struct {
+	Method string
+	Path   string
+	Func   string
+	Doc    string
+	pos    token.Position
+	file   *ast.File
+	// Request the customized type, nil if absent
+	Request ast.Expr
+	// Response the first result type
+	Response ast.Expr
+	// Scopes the scopes required by `//fn:require scope...`
+	Scopes []string
+	// Authenticated the handler requires a principal
+	Authenticated bool
+}
+
+// pkg the parsed package
+type pkg struct {
+	fset   *token.FileSet
+	name   string
+	routes []*route
+	types  map[string]*ast.TypeSpec
+	// typeFiles the files declare the types
+	typeFiles map[string]*ast.File
+	// imports the imports referenced by the request and response types of
+	// routes, keyed by name
+	imports map[string]string
+}
+
+// posError an error at the position of source
+type posError struct {
+	pos token.Position
+	msg string
+}
+
+func (e *posError) Error() string {
+	return e.pos.String() + ": " + e.msg
+}
+
+// parsePackage parse the package in dir and collect the annotated handlers,
+// pluginTypes are the canonical names of the types registered by
+// fn.RequestPlugin
+func parsePackage(dir string, pluginTypes map[string]bool) (*pkg, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		name := fi.Name()
+		return !strings.HasSuffix(name, "_test.go") && !strings.HasSuffix(name, "_gen.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("%s: expect one package, found %d", dir, len(pkgs))
+	}
+	p := &pkg{fset: fset, types: map[string]*ast.TypeSpec{}, typeFiles: map[string]*ast.File{}, imports: map[string]string{}}
+	var files []*ast.File
+	for name, astPkg := range pkgs {
+		p.name = name
+		for _, file := range astPkg.Files {
+			files = append(files, file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Pos() < files[j].Pos() })
+
+	seen := map[string]token.Position{}
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					if spec, ok := spec.(*ast.TypeSpec); ok {
+						p.types[spec.Name.Name] = spec
+						p.typeFiles[spec.Name.Name] = file
+					}
+				}
+			case *ast.FuncDecl:
+				r, err := p.parseRoute(file, decl, pluginTypes)
+				if err != nil {
+					return nil, err
+				}
+				if r == nil {
+					continue
+				}
+				key := r.Method + " " + r.Path
+				if pos, ok := seen[key]; ok {
+					return nil, &posError{r.pos, "duplicate route " + key + " (" + pos.String() + ")"}
+				}
+				seen[key] = r.pos
+				p.routes = append(p.routes, r)
+			}
+		}
+	}
+	return p, nil
+}
+
+func (p *pkg) parseRoute(file *ast.File, decl *ast.FuncDecl, pluginTypes map[string]bool) (*route, error) {
+	if decl.Doc == nil {
+		return nil, nil
+	}
+	var (
+		r      *route
+		doc    []string
+		scopes []string
+	)
+	for _, comment := range decl.Doc.List {
+		if strings.HasPrefix(comment.Text, requireDirective) {
+			fields := strings.Fields(strings.TrimPrefix(comment.Text, requireDirective))
+			if len(fields) == 0 {
+				return nil, &posError{p.fset.Position(comment.Pos()), "directive should be `//fn:require scope...`"}
+			}
+			scopes = append(scopes, fields...)
+			continue
+		}
+		if !strings.HasPrefix(comment.Text, directive) {
+			line := strings.TrimSpace(strings.TrimPrefix(comment.Text, "//"))
+			if line != "" && !strings.HasPrefix(comment.Text, "//go:") {
+				doc = append(doc, line)
+			}
+			continue
+		}
+		pos := p.fset.Position(comment.Pos())
+		if r != nil {
+			return nil, &posError{pos, "duplicate fn:route directive"}
+		}
+		fields := strings.Fields(strings.TrimPrefix(comment.Text, directive))
+		if len(fields) != 2 || !httpMethods[fields[0]] || !strings.HasPrefix(fields[1], "/") {
+			return nil, &posError{pos, "directive should be `//fn:route METHOD /path`"}
+		}
+		r = &route{Method: fields[0], Path: fields[1], Func: decl.Name.Name, pos: pos, file: file}
+	}
+	if r == nil {
+		return nil, nil
+	}
+	r.Doc = strings.Join(doc, " ")
+	r.Scopes = scopes
+	r.Authenticated = len(scopes) > 0
+	if decl.Recv != nil {
+		return nil, &posError{r.pos, "fn:route only supports functions, " + decl.Name.Name + " is a method"}
+	}
+	if err := p.checkSignature(r, decl.Type, pluginTypes); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// checkSignature validate the handler signature like fn.Wrap
+func (p *pkg) checkSignature(r *route, typ *ast.FuncType, pluginTypes map[string]bool) error {
+	if typ.Results == nil || typ.Results.NumFields() != 2 {
+		return &posError{r.pos, r.Func + ": function return values should contain response data & error"}
+	}
+	results := flattenFields(typ.Results)
+	if ident, ok := results[1].(*ast.Ident); !ok || ident.Name != "error" {
+		return &posError{r.pos, r.Func + ": the second return value should be error"}
+	}
+	r.Response = results[0]
+
+	for i, param := range flattenFields(typ.Params) {
+		name := p.canonical(r.file, param)
+		switch {
+		case name == "context.Context":
+			if i != 0 {
+				return &posError{r.pos, r.Func + ": the `context.Context` must be the first parameter if the signature contains `context.Context`"}
+			}
+		case builtinTypes[name] || pluginTypes[name]:
+			if strings.TrimPrefix(name, "*") == fnPath+".Principal" {
+				r.Authenticated = true
+			}
+		default:
+			if r.Request != nil {
+				return &posError{r.pos, r.Func + ": function should accept only one customize type"}
+			}
+			if _, ok := param.(*ast.StarExpr); !ok {
+				return &posError{r.pos, r.Func + ": customize type should be a pointer(" + name + ")"}
+			}
+			r.Request = param
+			p.addImports(r.file, param)
+		}
+	}
+	p.addImports(r.file, r.Response)
+	return nil
+}
+
+// flattenFields returns the type of each field, `a, b int` is two fields
+func flattenFields(list *ast.FieldList) []ast.Expr {
+	if list == nil {
+		return nil
+	}
+	var types []ast.Expr
+	for _, field := range list.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			types = append(types, field.Type)
+		}
+	}
+	return types
+}
+
+// importPath returns the import path of the package name in file
+func importPath(file *ast.File, name string) string {
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		if spec.Name != nil {
+			if spec.Name.Name == name {
+				return path
+			}
+			continue
+		}
+		if path == name || strings.HasSuffix(path, "/"+name) {
+			return path
+		}
+	}
+	return name
+}
+
+// canonical returns the type name qualified by the import path, the types
+// of the package itself are not qualified
+func (p *pkg) canonical(file *ast.File, expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return "*" + p.canonical(file, expr.X)
+	case *ast.SelectorExpr:
+		if ident, ok := expr.X.(*ast.Ident); ok {
+			return importPath(file, ident.Name) + "." + expr.Sel.Name
+		}
+	}
+	return p.expr(expr)
+}
+
+// addImports records the imports referenced by expr
+func (p *pkg) addImports(file *ast.File, expr ast.Expr) {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok {
+				p.imports[ident.Name] = importPath(file, ident.Name)
+			}
+			return false
+		}
+		return true
+	})
+}
+
+// expr prints the source of expr
+func (p *pkg) expr(expr ast.Expr) string {
+	var buf bytes.Buffer
+	_ = printer.Fprint(&buf, p.fset, expr)
+	return buf.String()
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pingcap/fn"
+)
+
+// Base fields of records
+type Base struct {
+	ID      int64     `json:"id"`
+	Created time.Time `json:"created"`
+}
+
+// LoginRequest the request of Login
+type LoginRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes,omitempty"`
+	Theme  string   `json:"-" cookie:"theme"`
+}
+
+// User a user record
+type User struct {
+	Base
+	Name    string            `json:"name"`
+	Labels  map[string]string `json:"labels"`
+	Friends []*User           `json:"friends"`
+	TTL     time.Duration
+	secret  string
+}
+
+// Login logs in by name
+//
+//fn:route POST /login
+func Login(ctx context.Context, req *LoginRequest) (*User, error) {
+	return &User{Name: req.Name, secret: req.Theme}, nil
+}
+
+// Profile returns the user of session
+//
+//fn:route GET /profile
+func Profile(principal fn.Principal, header http.Header) (*User, error) {
+	return &User{Name: principal.Subject}, nil
+}
+
+// Logout clears the session
+//
+//fn:route POST /logout
+//fn:require session:write
+func Logout(session fn.Session) (*User, error) {
+	session.Clear()
+	return nil, nil
+}
+
+// Version the version of service
+//
+//fn:route GET /version
+func Version() (string, error) {
+	return "v1", nil
+}
+
+// helper is not routed
+func helper() {}
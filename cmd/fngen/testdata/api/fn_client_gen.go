@@ -0,0 +1,28 @@
+// Code generated by fngen. DO NOT EDIT.
+
+package api
+
+import (
+	"context"
+
+	"github.com/pingcap/fn/fnclient"
+)
+
+// Client the typed client of the annotated handlers
+type Client struct {
+	// Login logs in by name
+	Login func(ctx context.Context, req *LoginRequest) (*User, error) `route:"POST /login"`
+	// Profile returns the user of session
+	Profile func(ctx context.Context) (*User, error) `route:"GET /profile"`
+	// Logout clears the session
+	Logout func(ctx context.Context) (*User, error) `route:"POST /logout"`
+	// Version the version of service
+	Version func(ctx context.Context) (string, error) `route:"GET /version"`
+}
+
+// NewClient returns the client sends requests by c
+func NewClient(c *fnclient.Client) *Client {
+	client := &Client{}
+	c.Bind(client, nil)
+	return client
+}
@@ -0,0 +1,45 @@
+// Code generated by fngen. DO NOT EDIT.
+
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/fn"
+)
+
+// RegisterRoutes registers the annotated handlers to mux, the handlers are
+// wrapped by c
+func RegisterRoutes(mux *http.ServeMux, c *fn.Container) {
+	mux.Handle("/login", fngenRoute{
+		"POST": c.Wrap(Login),
+	})
+	mux.Handle("/profile", fngenRoute{
+		"GET": c.Wrap(Profile),
+	})
+	mux.Handle("/logout", fngenRoute{
+		"POST": c.Wrap(Logout).Require("session:write"),
+	})
+	mux.Handle("/version", fngenRoute{
+		"GET": c.Wrap(Version),
+	})
+}
+
+// fngenRoute dispatches the request by method
+type fngenRoute map[string]http.Handler
+
+func (m fngenRoute) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h, ok := m[r.Method]; ok {
+		h.ServeHTTP(w, r)
+		return
+	}
+	methods := make([]string, 0, len(m))
+	for method := range m {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	w.WriteHeader(http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,392 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultCompressMinSize the default size below which responses are not
+// compressed
+const DefaultCompressMinSize = 1024
+
+var (
+	// DefaultCompressSkipTypes the content types are compressed already
+	DefaultCompressSkipTypes = []string{
+		"image/", "video/", "audio/", "font/woff",
+		"application/zip", "application/gzip", "application/x-gzip", "application/zstd",
+	}
+	// DefaultCompressStreamTypes the content types are streamed
+	DefaultCompressStreamTypes = []string{
+		"text/event-stream", "application/x-ndjson", "application/ndjson",
+	}
+)
+
+// CompressWriter the compressing writer, Flush writes the pending data to
+// the underlying writer
+type CompressWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// Compressor compresses responses with a content coding such as brotli
+type Compressor interface {
+	// Encoding the token of `Content-Encoding` header such as `br`
+	Encoding() string
+	// NewWriter returns a writer compresses to w
+	NewWriter(w io.Writer) CompressWriter
+}
+
+// CompressOptions options of compression
+type CompressOptions struct {
+	// Compressors in the order of preference, default is gzip and deflate
+	Compressors []Compressor
+	// MinSize the responses smaller than MinSize are not compressed, default
+	// is DefaultCompressMinSize, negative compresses all responses
+	MinSize int
+	// SkipTypes the prefixes of content types are not compressed, default is
+	// DefaultCompressSkipTypes
+	SkipTypes []string
+	// StreamTypes the prefixes of content types are compressed regardless of
+	// size and flushed by http.Flusher, default is DefaultCompressStreamTypes
+	StreamTypes []string
+}
+
+func (o CompressOptions) withDefaults() *CompressOptions {
+	if len(o.Compressors) == 0 {
+		o.Compressors = []Compressor{GzipCompressor(gzip.DefaultCompression), DeflateCompressor(flate.DefaultCompression)}
+	}
+	if o.MinSize == 0 {
+		o.MinSize = DefaultCompressMinSize
+	}
+	if o.SkipTypes == nil {
+		o.SkipTypes = DefaultCompressSkipTypes
+	}
+	if o.StreamTypes == nil {
+		o.StreamTypes = DefaultCompressStreamTypes
+	}
+	return &o
+}
+
+// Compress compress the responses of handlers negotiated by `Accept-Encoding`
+func (c *Container) Compress(opts CompressOptions) *Container {
+	c.compress = opts.withDefaults()
+	return c
+}
+
+// Compress returns a middleware compresses the responses of any handler, the
+// streaming responses such as SSE are flushed through the compressor
+//
+// e.g:
+//
+//	http.Handle("/events", fn.Compress(fn.CompressOptions{})(events))
+func Compress(opts CompressOptions) Middleware {
+	o := opts.withDefaults()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Upgrade") != "" {
+				// the upgraded connection is hijacked
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := newCompressWriter(w, r, o)
+			next.ServeHTTP(cw, r)
+			_ = cw.Close()
+		})
+	}
+}
+
+type gzipCompressor struct {
+	level int
+	pool  sync.Pool
+}
+
+// GzipCompressor returns the gzip compressor of level, the writers are pooled
+func GzipCompressor(level int) Compressor {
+	if _, err := gzip.NewWriterLevel(nil, level); err != nil {
+		panic(err)
+	}
+	return &gzipCompressor{level: level}
+}
+
+func (c *gzipCompressor) Encoding() string {
+	return "gzip"
+}
+
+func (c *gzipCompressor) NewWriter(w io.Writer) CompressWriter {
+	if v, ok := c.pool.Get().(*gzip.Writer); ok {
+		v.Reset(w)
+		return &pooledWriter{CompressWriter: v, release: func() { c.pool.Put(v) }}
+	}
+	v, _ := gzip.NewWriterLevel(w, c.level)
+	return &pooledWriter{CompressWriter: v, release: func() { c.pool.Put(v) }}
+}
+
+type deflateCompressor struct {
+	level int
+	pool  sync.Pool
+}
+
+// DeflateCompressor returns the deflate compressor of level, the writers are
+// pooled
+func DeflateCompressor(level int) Compressor {
+	if _, err := flate.NewWriter(nil, level); err != nil {
+		panic(err)
+	}
+	return &deflateCompressor{level: level}
+}
+
+func (c *deflateCompressor) Encoding() string {
+	return "deflate"
+}
+
+func (c *deflateCompressor) NewWriter(w io.Writer) CompressWriter {
+	if v, ok := c.pool.Get().(*flate.Writer); ok {
+		v.Reset(w)
+		return &pooledWriter{CompressWriter: v, release: func() { c.pool.Put(v) }}
+	}
+	v, _ := flate.NewWriter(w, c.level)
+	return &pooledWriter{CompressWriter: v, release: func() { c.pool.Put(v) }}
+}
+
+// pooledWriter returns the writer to pool after closing
+type pooledWriter struct {
+	CompressWriter
+	release func()
+}
+
+func (w *pooledWriter) Close() error {
+	err := w.CompressWriter.Close()
+	w.release()
+	return err
+}
+
+// negotiateEncoding returns the compressor of the highest quality in header,
+// the preference order of compressors breaks the tie
+func negotiateEncoding(header string, compressors []Compressor) Compressor {
+	if header == "" {
+		return nil
+	}
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		q := 1.0
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				v, err := strconv.ParseFloat(p[2:], 64)
+				if err != nil {
+					v = 0
+				}
+				q = v
+			}
+		}
+		qualities[name] = q
+	}
+	var (
+		best  Compressor
+		bestQ float64
+	)
+	for _, c := range compressors {
+		q, ok := qualities[c.Encoding()]
+		if !ok {
+			q = qualities["*"]
+		}
+		if q > bestQ {
+			best, bestQ = c, q
+		}
+	}
+	return best
+}
+
+// compressWriter buffers the response until the size reaches the threshold
+// then decides whether the response is compressed by the headers
+type compressWriter struct {
+	http.ResponseWriter
+	opts       *CompressOptions
+	compressor Compressor
+	status     int
+	buf        []byte
+	decided    bool
+	writer     CompressWriter
+}
+
+func newCompressWriter(w http.ResponseWriter, r *http.Request, opts *CompressOptions) *compressWriter {
+	cw := &compressWriter{ResponseWriter: w, opts: opts, status: http.StatusOK}
+	if r.Method != http.MethodHead {
+		cw.compressor = negotiateEncoding(r.Header.Get("Accept-Encoding"), opts.Compressors)
+	}
+	return cw
+}
+
+func containsToken(values []string, token string) bool {
+	for _, v := range values {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); strings.EqualFold(t, token) || t == "*" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.decided {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+	if !w.compressible() {
+		w.decide(false)
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.decided {
+		if w.writer != nil {
+			return w.writer.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
+	}
+	w.buf = append(w.buf, p...)
+	switch {
+	case !w.compressible():
+		w.decide(false)
+	case len(w.buf) >= w.opts.MinSize || w.streaming():
+		w.decide(true)
+	default:
+		return len(p), nil
+	}
+	if err := w.writeBuffer(); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes the pending data, the buffered response is compressed only if
+// it is streaming
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(w.compressible() && (w.streaming() || len(w.buf) >= w.opts.MinSize))
+		if w.writeBuffer() != nil {
+			return
+		}
+	}
+	if w.writer != nil && w.writer.Flush() != nil {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close writes the buffered response and finishes the compression
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		w.decide(w.compressible() && len(w.buf) >= w.opts.MinSize)
+		if err := w.writeBuffer(); err != nil {
+			return err
+		}
+	}
+	if w.writer != nil {
+		err := w.writer.Close()
+		w.writer = nil
+		return err
+	}
+	return nil
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// compressible reports whether the response may be compressed by its status
+// and headers
+func (w *compressWriter) compressible() bool {
+	if w.compressor == nil {
+		return false
+	}
+	if w.status < http.StatusOK || w.status == http.StatusNoContent || w.status == http.StatusNotModified {
+		return false
+	}
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	return !matchMediaType(header.Get("Content-Type"), w.opts.SkipTypes)
+}
+
+func (w *compressWriter) streaming() bool {
+	return matchMediaType(w.Header().Get("Content-Type"), w.opts.StreamTypes)
+}
+
+func matchMediaType(contentType string, prefixes []string) bool {
+	if contentType == "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(contentType)
+	}
+	for _, p := range prefixes {
+		if strings.HasPrefix(mediaType, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// decide writes the header with or without the content coding, the response
+// varies by `Accept-Encoding` in both cases, the strong ETag of compressed
+// response is suffixed by the coding
+func (w *compressWriter) decide(compress bool) {
+	w.decided = true
+	header := w.Header()
+	if !containsToken(header["Vary"], "Accept-Encoding") {
+		header.Add("Vary", "Accept-Encoding")
+	}
+	if compress {
+		header.Set("Content-Encoding", w.compressor.Encoding())
+		header.Del("Content-Length")
+		if tag := header.Get("ETag"); tag != "" {
+			header.Set("ETag", codedETag(tag, w.compressor.Encoding()))
+		}
+		w.writer = w.compressor.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+func (w *compressWriter) writeBuffer() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	buf := w.buf
+	w.buf = nil
+	var err error
+	if w.writer != nil {
+		_, err = w.writer.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
@@ -0,0 +1,181 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/pingcap/check"
+)
+
+type compressSuite struct{}
+
+var _ = Suite(&compressSuite{})
+
+// identityCompressor a pluggable compressor writes the data as is
+type identityCompressor struct{}
+
+type nopCompressWriter struct{ io.Writer }
+
+func (nopCompressWriter) Close() error { return nil }
+func (nopCompressWriter) Flush() error { return nil }
+
+func (identityCompressor) Encoding() string { return "br" }
+
+func (identityCompressor) NewWriter(w io.Writer) CompressWriter {
+	return nopCompressWriter{w}
+}
+
+func (s *compressSuite) TestNegotiateEncoding(c *C) {
+	compressors := []Compressor{identityCompressor{}, GzipCompressor(gzip.BestSpeed), DeflateCompressor(flate.BestSpeed)}
+	cases := []struct {
+		header   string
+		expected string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"deflate, gzip", "gzip"},
+		{"gzip;q=0.5, deflate", "deflate"},
+		{"br, gzip", "br"},
+		{"*", "br"},
+		{"*, br;q=0", "gzip"},
+		{"GZIP;q=0.8", "gzip"},
+		{"gzip;q=0", ""},
+	}
+	for _, t := range cases {
+		encoding := ""
+		if v := negotiateEncoding(t.header, compressors); v != nil {
+			encoding = v.Encoding()
+		}
+		c.Assert(encoding, Equals, t.expected, Commentf("%s", t.header))
+	}
+}
+
+func serveCompressed(handler http.Handler, method, acceptEncoding string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest(method, "/", nil)
+	if acceptEncoding != "" {
+		request.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (s *compressSuite) TestCompress(c *C) {
+	large := strings.Repeat("fn", 1024)
+	group := New().ETag(ETagStrong).Compress(CompressOptions{})
+	handler := group.Wrap(func() (string, error) { return large, nil })
+
+	recorder := serveCompressed(handler, http.MethodGet, "gzip, deflate")
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Encoding"), Equals, "gzip")
+	c.Assert(recorder.Header().Get("Vary"), Equals, "Accept-Encoding")
+	reader, err := gzip.NewReader(recorder.Body)
+	c.Assert(err, IsNil)
+	body, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, `"`+large+"\"\n")
+
+	recorder = serveCompressed(handler, http.MethodGet, "deflate")
+	c.Assert(recorder.Header().Get("Content-Encoding"), Equals, "deflate")
+	body, err = ioutil.ReadAll(flate.NewReader(recorder.Body))
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, `"`+large+"\"\n")
+
+	// the strong ETag of compressed response is suffixed by the coding
+	coded := recorder.Header().Get("ETag")
+	recorder = serveCompressed(handler, http.MethodGet, "")
+	c.Assert(recorder.Header().Get("Content-Encoding"), Equals, "")
+	c.Assert(recorder.Header().Get("Vary"), Equals, "Accept-Encoding")
+	tag := recorder.Header().Get("ETag")
+	c.Assert(coded, Equals, strings.TrimSuffix(tag, `"`)+`-deflate"`)
+	c.Assert(recorder.Body.Len(), Equals, len(large)+3)
+
+	// the compressed tag is revalidated
+	request, _ := http.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("Accept-Encoding", "deflate")
+	request.Header.Set("If-None-Match", coded)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, Equals, http.StatusNotModified)
+	c.Assert(recorder.Header().Get("ETag"), Equals, coded)
+
+	small := group.Wrap(func() (string, error) { return "fn", nil })
+	recorder = serveCompressed(small, http.MethodGet, "gzip")
+	c.Assert(recorder.Header().Get("Content-Encoding"), Equals, "")
+	c.Assert(recorder.Body.String(), Equals, "\"fn\"\n")
+
+	empty := group.Wrap(func() (*struct{}, error) { return nil, nil })
+	recorder = serveCompressed(empty, http.MethodGet, "gzip")
+	c.Assert(recorder.Code, Equals, http.StatusNoContent)
+	c.Assert(recorder.Header().Get("Content-Encoding"), Equals, "")
+}
+
+func (s *compressSuite) TestCompressMiddleware(c *C) {
+	payload := bytes.Repeat([]byte{0x89}, 2048)
+	png := Compress(CompressOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(payload)
+	}))
+	recorder := serveCompressed(png, http.MethodGet, "gzip")
+	c.Assert(recorder.Header().Get("Content-Encoding"), Equals, "")
+	c.Assert(recorder.Body.Bytes(), DeepEquals, payload)
+
+	plugged := Compress(CompressOptions{Compressors: []Compressor{identityCompressor{}}, MinSize: -1})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Vary", "Origin")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("fn"))
+	}))
+	recorder = serveCompressed(plugged, http.MethodGet, "br")
+	c.Assert(recorder.Code, Equals, http.StatusCreated)
+	c.Assert(recorder.Header().Get("Content-Encoding"), Equals, "br")
+	c.Assert(recorder.Header()["Vary"], DeepEquals, []string{"Origin", "Accept-Encoding"})
+	c.Assert(recorder.Body.String(), Equals, "fn")
+}
+
+func (s *compressSuite) TestCompressStream(c *C) {
+	flushed := make(chan []byte, 1)
+	events := Compress(CompressOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: hello\n\n")
+		w.(http.Flusher).Flush()
+		flushed <- append([]byte(nil), w.(interface{ Unwrap() http.ResponseWriter }).Unwrap().(*httptest.ResponseRecorder).Body.Bytes()...)
+		io.WriteString(w, "data: bye\n\n")
+	}))
+	recorder := serveCompressed(events, http.MethodGet, "gzip")
+	c.Assert(recorder.Header().Get("Content-Encoding"), Equals, "gzip")
+	c.Assert(recorder.Flushed, IsTrue)
+
+	// the first event is readable before the stream ends
+	reader, err := gzip.NewReader(bytes.NewReader(<-flushed))
+	c.Assert(err, IsNil)
+	event := make([]byte, len("data: hello\n\n"))
+	_, err = io.ReadFull(reader, event)
+	c.Assert(err, IsNil)
+	c.Assert(string(event), Equals, "data: hello\n\n")
+
+	reader, err = gzip.NewReader(recorder.Body)
+	c.Assert(err, IsNil)
+	body, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "data: hello\n\ndata: bye\n\n")
+}
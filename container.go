@@ -4,15 +4,26 @@ import (
 	"context"
 	"net/http"
 	"reflect"
+	"time"
 )
 
 type (
 	supportType map[reflect.Type]contextValuer
 	Container   struct {
 		plugins         []PluginFunc
+		middlewares     []Middleware
 		supportTypes    supportType
 		errorEncoder    ErrorEncoder
 		responseEncoder ResponseEncoder
+		multipart       MultipartOptions
+		lenientForm     bool
+		maxFormSliceLen int
+		sessionProvider SessionProvider
+		timeout         time.Duration
+		tracer          Tracer
+		etag            ETagMode
+		compress        *CompressOptions
+		checkOrigin     func(r *http.Request) bool
 	}
 )
 
@@ -30,10 +41,20 @@ func (c *Container) New() *Container {
 
 func (c *Container) Clone() *Container {
 	return &Container{
-		plugins:         c.plugins[:],
+		plugins:         append([]PluginFunc(nil), c.plugins...),
+		middlewares:     append([]Middleware(nil), c.middlewares...),
 		supportTypes:    c.supportTypes.clone(),
 		responseEncoder: c.responseEncoder,
 		errorEncoder:    c.errorEncoder,
+		multipart:       c.multipart.clone(),
+		lenientForm:     c.lenientForm,
+		maxFormSliceLen: c.maxFormSliceLen,
+		sessionProvider: c.sessionProvider,
+		timeout:         c.timeout,
+		tracer:          c.tracer,
+		etag:            c.etag,
+		compress:        c.compress,
+		checkOrigin:     c.checkOrigin,
 	}
 }
 
@@ -47,6 +68,7 @@ func (c *Container) Wrap(f interface{}) Fn {
 	if numIn == 0 {
 		// func() (Response, error)
 		adapter = &simplePlainAdapter{
+			container: c,
 			inContext: false,
 			method:    reflect.ValueOf(f),
 			cacheArgs: []reflect.Value{},
@@ -54,16 +76,17 @@ func (c *Container) Wrap(f interface{}) Fn {
 	} else if numIn == 1 && inContext {
 		// func(ctx context.Context) (Response, error)
 		adapter = &simplePlainAdapter{
+			container: c,
 			inContext: true,
 			method:    reflect.ValueOf(f),
-			cacheArgs: make([]reflect.Value, 1),
 		}
 	} else if numIn == 1 && !c.isBuiltinType(t.In(0)) && t.In(0).Kind() == reflect.Ptr {
 		// func(request *Customized) (Response, error)
+		checkRequestType(t.In(0))
 		adapter = &simpleUnaryAdapter{
+			container: c,
 			argType:   t.In(0),
 			method:    reflect.ValueOf(f),
-			cacheArgs: make([]reflect.Value, 1),
 		}
 	} else {
 		// Complicated signatures
@@ -79,7 +102,7 @@ func (c *Container) Wrap(f interface{}) Fn {
 		adapter = makeGenericAdapter(c, reflect.ValueOf(f), inContext)
 	}
 
-	return &fn{container: c, adapter: adapter}
+	return &fn{container: c, adapter: adapter, name: funcName(reflect.ValueOf(f))}
 }
 
 func (c *Container) Plugin(before ...PluginFunc) *Container {
@@ -93,7 +116,7 @@ func (c *Container) Plugin(before ...PluginFunc) *Container {
 
 // buildSupportTypesFunc 生成对应
 func buildSupportTypesFunc(vv reflect.Value) contextValuer {
-	return func(ctx context.Context, r *http.Request) (value reflect.Value, err error) {
+	return func(ctx context.Context, _ *Container, r *http.Request) (value reflect.Value, err error) {
 		v := vv.Call([]reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(r)})
 		if v[1].IsNil() {
 			return v[0], nil
@@ -155,6 +178,51 @@ func (c *Container) SetResponseEncoder(r ResponseEncoder) {
 	c.responseEncoder = r
 }
 
+// SetMultipartFormMaxMemory set multipart max memory, the default is used if
+// m is not positive
+func (c *Container) SetMultipartFormMaxMemory(m int64) {
+	if m <= 0 {
+		m = defaultMultipartMaxMemory
+	}
+	c.multipart.MaxMemory = m
+}
+
+// SetMultipartOptions set multipart form limits
+func (c *Container) SetMultipartOptions(o MultipartOptions) {
+	if o.MaxMemory <= 0 {
+		o.MaxMemory = defaultMultipartMaxMemory
+	}
+	c.multipart = o.clone()
+}
+
+// SetLenientForm swallow the form parse errors and hand the partially parsed
+// form to the handler, the legacy behavior of form types
+func (c *Container) SetLenientForm(lenient bool) {
+	c.lenientForm = lenient
+}
+
+// SetMaxFormSliceLen set the max length of slice decoded from the `key[n]`
+// form fields, the larger index is rejected before allocating the slice, the
+// default is 1000 if n is not positive
+func (c *Container) SetMaxFormSliceLen(n int) {
+	if n <= 0 {
+		n = defaultMaxFormSliceLen
+	}
+	c.maxFormSliceLen = n
+}
+
+// SetSessionProvider set the provider of Session parameter
+func (c *Container) SetSessionProvider(p SessionProvider) {
+	c.sessionProvider = p
+}
+
+// Timeout set the handler timeout, the client supplied timeout by
+// `X-Request-Timeout` or `grpc-timeout` header is capped by d
+func (c *Container) Timeout(d time.Duration) *Container {
+	c.timeout = d
+	return c
+}
+
 // NewGroup 以继承模式新建容器
 func NewGroup() *Container {
 	return globalContainer.Clone()
@@ -166,5 +234,8 @@ func New() *Container {
 		supportTypes:    supportType{},
 		responseEncoder: defaultResponseEncoder,
 		errorEncoder:    defaultErrorEncoder,
+		multipart:       MultipartOptions{MaxMemory: defaultMultipartMaxMemory},
+		maxFormSliceLen: defaultMaxFormSliceLen,
+		tracer:          noopTracer{},
 	}
 }
@@ -0,0 +1,340 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+	"time"
+)
+
+var (
+	cookiesType    = reflect.TypeOf(Cookies{})
+	cookiesPtrType = reflect.TypeOf((*Cookies)(nil))
+)
+
+// Cookies parse `request.Cookies()`, the cookies are read only, the typed
+// getters of Form are available by the cookie name
+type Cookies struct {
+	values  url.Values
+	cookies []*http.Cookie
+}
+
+func newCookies(r *http.Request) Cookies {
+	cookies := r.Cookies()
+	values := make(url.Values, len(cookies))
+	for _, c := range cookies {
+		values.Add(c.Name, c.Value)
+	}
+	return Cookies{values: values, cookies: cookies}
+}
+
+// Get returns the value of the first cookie of name
+func (c *Cookies) Get(name string) string {
+	return c.values.Get(name)
+}
+
+// form returns the read only view of cookies for the typed getters
+func (c *Cookies) form() *uniform {
+	return &uniform{Values: c.values}
+}
+
+// Int reads the cookie of name like Form.Int
+func (c *Cookies) Int(name string) int {
+	return c.form().Int(name)
+}
+
+// IntOrDefault reads the cookie of name like Form.IntOrDefault
+func (c *Cookies) IntOrDefault(name string, def int) int {
+	return c.form().IntOrDefault(name, def)
+}
+
+// Int64 reads the cookie of name like Form.Int64
+func (c *Cookies) Int64(name string) int64 {
+	return c.form().Int64(name)
+}
+
+// Int64OrDefault reads the cookie of name like Form.Int64OrDefault
+func (c *Cookies) Int64OrDefault(name string, def int64) int64 {
+	return c.form().Int64OrDefault(name, def)
+}
+
+// Uint64 reads the cookie of name like Form.Uint64
+func (c *Cookies) Uint64(name string) uint64 {
+	return c.form().Uint64(name)
+}
+
+// Uint64OrDefault reads the cookie of name like Form.Uint64OrDefault
+func (c *Cookies) Uint64OrDefault(name string, def uint64) uint64 {
+	return c.form().Uint64OrDefault(name, def)
+}
+
+// IntE reads the cookie of name like Form.IntE
+func (c *Cookies) IntE(name string) (int, error) {
+	return c.form().IntE(name)
+}
+
+// MustInt reads the cookie of name like Form.MustInt
+func (c *Cookies) MustInt(name string) (int, error) {
+	return c.form().MustInt(name)
+}
+
+// Int64E reads the cookie of name like Form.Int64E
+func (c *Cookies) Int64E(name string) (int64, error) {
+	return c.form().Int64E(name)
+}
+
+// MustInt64 reads the cookie of name like Form.MustInt64
+func (c *Cookies) MustInt64(name string) (int64, error) {
+	return c.form().MustInt64(name)
+}
+
+// Uint64E reads the cookie of name like Form.Uint64E
+func (c *Cookies) Uint64E(name string) (uint64, error) {
+	return c.form().Uint64E(name)
+}
+
+// MustUint64 reads the cookie of name like Form.MustUint64
+func (c *Cookies) MustUint64(name string) (uint64, error) {
+	return c.form().MustUint64(name)
+}
+
+// Bool reads the cookie of name like Form.Bool
+func (c *Cookies) Bool(name string) bool {
+	return c.form().Bool(name)
+}
+
+// BoolOrDefault reads the cookie of name like Form.BoolOrDefault
+func (c *Cookies) BoolOrDefault(name string, def bool) bool {
+	return c.form().BoolOrDefault(name, def)
+}
+
+// BoolE reads the cookie of name like Form.BoolE
+func (c *Cookies) BoolE(name string) (bool, error) {
+	return c.form().BoolE(name)
+}
+
+// MustBool reads the cookie of name like Form.MustBool
+func (c *Cookies) MustBool(name string) (bool, error) {
+	return c.form().MustBool(name)
+}
+
+// Float64 reads the cookie of name like Form.Float64
+func (c *Cookies) Float64(name string) float64 {
+	return c.form().Float64(name)
+}
+
+// Float64OrDefault reads the cookie of name like Form.Float64OrDefault
+func (c *Cookies) Float64OrDefault(name string, def float64) float64 {
+	return c.form().Float64OrDefault(name, def)
+}
+
+// Float64E reads the cookie of name like Form.Float64E
+func (c *Cookies) Float64E(name string) (float64, error) {
+	return c.form().Float64E(name)
+}
+
+// MustFloat64 reads the cookie of name like Form.MustFloat64
+func (c *Cookies) MustFloat64(name string) (float64, error) {
+	return c.form().MustFloat64(name)
+}
+
+// Duration reads the cookie of name like Form.Duration
+func (c *Cookies) Duration(name string) time.Duration {
+	return c.form().Duration(name)
+}
+
+// DurationOrDefault reads the cookie of name like Form.DurationOrDefault
+func (c *Cookies) DurationOrDefault(name string, def time.Duration) time.Duration {
+	return c.form().DurationOrDefault(name, def)
+}
+
+// DurationE reads the cookie of name like Form.DurationE
+func (c *Cookies) DurationE(name string) (time.Duration, error) {
+	return c.form().DurationE(name)
+}
+
+// MustDuration reads the cookie of name like Form.MustDuration
+func (c *Cookies) MustDuration(name string) (time.Duration, error) {
+	return c.form().MustDuration(name)
+}
+
+// Time reads the cookie of name like Form.Time
+func (c *Cookies) Time(name, layout string) time.Time {
+	return c.form().Time(name, layout)
+}
+
+// TimeOrDefault reads the cookie of name like Form.TimeOrDefault
+func (c *Cookies) TimeOrDefault(name, layout string, def time.Time) time.Time {
+	return c.form().TimeOrDefault(name, layout, def)
+}
+
+// TimeE reads the cookie of name like Form.TimeE
+func (c *Cookies) TimeE(name, layout string) (time.Time, error) {
+	return c.form().TimeE(name, layout)
+}
+
+// MustTime reads the cookie of name like Form.MustTime
+func (c *Cookies) MustTime(name, layout string) (time.Time, error) {
+	return c.form().MustTime(name, layout)
+}
+
+// MustString reads the cookie of name like Form.MustString
+func (c *Cookies) MustString(name string) (string, error) {
+	return c.form().MustString(name)
+}
+
+// Strings reads the cookie of name like Form.Strings
+func (c *Cookies) Strings(name string) []string {
+	return c.form().Strings(name)
+}
+
+// MustStrings reads the cookie of name like Form.MustStrings
+func (c *Cookies) MustStrings(name string) ([]string, error) {
+	return c.form().MustStrings(name)
+}
+
+// Ints reads the cookie of name like Form.Ints
+func (c *Cookies) Ints(name string) []int {
+	return c.form().Ints(name)
+}
+
+// IntsE reads the cookie of name like Form.IntsE
+func (c *Cookies) IntsE(name string) ([]int, error) {
+	return c.form().IntsE(name)
+}
+
+// MustInts reads the cookie of name like Form.MustInts
+func (c *Cookies) MustInts(name string) ([]int, error) {
+	return c.form().MustInts(name)
+}
+
+// Enum reads the cookie of name like Form.Enum
+func (c *Cookies) Enum(name string, allowed ...string) string {
+	return c.form().Enum(name, allowed...)
+}
+
+// EnumE reads the cookie of name like Form.EnumE
+func (c *Cookies) EnumE(name string, allowed ...string) (string, error) {
+	return c.form().EnumE(name, allowed...)
+}
+
+// MustEnum reads the cookie of name like Form.MustEnum
+func (c *Cookies) MustEnum(name string, allowed ...string) (string, error) {
+	return c.form().MustEnum(name, allowed...)
+}
+
+// Cookie returns the first cookie of name
+func (c *Cookies) Cookie(name string) (*http.Cookie, bool) {
+	for _, cookie := range c.cookies {
+		if cookie.Name == name {
+			return cookie, true
+		}
+	}
+	return nil, false
+}
+
+// All returns all cookies of the request
+func (c *Cookies) All() []*http.Cookie {
+	return c.cookies
+}
+
+func cookiesValuer(_ context.Context, r *http.Request) (Cookies, error) {
+	return newCookies(r), nil
+}
+
+func cookiesPtrValuer(_ context.Context, r *http.Request) (*Cookies, error) {
+	cookies := newCookies(r)
+	return &cookies, nil
+}
+
+// cookieField represents a struct field tagged with `cookie:"name"`
+type cookieField struct {
+	index []int
+	name  string
+}
+
+var cookieFieldsCache sync.Map // map[reflect.Type][]cookieField
+
+func structCookieFields(t reflect.Type) []cookieField {
+	if v, ok := cookieFieldsCache.Load(t); ok {
+		return v.([]cookieField)
+	}
+	var fields []cookieField
+	if t.Kind() == reflect.Struct {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, ok := field.Tag.Lookup("cookie")
+			if !ok || name == "-" {
+				continue
+			}
+			if !isFormScalar(field.Type) {
+				panic("cookie tag only support scalar field (" + t.String() + "." + field.Name + ")")
+			}
+			fields = append(fields, cookieField{index: field.Index, name: name})
+		}
+	}
+	v, _ := cookieFieldsCache.LoadOrStore(t, fields)
+	return v.([]cookieField)
+}
+
+// bindCookies bind cookies to the fields tagged with `cookie` of the struct
+// which dst points to
+func bindCookies(r *http.Request, dst reflect.Value) error {
+	fields := structCookieFields(dst.Type().Elem())
+	if len(fields) == 0 {
+		return nil
+	}
+	elem := dst.Elem()
+	for _, f := range fields {
+		cookie, err := r.Cookie(f.name)
+		if err != nil {
+			continue
+		}
+		if err := setFormScalar(f.name, elem.FieldByIndex(f.index), cookie.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EncodeCookies encodes the fields tagged with `cookie` of the struct src
+// into cookies, the reverse of binding, the empty fields are skipped
+func EncodeCookies(src interface{}) ([]*http.Cookie, error) {
+	v := reflect.ValueOf(src)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, errFormSrc
+	}
+	var cookies []*http.Cookie
+	for _, f := range structCookieFields(v.Type()) {
+		fv := v.FieldByIndex(f.index)
+		if isEmptyFormValue(fv) {
+			continue
+		}
+		values := url.Values{}
+		if err := encodeFormValue(values, f.name, fv); err != nil {
+			return nil, err
+		}
+		for _, value := range values[f.name] {
+			cookies = append(cookies, &http.Cookie{Name: f.name, Value: value})
+		}
+	}
+	return cookies, nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/pingcap/check"
+)
+
+type cookieSuite struct{}
+
+var _ = Suite(&cookieSuite{})
+
+func (s *cookieSuite) TestCookies(c *C) {
+	var got *Cookies
+	handler := NewGroup().Wrap(func(cookies *Cookies) (string, error) {
+		got = cookies
+		return "", nil
+	})
+	request, err := http.NewRequest(http.MethodGet, "/", nil)
+	c.Assert(err, IsNil)
+	request.AddCookie(&http.Cookie{Name: "uid", Value: "42"})
+	request.AddCookie(&http.Cookie{Name: "debug", Value: "true"})
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	c.Assert(got.Get("uid"), Equals, "42")
+	c.Assert(got.Get("debug"), Equals, "true")
+	c.Assert(got.Get("missing"), Equals, "")
+	cookie, ok := got.Cookie("uid")
+	c.Assert(ok, IsTrue)
+	c.Assert(cookie.Value, Equals, "42")
+	c.Assert(len(got.All()), Equals, 2)
+
+	// the typed getters
+	c.Assert(got.Int("uid"), Equals, 42)
+	c.Assert(got.IntOrDefault("missing", 3), Equals, 3)
+	c.Assert(got.Bool("debug"), IsTrue)
+	_, err = got.BoolE("uid")
+	c.Assert(err, ErrorMatches, "uid: .*invalid syntax")
+	_, err = got.MustInt("missing")
+	c.Assert(err, ErrorMatches, "missing: .*")
+	c.Assert(got.Enum("debug", "true", "false"), Equals, "true")
+}
+
+func (s *cookieSuite) TestBindCookieTags(c *C) {
+	type request struct {
+		UID   int64  `cookie:"uid"`
+		Theme string `cookie:"theme"`
+	}
+	var got *request
+	handler := NewGroup().Wrap(func(req *request) (string, error) {
+		got = req
+		return "", nil
+	})
+	r, err := http.NewRequest(http.MethodGet, "/", nil)
+	c.Assert(err, IsNil)
+	r.AddCookie(&http.Cookie{Name: "uid", Value: "7"})
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, r)
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(got.UID, Equals, int64(7))
+	c.Assert(got.Theme, Equals, "")
+
+	r, err = http.NewRequest(http.MethodGet, "/", nil)
+	c.Assert(err, IsNil)
+	r.AddCookie(&http.Cookie{Name: "uid", Value: "x"})
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, r)
+	c.Assert(recorder.Code, Equals, http.StatusBadRequest)
+}
+
+func (s *cookieSuite) TestEncodeCookies(c *C) {
+	type request struct {
+		UID   int64  `cookie:"uid"`
+		Theme string `cookie:"theme"`
+		Name  string `json:"name"`
+	}
+	cookies, err := EncodeCookies(&request{UID: 7, Name: "fn"})
+	c.Assert(err, IsNil)
+	c.Assert(cookies, DeepEquals, []*http.Cookie{{Name: "uid", Value: "7"}})
+
+	_, err = EncodeCookies("fn")
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"net/http"
+	"reflect"
+	"runtime"
+)
+
+// Description describes a wrapped handler for generating API descriptions
+type Description struct {
+	// Name the name of wrapped function
+	Name string
+	// Scopes the scopes required by Fn.Require
+	Scopes []string
+	// Policies the names of policies added by Fn.Authorize
+	Policies []string
+	// Request the customized request type such as *LoginRequest, nil if the
+	// handler accepts builtin types only
+	Request reflect.Type
+	// Principal reports whether the handler binds fn.Principal
+	Principal bool
+}
+
+// Describe returns the description of handler wrapped by fn
+func Describe(h http.Handler) (Description, bool) {
+	f, ok := h.(*fn)
+	if !ok {
+		return Description{}, false
+	}
+	d := Description{
+		Name:      f.name,
+		Scopes:    append([]string(nil), f.scopes...),
+		Request:   requestTypeOf(f.adapter),
+		Principal: bindsPrincipal(f.adapter),
+	}
+	for _, p := range f.policies {
+		d.Policies = append(d.Policies, p.name)
+	}
+	return d, true
+}
+
+// requestTypeOf returns the customized request type bound by adapter
+func requestTypeOf(a adapter) reflect.Type {
+	switch a := a.(type) {
+	case *simpleUnaryAdapter:
+		return a.argType
+	case *genericAdapter:
+		for _, typ := range a.types {
+			if typ != contextType && !a.container.isBuiltinType(typ) {
+				return typ
+			}
+		}
+	}
+	return nil
+}
+
+// bindsPrincipal reports whether the adapter binds Principal or *Principal
+func bindsPrincipal(a adapter) bool {
+	if a, ok := a.(*genericAdapter); ok {
+		for _, typ := range a.types {
+			if typ == principalType || typ == principalPtrType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func funcName(v reflect.Value) string {
+	if f := runtime.FuncForPC(v.Pointer()); f != nil {
+		return f.Name()
+	}
+	return ""
+}
@@ -0,0 +1,41 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"net/http"
+)
+
+// ErrorEnvelope the error body encoded by EnvelopeErrorEncoder
+type ErrorEnvelope struct {
+	Code      int    `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// EnvelopeErrorEncoder encodes error as ErrorEnvelope carries the status code
+// and the request ID, the ID is carried by the response header of
+// RequestIDPlugin with the default error encoder
+//
+// e.g:
+// fn.SetErrorEncoder(fn.EnvelopeErrorEncoder)
+func EnvelopeErrorEncoder(ctx context.Context, err error) interface{} {
+	code := http.StatusBadRequest
+	if v, ok := UnwrapErrorStatusCode(err); ok {
+		code = v
+	}
+	id, _ := RequestIDFromContext(ctx)
+	return &ErrorEnvelope{Code: code, Message: err.Error(), RequestID: id}
+}
@@ -50,3 +50,17 @@ func UnwrapErrorStatusCode(err error) (int, bool) {
 func ErrorWithStatusCode(err error, statusCode int) error {
 	return &statusCodeError{err, statusCode}
 }
+
+// FieldError represents an error related to a named request field
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (f *FieldError) Error() string {
+	return f.Field + ": " + f.Err.Error()
+}
+
+func (f *FieldError) Unwrap() error {
+	return f.Err
+}
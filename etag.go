@@ -0,0 +1,277 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrPreconditionFailed returned if the `If-Match` or `If-None-Match` header
+// of unsafe request is not satisfied by the current ETag
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// ETagMode the mode of ETag computed from the encoded payload
+type ETagMode int
+
+const (
+	// ETagOff computes no ETag, the ETagger payload supplies one still
+	ETagOff ETagMode = iota
+	// ETagStrong computes the strong ETag such as `"8a3f..."`
+	ETagStrong
+	// ETagWeak computes the weak ETag such as `W/"8a3f..."`
+	ETagWeak
+)
+
+// ETagger the payload implements ETagger supplies the ETag of response instead
+// of computing it from the encoded payload, the tag is quoted if it is not
+//
+// e.g:
+//
+//	func (u *User) ETag() string { return `W/"` + strconv.Itoa(u.Version) + `"` }
+type ETagger interface {
+	ETag() string
+}
+
+// ETagResolver resolves the current ETag of the resource which the request
+// modifies, empty if the resource does not exist
+//
+// e.g:
+//
+//	func userETag(ctx context.Context, r *http.Request) (string, error) {
+//	    version, err := store.UserVersion(ctx, r.URL.Query().Get("id"))
+//	    return `"v` + strconv.Itoa(version) + `"`, err
+//	}
+type ETagResolver func(ctx context.Context, r *http.Request) (string, error)
+
+// CachePolicy the `Cache-Control` directives of successful responses, the
+// zero value sets no header
+type CachePolicy struct {
+	Public               bool
+	Private              bool
+	NoCache              bool
+	NoStore              bool
+	MaxAge               time.Duration
+	SharedMaxAge         time.Duration
+	StaleWhileRevalidate time.Duration
+	MustRevalidate       bool
+	Immutable            bool
+}
+
+// String returns the value of `Cache-Control` header
+func (p CachePolicy) String() string {
+	var directives []string
+	flag := func(ok bool, name string) {
+		if ok {
+			directives = append(directives, name)
+		}
+	}
+	age := func(d time.Duration, name string) {
+		if d > 0 {
+			directives = append(directives, name+"="+strconv.FormatInt(int64(d/time.Second), 10))
+		}
+	}
+	flag(p.Public, "public")
+	flag(p.Private, "private")
+	flag(p.NoCache, "no-cache")
+	flag(p.NoStore, "no-store")
+	age(p.MaxAge, "max-age")
+	age(p.SharedMaxAge, "s-maxage")
+	age(p.StaleWhileRevalidate, "stale-while-revalidate")
+	flag(p.MustRevalidate, "must-revalidate")
+	flag(p.Immutable, "immutable")
+	return strings.Join(directives, ", ")
+}
+
+// ETag set the ETag mode of handlers, the conditional requests are evaluated
+// against the ETag of successful responses
+func (c *Container) ETag(mode ETagMode) *Container {
+	c.etag = mode
+	return c
+}
+
+// SetETag set the ETag mode of global container
+func SetETag(mode ETagMode) {
+	globalContainer.ETag(mode)
+}
+
+// Cache returns a handler sets the `Cache-Control` header of successful
+// responses by p, the header set by the handler is kept
+func (f *fn) Cache(p CachePolicy) Fn {
+	ff := f.with()
+	ff.cache = p.String()
+	return ff
+}
+
+// etagOf returns the ETag of payload, empty if the payload supplies none and
+// the container computes none
+func (c *Container) etagOf(payload interface{}, body []byte) string {
+	if t, ok := payload.(ETagger); ok {
+		if tag := t.ETag(); tag != "" {
+			return quoteETag(tag)
+		}
+	}
+	if c.etag == ETagOff {
+		return ""
+	}
+	sum := sha256.Sum256(body)
+	tag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	if c.etag == ETagWeak {
+		tag = "W/" + tag
+	}
+	return tag
+}
+
+func quoteETag(tag string) string {
+	if strings.HasPrefix(tag, `"`) || strings.HasPrefix(tag, `W/"`) {
+		return tag
+	}
+	return `"` + tag + `"`
+}
+
+// CurrentETag returns a handler evaluates the `If-Match` and `If-None-Match`
+// headers of unsafe requests against the ETag resolved before the handler runs
+func (f *fn) CurrentETag(resolve ETagResolver) Fn {
+	ff := f.with()
+	ff.currentETag = resolve
+	return ff
+}
+
+// checkPrecondition evaluates the conditional headers of unsafe request
+// against the current ETag before the handler runs, the request can not be
+// evaluated without resolver fails so that the resource is not modified. The
+// weak tags match `If-Match` as well for they identify the resolved version
+func (f *fn) checkPrecondition(ctx context.Context, r *http.Request) error {
+	if isCacheable(r) {
+		return nil
+	}
+	ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+	if ifMatch == "" && ifNoneMatch == "" {
+		return nil
+	}
+	failed := ErrorWithStatusCode(ErrPreconditionFailed, http.StatusPreconditionFailed)
+	if f.currentETag == nil {
+		return failed
+	}
+	tag, err := f.currentETag(ctx, r)
+	if err != nil {
+		return err
+	}
+	if tag != "" {
+		tag = quoteETag(tag)
+	}
+	codings := f.container.etagCodings()
+	if ifMatch != "" && (tag == "" || matchETag(ifMatch, tag, true, codings) == "") {
+		return failed
+	}
+	if ifNoneMatch != "" && tag != "" && matchETag(ifNoneMatch, tag, true, codings) != "" {
+		return failed
+	}
+	return nil
+}
+
+// conditional sets the ETag and Cache-Control headers of successful response
+// and evaluates `If-None-Match` of GET and HEAD requests like RFC 9110, 304 is
+// returned if it matches the ETag of payload, the preconditions of unsafe
+// requests are evaluated by checkPrecondition before the handler runs
+func (f *fn) conditional(w http.ResponseWriter, r *http.Request, payload interface{}, body []byte) (int, error) {
+	return f.precondition(w.Header(), r, f.container.etagOf(payload, body))
+}
+
+// precondition evaluates `If-None-Match` of GET and HEAD requests against
+// tag, the ETag and Cache-Control headers are set, the 304 response carries
+// the matched tag which may be of a compressed response
+func (f *fn) precondition(header http.Header, r *http.Request, tag string) (int, error) {
+	if tag == "" {
+		f.setCacheControl(header)
+		return http.StatusOK, nil
+	}
+	if v := r.Header.Get("If-None-Match"); v != "" && isCacheable(r) {
+		if matched := matchETag(v, tag, true, f.container.etagCodings()); matched != "" {
+			if matched == "*" {
+				matched = tag
+			}
+			header.Set("ETag", matched)
+			header.Del("Content-Type")
+			f.setCacheControl(header)
+			return http.StatusNotModified, nil
+		}
+	}
+	header.Set("ETag", tag)
+	f.setCacheControl(header)
+	return http.StatusOK, nil
+}
+
+func (f *fn) setCacheControl(header http.Header) {
+	if f.cache != "" && header.Get("Cache-Control") == "" {
+		header.Set("Cache-Control", f.cache)
+	}
+}
+
+// matchETag returns the tag of conditional header list matches tag or its
+// compressed variant of codings, the weak comparison ignores the `W/` prefix,
+// `*` matches any tag, empty is returned if nothing matches
+func matchETag(list, tag string, weak bool, codings []string) string {
+	for _, v := range strings.Split(list, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" {
+			return v
+		}
+		if !weak && (strings.HasPrefix(v, "W/") || strings.HasPrefix(tag, "W/")) {
+			continue
+		}
+		candidate := strings.TrimPrefix(v, "W/")
+		if candidate == strings.TrimPrefix(tag, "W/") {
+			return v
+		}
+		for _, coding := range codings {
+			if candidate == codedETag(strings.TrimPrefix(tag, "W/"), coding) {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+// codedETag returns the strong tag of the response compressed by coding, such
+// as `"8a3f...-gzip"`, the compressed bytes differ from the identity response
+// so that they can not share a strong tag, the weak tag is kept
+func codedETag(tag, coding string) string {
+	if !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) || len(tag) < 2 {
+		return tag
+	}
+	return tag[:len(tag)-1] + "-" + coding + `"`
+}
+
+// etagCodings the codings of compressed ETag matched by the conditional
+// headers, they are of the container compressors or the default ones
+func (c *Container) etagCodings() []string {
+	if c.compress == nil {
+		return defaultETagCodings
+	}
+	codings := make([]string, len(c.compress.Compressors))
+	for i, compressor := range c.compress.Compressors {
+		codings[i] = compressor.Encoding()
+	}
+	return codings
+}
+
+// defaultETagCodings the codings of default compressors
+var defaultETagCodings = []string{"gzip", "deflate"}
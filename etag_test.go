@@ -0,0 +1,166 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+type etagSuite struct{}
+
+var _ = Suite(&etagSuite{})
+
+type versioned struct {
+	Name    string `json:"name"`
+	Version int    `json:"-"`
+}
+
+func (v *versioned) ETag() string {
+	return "v" + strconv.Itoa(v.Version)
+}
+
+func serveConditional(handler http.Handler, method string, header map[string]string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest(method, "/", nil)
+	for k, v := range header {
+		request.Header.Set(k, v)
+	}
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (s *etagSuite) TestComputedETag(c *C) {
+	handler := New().ETag(ETagStrong).Wrap(func() (string, error) { return "hello", nil })
+	recorder := serveConditional(handler, http.MethodGet, nil)
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	tag := recorder.Header().Get("ETag")
+	c.Assert(tag, Matches, `"[0-9a-f]{32}"`)
+
+	recorder = serveConditional(handler, http.MethodGet, map[string]string{"If-None-Match": `"other", ` + tag})
+	c.Assert(recorder.Code, Equals, http.StatusNotModified)
+	c.Assert(recorder.Body.Len(), Equals, 0)
+	c.Assert(recorder.Header().Get("ETag"), Equals, tag)
+	c.Assert(recorder.Header().Get("Content-Type"), Equals, "")
+
+	// the weak comparison of If-None-Match
+	recorder = serveConditional(handler, http.MethodHead, map[string]string{"If-None-Match": "W/" + tag})
+	c.Assert(recorder.Code, Equals, http.StatusNotModified)
+
+	recorder = serveConditional(handler, http.MethodGet, map[string]string{"If-None-Match": `"other"`})
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), Equals, "\"hello\"\n")
+
+	weak := New().ETag(ETagWeak).Wrap(func() (string, error) { return "hello", nil })
+	recorder = serveConditional(weak, http.MethodGet, nil)
+	c.Assert(recorder.Header().Get("ETag"), Equals, "W/"+tag)
+}
+
+func (s *etagSuite) TestIfMatch(c *C) {
+	current, writes := "v2", 0
+	handler := New().Wrap(func() (*versioned, error) {
+		writes++
+		return &versioned{Name: "fn", Version: 3}, nil
+	}).CurrentETag(func(ctx context.Context, r *http.Request) (string, error) {
+		return current, nil
+	})
+
+	// the stale tag fails before the handler runs
+	recorder := serveConditional(handler, http.MethodPut, map[string]string{"If-Match": `"v1"`})
+	c.Assert(recorder.Code, Equals, http.StatusPreconditionFailed)
+	c.Assert(recorder.Body.String(), Equals, "\"precondition failed\"\n")
+	c.Assert(writes, Equals, 0)
+
+	recorder = serveConditional(handler, http.MethodPut, map[string]string{"If-Match": `"v1", "v2"`})
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("ETag"), Equals, `"v3"`)
+	recorder = serveConditional(handler, http.MethodPut, map[string]string{"If-Match": "*"})
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	// the weak tag sent by the server matches
+	recorder = serveConditional(handler, http.MethodPut, map[string]string{"If-Match": `W/"v2"`})
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	// the tag of compressed response matches
+	recorder = serveConditional(handler, http.MethodPut, map[string]string{"If-Match": `"v2-gzip"`})
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(writes, Equals, 4)
+
+	recorder = serveConditional(handler, http.MethodPost, map[string]string{"If-None-Match": "*"})
+	c.Assert(recorder.Code, Equals, http.StatusPreconditionFailed)
+	c.Assert(writes, Equals, 4)
+
+	// the missing resource
+	current = ""
+	recorder = serveConditional(handler, http.MethodPut, map[string]string{"If-Match": "*"})
+	c.Assert(recorder.Code, Equals, http.StatusPreconditionFailed)
+	recorder = serveConditional(handler, http.MethodPost, map[string]string{"If-None-Match": "*"})
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(writes, Equals, 5)
+
+	// If-Match of GET is not evaluated
+	recorder = serveConditional(handler, http.MethodGet, map[string]string{"If-Match": `"v1"`})
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+
+	// the preconditions can not be evaluated without resolver
+	plain := New().Wrap(func() (string, error) {
+		writes++
+		return "hello", nil
+	})
+	recorder = serveConditional(plain, http.MethodPut, map[string]string{"If-Match": `"v1"`})
+	c.Assert(recorder.Code, Equals, http.StatusPreconditionFailed)
+	recorder = serveConditional(plain, http.MethodPut, nil)
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(writes, Equals, 7)
+
+	failed := New().Wrap(func() (string, error) { return "hello", nil }).CurrentETag(func(ctx context.Context, r *http.Request) (string, error) {
+		return "", ErrorWithStatusCode(errors.New("not found"), http.StatusNotFound)
+	})
+	recorder = serveConditional(failed, http.MethodDelete, map[string]string{"If-Match": `"v1"`})
+	c.Assert(recorder.Code, Equals, http.StatusNotFound)
+}
+
+func (s *etagSuite) TestCachePolicy(c *C) {
+	c.Assert(CachePolicy{}.String(), Equals, "")
+	c.Assert(CachePolicy{Public: true, MaxAge: time.Minute, StaleWhileRevalidate: 30 * time.Second}.String(), Equals,
+		"public, max-age=60, stale-while-revalidate=30")
+	c.Assert(CachePolicy{Private: true, NoCache: true, MustRevalidate: true}.String(), Equals, "private, no-cache, must-revalidate")
+
+	policy := CachePolicy{Public: true, SharedMaxAge: time.Hour, Immutable: true}
+	handler := New().ETag(ETagStrong).Wrap(func() (string, error) { return "hello", nil }).Cache(policy)
+	recorder := serveConditional(handler, http.MethodGet, nil)
+	c.Assert(recorder.Header().Get("Cache-Control"), Equals, "public, s-maxage=3600, immutable")
+
+	recorder = serveConditional(handler, http.MethodGet, map[string]string{"If-None-Match": recorder.Header().Get("ETag")})
+	c.Assert(recorder.Code, Equals, http.StatusNotModified)
+	c.Assert(recorder.Header().Get("Cache-Control"), Equals, "public, s-maxage=3600, immutable")
+
+	// the header set by handler is kept
+	handler = New().Wrap(func(ctx context.Context) (string, error) {
+		ResponseHeader(ctx).Set("Cache-Control", "no-store")
+		return "hello", nil
+	}).Cache(policy)
+	recorder = serveConditional(handler, http.MethodGet, nil)
+	c.Assert(recorder.Header().Get("Cache-Control"), Equals, "no-store")
+
+	// errors are not cached
+	handler = New().Wrap(func() (string, error) { return "", errors.New("not found") }).Cache(policy)
+	recorder = serveConditional(handler, http.MethodGet, nil)
+	c.Assert(recorder.Code, Equals, http.StatusBadRequest)
+	c.Assert(recorder.Header().Get("Cache-Control"), Equals, "")
+}
@@ -0,0 +1,437 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fncli runs the handlers wrapped by fn as subcommands, the flags of
+// a subcommand are built from the `form` tags of the request type like the
+// form binder, the handler is invoked in process and the payload or error is
+// printed as json or table
+//
+// e.g:
+//
+//	type ListRequest struct {
+//	    Page int      `form:"page" usage:"page number"`
+//	    Tags []string `form:"tag"`   // -tag a -tag b
+//	}
+//
+//	app := fncli.New(fncli.Options{Name: "ops"})
+//	app.Command("list-users", "list the users", group.Wrap(listUsers))
+//	app.Main() // ops list-users -page 2 -tag admin -output table
+package fncli
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pingcap/fn"
+)
+
+// Exit codes returned by Run
+const (
+	ExitOK    = 0
+	ExitError = 1
+	ExitUsage = 2
+)
+
+// the output formats selected by the `-output` flag
+const (
+	OutputJSON  = "json"
+	OutputTable = "table"
+)
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Options options of New
+type Options struct {
+	// Name the program name printed in usage, default is os.Args[0]
+	Name string
+	// Stdout the writer of payloads, default is os.Stdout
+	Stdout io.Writer
+	// Stderr the writer of errors and usage, default is os.Stderr
+	Stderr io.Writer
+}
+
+// App maps the wrapped handlers to subcommands
+type App struct {
+	name     string
+	stdout   io.Writer
+	stderr   io.Writer
+	commands []*command
+}
+
+type command struct {
+	name    string
+	usage   string
+	handler fn.Fn
+	request reflect.Type
+}
+
+// New returns an app without subcommands
+func New(opts Options) *App {
+	if opts.Name == "" {
+		opts.Name = os.Args[0]
+	}
+	if opts.Stdout == nil {
+		opts.Stdout = os.Stdout
+	}
+	if opts.Stderr == nil {
+		opts.Stderr = os.Stderr
+	}
+	return &App{name: opts.Name, stdout: opts.Stdout, stderr: opts.Stderr}
+}
+
+// Command registers f as the subcommand name, f is a handler wrapped by fn or
+// a function wrapped by fn.Wrap, it panics if the name is registered, the
+// `output` flag is reserved for the output format
+func (a *App) Command(name, usage string, f interface{}) *App {
+	if a.command(name) != nil {
+		panic("command " + name + " is registered")
+	}
+	h, ok := f.(fn.Fn)
+	if !ok {
+		h = fn.Wrap(f)
+	}
+	d, _ := fn.Describe(h)
+	cmd := &command{name: name, usage: usage, handler: h, request: d.Request}
+	// build the flags at registration so the invalid request types panic early
+	cmd.flagSet(a.stderr, url.Values{}, new(string))
+	a.commands = append(a.commands, cmd)
+	return a
+}
+
+func (a *App) command(name string) *command {
+	for _, cmd := range a.commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// Main runs the subcommand of os.Args and exits with the code of Run
+func (a *App) Main() {
+	os.Exit(a.Run(context.Background(), os.Args[1:]))
+}
+
+// Run parses the subcommand and its flags from args and invokes the handler,
+// the plugins, authorization and timeout of handler are applied
+func (a *App) Run(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		a.printUsage()
+		return ExitUsage
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		if len(args) > 1 {
+			if cmd := a.command(args[1]); cmd != nil {
+				cmd.flagSet(a.stderr, url.Values{}, new(string)).Usage()
+				return ExitOK
+			}
+		}
+		a.printUsage()
+		return ExitOK
+	}
+	cmd := a.command(args[0])
+	if cmd == nil {
+		fmt.Fprintf(a.stderr, "unknown command %q\n", args[0])
+		a.printUsage()
+		return ExitUsage
+	}
+
+	values, output := url.Values{}, OutputJSON
+	flags := cmd.flagSet(a.stderr, values, &output)
+	if err := flags.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+	if output != OutputJSON && output != OutputTable {
+		fmt.Fprintf(a.stderr, "invalid output %q, want %s or %s\n", output, OutputJSON, OutputTable)
+		return ExitUsage
+	}
+
+	var req interface{}
+	if cmd.request != nil {
+		value := reflect.New(cmd.request.Elem())
+		if err := fn.DecodeForm(values, value.Interface()); err != nil {
+			fmt.Fprintln(a.stderr, err)
+			flags.Usage()
+			return ExitUsage
+		}
+		req = value.Interface()
+	}
+	payload, err := fn.Invoke(ctx, cmd.handler, req)
+	if err != nil {
+		a.printError(output, err)
+		return ExitError
+	}
+	if err := a.print(output, payload); err != nil {
+		fmt.Fprintln(a.stderr, err)
+		return ExitError
+	}
+	return ExitOK
+}
+
+func (a *App) printUsage() {
+	fmt.Fprintf(a.stderr, "Usage: %s <command> [flags]\n\nCommands:\n", a.name)
+	w := tabwriter.NewWriter(a.stderr, 0, 4, 2, ' ', 0)
+	for _, cmd := range a.commands {
+		fmt.Fprintf(w, "  %s\t%s\n", cmd.name, cmd.usage)
+	}
+	w.Flush()
+	fmt.Fprintf(a.stderr, "\nRun '%s help <command>' for the flags of command.\n", a.name)
+}
+
+// flagSet returns the flags of command, the parsed flags are stored in values
+// keyed like the form fields
+func (cmd *command) flagSet(stderr io.Writer, values url.Values, output *string) *flag.FlagSet {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage of %s: %s\n", cmd.name, cmd.usage)
+		flags.PrintDefaults()
+	}
+	if cmd.request != nil {
+		defineFlags(flags, values, "", cmd.request.Elem(), map[reflect.Type]bool{})
+	}
+	flags.StringVar(output, "output", OutputJSON, "output format, "+OutputJSON+" or "+OutputTable)
+	return flags
+}
+
+// defineFlags defines the flags of struct fields, the fields are named like
+// the form binder, nested struct fields are keyed by `a.b` and the slice of
+// scalars is a repeatable flag, other slices and maps and the fields bound
+// by cookies only have no flags, the
+// struct already visited on the path has no flags so that the self-referential
+// types terminate
+func defineFlags(flags *flag.FlagSet, values url.Values, prefix string, t reflect.Type, visiting map[reflect.Type]bool) {
+	if visiting[t] {
+		return
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if _, ok := field.Tag.Lookup("file"); ok {
+			continue
+		}
+		tag, tagged := field.Tag.Lookup("form")
+		name := strings.Split(tag, ",")[0]
+		if name == "-" {
+			continue
+		}
+		if _, ok := field.Tag.Lookup("cookie"); ok && !tagged {
+			// bound by cookies only
+			continue
+		}
+		ft := field.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if field.Anonymous && !tagged && ft.Kind() == reflect.Struct {
+			defineFlags(flags, values, prefix, ft, visiting)
+			continue
+		}
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		key := prefix + name
+		usage := field.Tag.Get("usage")
+		switch {
+		case isScalar(ft):
+			if usage == "" {
+				usage = ft.String()
+			}
+			flags.Var(&formFlag{values: values, key: key, bool: ft.Kind() == reflect.Bool}, key, usage)
+		case ft.Kind() == reflect.Slice && isScalar(ft.Elem()):
+			if usage == "" {
+				usage = ft.String() + ", repeatable"
+			}
+			flags.Var(&formFlag{values: values, key: key, repeated: true}, key, usage)
+		case ft.Kind() == reflect.Struct:
+			defineFlags(flags, values, key+".", ft, visiting)
+		}
+	}
+}
+
+// isScalar reports whether the type is decoded from a single form value
+func isScalar(t reflect.Type) bool {
+	if t == timeType || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// formFlag stores the flag value in the form values, the values are converted
+// by fn.DecodeForm after parsing
+type formFlag struct {
+	values   url.Values
+	key      string
+	bool     bool
+	repeated bool
+}
+
+func (f *formFlag) String() string {
+	if f == nil || f.values == nil {
+		return ""
+	}
+	return strings.Join(f.values[f.key], ",")
+}
+
+func (f *formFlag) Set(v string) error {
+	if f.repeated {
+		f.values.Add(f.key, v)
+	} else {
+		f.values.Set(f.key, v)
+	}
+	return nil
+}
+
+func (f *formFlag) IsBoolFlag() bool {
+	return f.bool
+}
+
+// print writes the payload to stdout, nothing is written for a nil pointer
+func (a *App) print(output string, payload interface{}) error {
+	if v := reflect.ValueOf(payload); !v.IsValid() || v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
+	}
+	if output == OutputTable {
+		return printTable(a.stdout, payload)
+	}
+	body, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(a.stdout, "%s\n", body)
+	return err
+}
+
+// printError writes the error to stderr with its status code
+func (a *App) printError(output string, err error) {
+	code := http.StatusBadRequest
+	if v, ok := fn.UnwrapErrorStatusCode(err); ok {
+		code = v
+	}
+	if output == OutputTable {
+		fmt.Fprintf(a.stderr, "Error: %s (status %d)\n", err, code)
+		return
+	}
+	body, _ := json.MarshalIndent(&fn.ErrorEnvelope{Code: code, Message: err.Error()}, "", "  ")
+	fmt.Fprintf(a.stderr, "%s\n", body)
+}
+
+// printTable writes the json representation of payload as a table, an object
+// is printed as the key value rows, an array of objects as the rows of columns
+// and other values as lines
+func printTable(w io.Writer, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(body)))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedKeys(v) {
+			fmt.Fprintf(tw, "%s\t%s\n", strings.ToUpper(k), cell(v[k]))
+		}
+	case []interface{}:
+		columns := map[string]interface{}{}
+		for _, row := range v {
+			obj, ok := row.(map[string]interface{})
+			if !ok {
+				columns = nil
+				break
+			}
+			for k := range obj {
+				columns[k] = nil
+			}
+		}
+		if len(columns) == 0 {
+			for _, row := range v {
+				fmt.Fprintln(tw, cell(row))
+			}
+			break
+		}
+		keys := sortedKeys(columns)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(keys, "\t")))
+		for _, row := range v {
+			cells := make([]string, len(keys))
+			for i, k := range keys {
+				cells[i] = cell(row.(map[string]interface{})[k])
+			}
+			fmt.Fprintln(tw, strings.Join(cells, "\t"))
+		}
+	default:
+		fmt.Fprintln(tw, cell(v))
+	}
+	return tw.Flush()
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// cell formats a json value in a table cell, the nested values are compact json
+func cell(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return fmt.Sprint(v)
+	}
+	body, _ := json.Marshal(v)
+	return string(body)
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fncli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/fn"
+)
+
+func TestFncli(t *testing.T) {
+	TestingT(t)
+}
+
+type cliSuite struct{}
+
+var _ = Suite(&cliSuite{})
+
+type filter struct {
+	Role string `form:"role"`
+}
+
+type listRequest struct {
+	Page    int      `form:"page" usage:"page number"`
+	Tags    []string `form:"tag"`
+	Active  bool     `form:"active"`
+	Filter  filter   `form:"filter"`
+	Ignored string   `form:"-"`
+}
+
+type user struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+	Page int    `json:"page"`
+}
+
+func listUsers(ctx context.Context, req *listRequest) ([]user, error) {
+	if req.Page < 0 {
+		return nil, fn.ErrorWithStatusCode(errors.New("negative page"), http.StatusUnprocessableEntity)
+	}
+	var users []user
+	for _, tag := range req.Tags {
+		users = append(users, user{Name: tag, Role: req.Filter.Role, Page: req.Page})
+	}
+	if req.Active {
+		users = append(users, user{Name: "active"})
+	}
+	return users, nil
+}
+
+func newApp() (*App, *bytes.Buffer, *bytes.Buffer) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	app := New(Options{Name: "ops", Stdout: stdout, Stderr: stderr})
+	app.Command("list-users", "list the users", fn.New().Wrap(listUsers))
+	app.Command("version", "print the version", func() (string, error) { return "v1", nil })
+	return app, stdout, stderr
+}
+
+func (s *cliSuite) TestRunJSON(c *C) {
+	app, stdout, stderr := newApp()
+	code := app.Run(context.Background(), []string{"list-users", "-page", "2", "-tag", "a", "-tag", "b", "-filter.role", "admin"})
+	c.Assert(code, Equals, ExitOK, Commentf("%s", stderr))
+	c.Assert(stdout.String(), Equals, `[
+  {
+    "name": "a",
+    "role": "admin",
+    "page": 2
+  },
+  {
+    "name": "b",
+    "role": "admin",
+    "page": 2
+  }
+]
+`)
+
+	stdout.Reset()
+	c.Assert(app.Run(context.Background(), []string{"version"}), Equals, ExitOK)
+	c.Assert(stdout.String(), Equals, "\"v1\"\n")
+}
+
+func (s *cliSuite) TestRunTable(c *C) {
+	app, stdout, _ := newApp()
+	code := app.Run(context.Background(), []string{"list-users", "-tag", "a", "-active", "-output", "table"})
+	c.Assert(code, Equals, ExitOK)
+	c.Assert(stdout.String(), Equals, "NAME    PAGE  ROLE\na       0     \nactive  0     \n")
+}
+
+func (s *cliSuite) TestRunError(c *C) {
+	app, _, stderr := newApp()
+	code := app.Run(context.Background(), []string{"list-users", "-page", "-1"})
+	c.Assert(code, Equals, ExitError)
+	c.Assert(stderr.String(), Equals, "{\n  \"code\": 422,\n  \"message\": \"negative page\"\n}\n")
+
+	stderr.Reset()
+	code = app.Run(context.Background(), []string{"list-users", "-page", "-1", "-output", "table"})
+	c.Assert(code, Equals, ExitError)
+	c.Assert(stderr.String(), Equals, "Error: negative page (status 422)\n")
+}
+
+func (s *cliSuite) TestRunUsage(c *C) {
+	app, _, stderr := newApp()
+	c.Assert(app.Run(context.Background(), nil), Equals, ExitUsage)
+	c.Assert(stderr.String(), Matches, "(?s)Usage: ops <command>.*list-users  list the users.*version     print the version.*")
+
+	stderr.Reset()
+	c.Assert(app.Run(context.Background(), []string{"deploy"}), Equals, ExitUsage)
+	c.Assert(stderr.String(), Matches, "(?s)unknown command \"deploy\".*")
+
+	stderr.Reset()
+	c.Assert(app.Run(context.Background(), []string{"help", "list-users"}), Equals, ExitOK)
+	c.Assert(stderr.String(), Matches, "(?s).*-filter.role.*-page.*page number.*-tag.*repeatable.*")
+	c.Assert(stderr.String(), Not(Matches), "(?s).*Ignored.*")
+
+	stderr.Reset()
+	c.Assert(app.Run(context.Background(), []string{"list-users", "-page", "x"}), Equals, ExitUsage)
+	c.Assert(app.Run(context.Background(), []string{"list-users", "-unknown"}), Equals, ExitUsage)
+	c.Assert(app.Run(context.Background(), []string{"list-users", "-output", "yaml"}), Equals, ExitUsage)
+
+	c.Assert(func() { app.Command("version", "", func() (string, error) { return "", nil }) }, PanicMatches, ".*registered")
+}
+
+type treeNode struct {
+	Name   string    `form:"name"`
+	Parent *treeNode `form:"parent"`
+	Owner  struct {
+		Node *treeNode `form:"node"`
+		ID   int       `form:"id"`
+	} `form:"owner"`
+}
+
+func (s *cliSuite) TestRecursiveRequest(c *C) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	app := New(Options{Name: "ops", Stdout: stdout, Stderr: stderr})
+	app.Command("tree", "show the node", func(req *treeNode) (string, error) {
+		return req.Name, nil
+	})
+	c.Assert(app.Run(context.Background(), []string{"help", "tree"}), Equals, ExitOK)
+	c.Assert(stderr.String(), Matches, "(?s).*-name.*-owner.id.*")
+	c.Assert(stderr.String(), Not(Matches), "(?s).*-parent.*")
+
+	c.Assert(app.Run(context.Background(), []string{"tree", "-name", "root"}), Equals, ExitOK, Commentf("%s", stderr))
+	c.Assert(stdout.String(), Equals, "\"root\"\n")
+}
@@ -0,0 +1,362 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fnclient provides a typed client of the handlers served by fn, the
+// func fields of a client struct are bound to routes and mirror the handler
+// signatures
+//
+// e.g:
+//
+//	type UserClient struct {
+//	    Login   func(ctx context.Context, req *LoginRequest) (*LoginResponse, error) `route:"POST /login"`
+//	    Profile func(ctx context.Context) (*Profile, error)                         `route:"GET /profile"`
+//	}
+//
+//	client, err := fnclient.New(fnclient.Options{BaseURL: "http://localhost:8080"})
+//	var users UserClient
+//	client.Bind(&users, nil)
+//	resp, err := users.Login(ctx, &LoginRequest{Name: "fn"})
+package fnclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/pingcap/fn"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Options options of New
+type Options struct {
+	// BaseURL the URL which the route paths are resolved against
+	BaseURL string
+	// HTTPClient default is http.DefaultClient
+	HTTPClient *http.Client
+	// Header the headers sent with every request
+	Header http.Header
+}
+
+// Routes maps the func field names of client struct to routes such as
+// `POST /login`, it overrides the `route` tags of fields
+type Routes map[string]string
+
+// Client sends requests to the handlers served by fn
+type Client struct {
+	base   *url.URL
+	client *http.Client
+	header http.Header
+}
+
+// New returns a client of the server at opts.BaseURL
+func New(opts Options) (*Client, error) {
+	base, err := url.Parse(opts.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	return &Client{base: base, client: opts.HTTPClient, header: opts.Header}, nil
+}
+
+// Call sends req to the route and decodes the response payload into resp,
+// req is encoded by its tags like the server binds it, a multipart form if
+// any `file` field is set, the query of GET, HEAD and DELETE or an
+// urlencoded form if it has `form` fields, json otherwise, and the fields
+// tagged with `cookie` are sent as cookies, nil req sends no body, nil resp
+// drops the payload
+//
+// The error responded is returned as an error carrying the status code, the
+// code can be read by fn.UnwrapErrorStatusCode
+func (c *Client) Call(ctx context.Context, method, path string, req, resp interface{}) error {
+	r, err := c.newRequest(ctx, method, path, req)
+	if err != nil {
+		return err
+	}
+	res, err := c.client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return decodeError(res.StatusCode, body)
+	}
+	if resp == nil || res.StatusCode == http.StatusNoContent || len(body) == 0 {
+		return nil
+	}
+	return json.Unmarshal(body, resp)
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, req interface{}) (*http.Request, error) {
+	ref, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	u := c.base.ResolveReference(ref)
+	var body io.Reader
+	var contentType string
+	var cookies []*http.Cookie
+	if req != nil {
+		if body, contentType, err = encodeBody(method, u, req); err != nil {
+			return nil, err
+		}
+		if v := reflect.Indirect(reflect.ValueOf(req)); v.Kind() == reflect.Struct {
+			if cookies, err = fn.EncodeCookies(req); err != nil {
+				return nil, err
+			}
+		}
+	}
+	r, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.header {
+		r.Header[k] = append([]string(nil), v...)
+	}
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	r.Header.Set("Accept", "application/json")
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	return r.WithContext(ctx), nil
+}
+
+// encodeBody encodes req by the tags which the server binds, the form values
+// of GET, HEAD and DELETE requests override the same keys of the query of u
+func encodeBody(method string, u *url.URL, req interface{}) (io.Reader, string, error) {
+	if reflect.Indirect(reflect.ValueOf(req)).Kind() != reflect.Struct {
+		return encodeJSON(req)
+	}
+	files, err := fn.EncodeFiles(req)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(files) > 0 {
+		return encodeMultipart(req, files)
+	}
+	if !fn.HasFormTags(req) {
+		return encodeJSON(req)
+	}
+	values, err := fn.EncodeForm(req)
+	if err != nil {
+		return nil, "", err
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete:
+		query := u.Query()
+		for k, v := range values {
+			query[k] = v
+		}
+		u.RawQuery = query.Encode()
+		return nil, "", nil
+	}
+	return strings.NewReader(values.Encode()), "application/x-www-form-urlencoded", nil
+}
+
+func encodeJSON(req interface{}) (io.Reader, string, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, "", err
+	}
+	return bytes.NewReader(data), "application/json", nil
+}
+
+// encodeMultipart writes the form values and the files of req into a
+// multipart form
+func encodeMultipart(req interface{}, files map[string][]*multipart.FileHeader) (io.Reader, string, error) {
+	values, err := fn.EncodeForm(req)
+	if err != nil {
+		return nil, "", err
+	}
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for k, vs := range values {
+		for _, v := range vs {
+			if err := w.WriteField(k, v); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	for name, headers := range files {
+		for _, fh := range headers {
+			if err := writeFile(w, name, fh); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return &buf, w.FormDataContentType(), nil
+}
+
+func writeFile(w *multipart.Writer, name string, fh *multipart.FileHeader) error {
+	f, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, quoteEscaper.Replace(name), quoteEscaper.Replace(fh.Filename)))
+	contentType := fh.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	h.Set("Content-Type", contentType)
+	part, err := w.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, f)
+	return err
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// NewFileHeader returns a file of the content type to upload by the fields
+// tagged with `file`
+func NewFileHeader(filename, contentType string, data []byte) (*multipart.FileHeader, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, quoteEscaper.Replace(filename)))
+	h.Set("Content-Type", contentType)
+	part, err := w.CreatePart(h)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	form, err := multipart.NewReader(&buf, w.Boundary()).ReadForm(int64(len(data)) + 1)
+	if err != nil {
+		return nil, err
+	}
+	return form.File["file"][0], nil
+}
+
+// decodeError decodes the error encoded by the default error encoder or
+// fn.EnvelopeErrorEncoder
+func decodeError(status int, body []byte) error {
+	message := strings.TrimSpace(string(body))
+	var s string
+	var envelope fn.ErrorEnvelope
+	switch {
+	case json.Unmarshal(body, &s) == nil:
+		message = s
+	case json.Unmarshal(body, &envelope) == nil && envelope.Message != "":
+		message = envelope.Message
+	}
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	return fn.ErrorWithStatusCode(errors.New(message), status)
+}
+
+// Bind sets the func fields of the struct which dst points to, each field
+// is routed by routes or its `route` tag, the fields without route are
+// skipped. It panics if a routed field is not a func like
+// `func(ctx context.Context, req *Request) (*Response, error)`, the context
+// and request parameters are optional
+func (c *Client) Bind(dst interface{}, routes Routes) {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		panic("fnclient: bind destination should be a pointer to struct")
+	}
+	v = v.Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		route, ok := routes[field.Name]
+		if !ok {
+			route, ok = field.Tag.Lookup("route")
+		}
+		if !ok {
+			continue
+		}
+		parts := strings.Fields(route)
+		if len(parts) != 2 {
+			panic(fmt.Sprintf("fnclient: illegal route %q (%s.%s)", route, t, field.Name))
+		}
+		v.Field(i).Set(c.makeFunc(field.Type, parts[0], parts[1], t.String()+"."+field.Name))
+	}
+}
+
+func (c *Client) makeFunc(typ reflect.Type, method, path, name string) reflect.Value {
+	if typ.Kind() != reflect.Func || typ.NumOut() != 2 || typ.Out(1) != errorType || typ.NumIn() > 2 {
+		panic("fnclient: field should be func(ctx, *Request) (Response, error) (" + name + ")")
+	}
+	inContext := typ.NumIn() > 0 && typ.In(0) == contextType
+	numReq := typ.NumIn()
+	if inContext {
+		numReq--
+	}
+	if numReq > 1 {
+		panic("fnclient: field should accept only one request (" + name + ")")
+	}
+	respType := typ.Out(0)
+	return reflect.MakeFunc(typ, func(args []reflect.Value) []reflect.Value {
+		ctx := context.Background()
+		if inContext {
+			if v := args[0].Interface(); v != nil {
+				ctx = v.(context.Context)
+			}
+			args = args[1:]
+		}
+		var req interface{}
+		if len(args) > 0 && !isNil(args[0]) {
+			req = args[0].Interface()
+		}
+		resp := reflect.New(respType)
+		err := c.Call(ctx, method, path, req, resp.Interface())
+		errValue := reflect.Zero(errorType)
+		if err != nil {
+			errValue = reflect.ValueOf(&err).Elem()
+			return []reflect.Value{reflect.Zero(respType), errValue}
+		}
+		return []reflect.Value{resp.Elem(), errValue}
+	})
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
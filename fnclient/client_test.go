@@ -0,0 +1,209 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fnclient
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/fn"
+)
+
+func TestFnclient(t *testing.T) {
+	TestingT(t)
+}
+
+type clientSuite struct {
+	server *httptest.Server
+	client *Client
+}
+
+var _ = Suite(&clientSuite{})
+
+type loginRequest struct {
+	Name  string `json:"name"`
+	Theme string `json:"-" cookie:"theme"`
+}
+
+type loginResponse struct {
+	Greeting string `json:"greeting"`
+	Theme    string `json:"theme"`
+	Token    string `json:"token"`
+}
+
+type searchRequest struct {
+	Page  int      `form:"page"`
+	Tags  []string `form:"tags"`
+	Theme string   `cookie:"theme"`
+}
+
+type uploadRequest struct {
+	Title  string                `form:"title"`
+	Avatar *multipart.FileHeader `file:"avatar"`
+}
+
+type uploadResponse struct {
+	Title    string `json:"title"`
+	Filename string `json:"filename"`
+	Type     string `json:"type"`
+	Content  string `json:"content"`
+}
+
+type formClient struct {
+	Search func(ctx context.Context, req *searchRequest) (*searchRequest, error)  `route:"GET /search?page=1"`
+	Submit func(ctx context.Context, req *searchRequest) (*searchRequest, error)  `route:"POST /search"`
+	Upload func(ctx context.Context, req *uploadRequest) (*uploadResponse, error) `route:"POST /upload"`
+}
+
+type userClient struct {
+	Login   func(ctx context.Context, req *loginRequest) (*loginResponse, error) `route:"POST /login"`
+	Logout  func(ctx context.Context) (*loginResponse, error)                    `route:"POST /logout"`
+	Version func() (string, error)
+	Ignored func()
+}
+
+func (s *clientSuite) SetUpSuite(c *C) {
+	group := fn.NewGroup()
+	mux := http.NewServeMux()
+	mux.Handle("/login", group.Wrap(func(header http.Header, req *loginRequest) (*loginResponse, error) {
+		if req.Name == "" {
+			return nil, fn.ErrorWithStatusCode(errors.New("name required"), http.StatusUnprocessableEntity)
+		}
+		return &loginResponse{Greeting: "hello " + req.Name, Theme: req.Theme, Token: header.Get("X-Token")}, nil
+	}))
+	mux.Handle("/logout", group.Wrap(func() (*loginResponse, error) {
+		return nil, nil
+	}))
+	mux.Handle("/version", group.Wrap(func() (string, error) {
+		return "v1", nil
+	}))
+	mux.Handle("/search", group.Wrap(func(r *http.Request, req *searchRequest) (*searchRequest, error) {
+		if r.Method == http.MethodGet && r.ContentLength > 0 {
+			return nil, fn.ErrorWithStatusCode(errors.New("unexpected body"), http.StatusBadRequest)
+		}
+		return req, nil
+	}))
+	mux.Handle("/upload", group.Wrap(func(req *uploadRequest) (*uploadResponse, error) {
+		if req.Avatar == nil {
+			return nil, fn.ErrorWithStatusCode(errors.New("avatar required"), http.StatusBadRequest)
+		}
+		f, err := req.Avatar.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+		return &uploadResponse{
+			Title:    req.Title,
+			Filename: req.Avatar.Filename,
+			Type:     req.Avatar.Header.Get("Content-Type"),
+			Content:  string(data),
+		}, nil
+	}))
+	envelope := fn.NewGroup()
+	envelope.SetErrorEncoder(fn.EnvelopeErrorEncoder)
+	mux.Handle("/forbidden", envelope.Wrap(func() (string, error) {
+		return "", fn.ErrorWithStatusCode(errors.New("no access"), http.StatusForbidden)
+	}))
+	s.server = httptest.NewServer(mux)
+
+	var err error
+	s.client, err = New(Options{BaseURL: s.server.URL, Header: http.Header{"X-Token": {"secret"}}})
+	c.Assert(err, IsNil)
+}
+
+func (s *clientSuite) TearDownSuite(c *C) {
+	s.server.Close()
+}
+
+func (s *clientSuite) TestBind(c *C) {
+	var users userClient
+	s.client.Bind(&users, Routes{"Version": "GET /version"})
+	c.Assert(users.Ignored, IsNil)
+
+	resp, err := users.Login(context.Background(), &loginRequest{Name: "fn", Theme: "dark"})
+	c.Assert(err, IsNil)
+	c.Assert(resp, DeepEquals, &loginResponse{Greeting: "hello fn", Theme: "dark", Token: "secret"})
+
+	_, err = users.Login(context.Background(), &loginRequest{})
+	c.Assert(err, ErrorMatches, "name required")
+	code, ok := fn.UnwrapErrorStatusCode(err)
+	c.Assert(ok, IsTrue)
+	c.Assert(code, Equals, http.StatusUnprocessableEntity)
+
+	resp, err = users.Logout(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(resp, IsNil)
+
+	version, err := users.Version()
+	c.Assert(err, IsNil)
+	c.Assert(version, Equals, "v1")
+}
+
+func (s *clientSuite) TestEnvelope(c *C) {
+	err := s.client.Call(context.Background(), http.MethodGet, "/forbidden", nil, nil)
+	c.Assert(err, ErrorMatches, "no access")
+	code, _ := fn.UnwrapErrorStatusCode(err)
+	c.Assert(code, Equals, http.StatusForbidden)
+
+	err = s.client.Call(context.Background(), http.MethodGet, "/missing", nil, nil)
+	code, _ = fn.UnwrapErrorStatusCode(err)
+	c.Assert(code, Equals, http.StatusNotFound)
+}
+
+func (s *clientSuite) TestIllegalBind(c *C) {
+	c.Assert(func() {
+		s.client.Bind(&struct {
+			Login func(*loginRequest) error `route:"POST /login"`
+		}{}, nil)
+	}, PanicMatches, "fnclient: field should be .*")
+	c.Assert(func() {
+		s.client.Bind(&struct {
+			Login func(*loginRequest) (string, error) `route:"/login"`
+		}{}, nil)
+	}, PanicMatches, "fnclient: illegal route .*")
+	c.Assert(func() { s.client.Bind(userClient{}, nil) }, PanicMatches, "fnclient: bind destination .*")
+}
+
+func (s *clientSuite) TestForm(c *C) {
+	var forms formClient
+	s.client.Bind(&forms, nil)
+
+	req := &searchRequest{Page: 2, Tags: []string{"a", "b"}, Theme: "dark"}
+	resp, err := forms.Search(context.Background(), req)
+	c.Assert(err, IsNil)
+	c.Assert(resp, DeepEquals, req)
+
+	resp, err = forms.Submit(context.Background(), req)
+	c.Assert(err, IsNil)
+	c.Assert(resp, DeepEquals, req)
+
+	avatar, err := NewFileHeader("avatar.png", "image/png", []byte("png"))
+	c.Assert(err, IsNil)
+	upload, err := forms.Upload(context.Background(), &uploadRequest{Title: "me", Avatar: avatar})
+	c.Assert(err, IsNil)
+	c.Assert(upload, DeepEquals, &uploadResponse{Title: "me", Filename: "avatar.png", Type: "image/png", Content: "png"})
+
+	_, err = forms.Upload(context.Background(), &uploadRequest{Title: "me"})
+	c.Assert(err, ErrorMatches, "avatar required")
+}
@@ -0,0 +1,335 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fntest provides a fluent client to test the handlers wrapped by fn
+// without a server
+//
+// e.g:
+//
+//	var resp LoginResponse
+//	fntest.New(handler).
+//	    POST("/login").
+//	    JSON(&LoginRequest{Name: "fn"}).
+//	    Expect(t).
+//	    Status(http.StatusOK).
+//	    JSON(&resp)
+package fntest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pingcap/fn"
+)
+
+var update = flag.Bool("fntest.update", false, "update the golden files of fntest")
+
+// Client sends requests to a handler, the headers and cookies of client are
+// sent with every request
+type Client struct {
+	handler http.Handler
+	header  http.Header
+	cookies []*http.Cookie
+}
+
+// New returns a client of handler
+func New(handler http.Handler) *Client {
+	return &Client{handler: handler, header: http.Header{}}
+}
+
+// Header set a header sent with every request
+func (c *Client) Header(key, value string) *Client {
+	c.header.Set(key, value)
+	return c
+}
+
+// Cookie add a cookie sent with every request
+func (c *Client) Cookie(cookie *http.Cookie) *Client {
+	c.cookies = append(c.cookies, cookie)
+	return c
+}
+
+// Request starts a request to path
+func (c *Client) Request(method, path string) *Request {
+	header := http.Header{}
+	for k, v := range c.header {
+		header[k] = append([]string(nil), v...)
+	}
+	return &Request{
+		client:  c,
+		method:  method,
+		path:    path,
+		header:  header,
+		cookies: append([]*http.Cookie(nil), c.cookies...),
+		query:   url.Values{},
+		ctx:     context.Background(),
+	}
+}
+
+// GET starts a GET request
+func (c *Client) GET(path string) *Request { return c.Request(http.MethodGet, path) }
+
+// POST starts a POST request
+func (c *Client) POST(path string) *Request { return c.Request(http.MethodPost, path) }
+
+// PUT starts a PUT request
+func (c *Client) PUT(path string) *Request { return c.Request(http.MethodPut, path) }
+
+// PATCH starts a PATCH request
+func (c *Client) PATCH(path string) *Request { return c.Request(http.MethodPatch, path) }
+
+// DELETE starts a DELETE request
+func (c *Client) DELETE(path string) *Request { return c.Request(http.MethodDelete, path) }
+
+// Request a request being built
+type Request struct {
+	client  *Client
+	method  string
+	path    string
+	header  http.Header
+	cookies []*http.Cookie
+	query   url.Values
+	body    []byte
+	err     error
+	ctx     context.Context
+}
+
+// Header set a request header
+func (r *Request) Header(key, value string) *Request {
+	r.header.Set(key, value)
+	return r
+}
+
+// Cookie add a request cookie
+func (r *Request) Cookie(cookie *http.Cookie) *Request {
+	r.cookies = append(r.cookies, cookie)
+	return r
+}
+
+// Query add a query parameter
+func (r *Request) Query(key, value string) *Request {
+	r.query.Add(key, value)
+	return r
+}
+
+// WithContext set the context of request
+func (r *Request) WithContext(ctx context.Context) *Request {
+	r.ctx = ctx
+	return r
+}
+
+// Body set the request body and its content type
+func (r *Request) Body(contentType string, body []byte) *Request {
+	r.header.Set("Content-Type", contentType)
+	r.body = body
+	return r
+}
+
+// JSON set the request body to the json encoding of v
+func (r *Request) JSON(v interface{}) *Request {
+	body, err := json.Marshal(v)
+	if err != nil {
+		r.err = err
+	}
+	return r.Body("application/json", body)
+}
+
+// Form set the request body to the urlencoded form
+func (r *Request) Form(values url.Values) *Request {
+	return r.Body("application/x-www-form-urlencoded", []byte(values.Encode()))
+}
+
+// Build returns the http.Request
+func (r *Request) Build() (*http.Request, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	var body io.Reader
+	if r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
+	req := httptest.NewRequest(r.method, r.path, body)
+	if len(r.query) > 0 {
+		query := req.URL.Query()
+		for k, v := range r.query {
+			query[k] = append(query[k], v...)
+		}
+		req.URL.RawQuery = query.Encode()
+	}
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+	for _, cookie := range r.cookies {
+		req.AddCookie(cookie)
+	}
+	return req.WithContext(r.ctx), nil
+}
+
+// Do sends the request to the handler and returns the recorded response
+func (r *Request) Do() (*httptest.ResponseRecorder, error) {
+	req, err := r.Build()
+	if err != nil {
+		return nil, err
+	}
+	recorder := httptest.NewRecorder()
+	r.client.handler.ServeHTTP(recorder, req)
+	return recorder, nil
+}
+
+// Expect sends the request and returns the response asserted by t
+func (r *Request) Expect(t testing.TB) *Response {
+	t.Helper()
+	recorder, err := r.Do()
+	if err != nil {
+		t.Fatalf("fntest: build request %s %s: %v", r.method, r.path, err)
+		return nil
+	}
+	return &Response{t: t, Recorder: recorder, name: r.method + " " + r.path}
+}
+
+// Response the recorded response, the assertions report failures to t and
+// return the response for chaining
+type Response struct {
+	t        testing.TB
+	name     string
+	Recorder *httptest.ResponseRecorder
+}
+
+// Status asserts the status code
+func (r *Response) Status(code int) *Response {
+	r.t.Helper()
+	if r.Recorder.Code != code {
+		r.t.Errorf("fntest: %s: status %d, want %d, body: %s", r.name, r.Recorder.Code, code, r.Recorder.Body)
+	}
+	return r
+}
+
+// Header asserts a response header
+func (r *Response) Header(key, value string) *Response {
+	r.t.Helper()
+	if got := r.Recorder.Header().Get(key); got != value {
+		r.t.Errorf("fntest: %s: header %s %q, want %q", r.name, key, got, value)
+	}
+	return r
+}
+
+// Cookie returns the response cookie of name, nil if not set
+func (r *Response) Cookie(name string) *http.Cookie {
+	for _, cookie := range r.Recorder.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// HasCookie asserts the response sets the cookie of name to value
+func (r *Response) HasCookie(name, value string) *Response {
+	r.t.Helper()
+	cookie := r.Cookie(name)
+	switch {
+	case cookie == nil:
+		r.t.Errorf("fntest: %s: cookie %s not set", r.name, name)
+	case cookie.Value != value:
+		r.t.Errorf("fntest: %s: cookie %s %q, want %q", r.name, name, cookie.Value, value)
+	}
+	return r
+}
+
+// Body asserts the response body
+func (r *Response) Body(body string) *Response {
+	r.t.Helper()
+	if got := r.Recorder.Body.String(); got != body {
+		r.t.Errorf("fntest: %s: body %q, want %q", r.name, got, body)
+	}
+	return r
+}
+
+// JSON decode the response body to v
+func (r *Response) JSON(v interface{}) *Response {
+	r.t.Helper()
+	if err := json.Unmarshal(r.Recorder.Body.Bytes(), v); err != nil {
+		r.t.Fatalf("fntest: %s: decode body %q: %v", r.name, r.Recorder.Body, err)
+	}
+	return r
+}
+
+// Error asserts the error message encoded by the default error encoder
+func (r *Response) Error(message string) *Response {
+	r.t.Helper()
+	var got string
+	r.JSON(&got)
+	if got != message {
+		r.t.Errorf("fntest: %s: error %q, want %q", r.name, got, message)
+	}
+	return r
+}
+
+// Envelope asserts the error encoded by fn.EnvelopeErrorEncoder, the
+// envelope code should equal to the status code
+func (r *Response) Envelope(code int, message string) *Response {
+	r.t.Helper()
+	var envelope fn.ErrorEnvelope
+	r.Status(code).JSON(&envelope)
+	if envelope.Code != code || envelope.Message != message {
+		r.t.Errorf("fntest: %s: envelope (%d, %q), want (%d, %q)", r.name, envelope.Code, envelope.Message, code, message)
+	}
+	if id := r.Recorder.Header().Get("X-Request-ID"); id != "" && envelope.RequestID != id {
+		r.t.Errorf("fntest: %s: envelope request ID %q, want %q", r.name, envelope.RequestID, id)
+	}
+	return r
+}
+
+// Golden compares the response body with the golden file, json bodies are
+// indented before comparing, the file is rewritten if the test runs with
+// `-fntest.update`
+func (r *Response) Golden(path string) *Response {
+	r.t.Helper()
+	body := r.Recorder.Body.Bytes()
+	if strings.HasPrefix(r.Recorder.Header().Get("Content-Type"), "application/json") {
+		indented := &bytes.Buffer{}
+		if err := json.Indent(indented, body, "", "  "); err == nil {
+			body = indented.Bytes()
+		}
+	}
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			r.t.Fatalf("fntest: %s: update golden file: %v", r.name, err)
+			return r
+		}
+		if err := ioutil.WriteFile(path, body, 0644); err != nil {
+			r.t.Fatalf("fntest: %s: update golden file: %v", r.name, err)
+		}
+		return r
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		r.t.Fatalf("fntest: %s: read golden file: %v", r.name, err)
+		return r
+	}
+	if !bytes.Equal(body, want) {
+		r.t.Errorf("fntest: %s: body does not match %s\ngot:\n%s\nwant:\n%s", r.name, path, body, want)
+	}
+	return r
+}
@@ -0,0 +1,158 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fntest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/fn"
+)
+
+func TestFntest(t *testing.T) {
+	TestingT(t)
+}
+
+type fntestSuite struct{}
+
+var _ = Suite(&fntestSuite{})
+
+// recordT records the failures instead of failing the test
+type recordT struct {
+	testing.TB
+	errors []string
+	fatal  bool
+}
+
+func (t *recordT) Helper() {}
+
+func (t *recordT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (t *recordT) Fatalf(format string, args ...interface{}) {
+	t.Errorf(format, args...)
+	t.fatal = true
+}
+
+type loginRequest struct {
+	Name string `json:"name"`
+}
+
+type loginResponse struct {
+	Greeting string `json:"greeting"`
+	Token    string `json:"token"`
+}
+
+func login(ctx context.Context, form fn.Form, header http.Header, cookies fn.Cookies, req *loginRequest) (*loginResponse, error) {
+	if req.Name == "" {
+		return nil, fn.ErrorWithStatusCode(errors.New("name required"), http.StatusUnprocessableEntity)
+	}
+	token := ""
+	if c, ok := cookies.Cookie("token"); ok {
+		token = c.Value
+	}
+	fn.ResponseHeader(ctx).Set("X-Lang", form.Get("lang")+header.Get("X-Region"))
+	return &loginResponse{Greeting: "hello " + req.Name, Token: token}, nil
+}
+
+func (s *fntestSuite) TestFluent(c *C) {
+	t := &recordT{}
+	client := New(fn.NewGroup().Wrap(login)).
+		Header("X-Region", "-cn").
+		Cookie(&http.Cookie{Name: "token", Value: "secret"})
+
+	var resp loginResponse
+	client.POST("/login").
+		Query("lang", "zh").
+		JSON(&loginRequest{Name: "fn"}).
+		Expect(t).
+		Status(http.StatusOK).
+		Header("X-Lang", "zh-cn").
+		JSON(&resp)
+	c.Assert(t.errors, HasLen, 0)
+	c.Assert(resp, Equals, loginResponse{Greeting: "hello fn", Token: "secret"})
+
+	client.POST("/login").JSON(&loginRequest{}).Expect(t).
+		Status(http.StatusUnprocessableEntity).
+		Error("name required")
+	c.Assert(t.errors, HasLen, 0)
+
+	client.POST("/login").JSON(&loginRequest{}).Expect(t).
+		Status(http.StatusOK).
+		Error("wrong")
+	c.Assert(t.errors, HasLen, 2)
+	c.Assert(t.errors[0], Matches, "(?s)fntest: POST /login: status 422, want 200.*")
+	c.Assert(t.errors[1], Equals, `fntest: POST /login: error "name required", want "wrong"`)
+}
+
+func (s *fntestSuite) TestForm(c *C) {
+	t := &recordT{}
+	handler := fn.Wrap(func(form *fn.PostForm) (string, error) {
+		return form.Get("name"), nil
+	})
+	New(handler).POST("/").Form(url.Values{"name": {"fn"}}).Expect(t).Body("\"fn\"\n")
+	c.Assert(t.errors, HasLen, 0)
+}
+
+func (s *fntestSuite) TestCookie(c *C) {
+	t := &recordT{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+	})
+	resp := New(handler).GET("/").Expect(t).HasCookie("session", "abc").HasCookie("missing", "")
+	c.Assert(resp.Cookie("session").Value, Equals, "abc")
+	c.Assert(t.errors, DeepEquals, []string{"fntest: GET /: cookie missing not set"})
+}
+
+func (s *fntestSuite) TestEnvelope(c *C) {
+	t := &recordT{}
+	group := fn.NewGroup()
+	group.SetErrorEncoder(fn.EnvelopeErrorEncoder)
+	group.Plugin(fn.RequestIDPlugin(fn.RequestIDOptions{}))
+	handler := group.Wrap(func() (string, error) {
+		return "", fn.ErrorWithStatusCode(errors.New("not found"), http.StatusNotFound)
+	})
+	New(handler).GET("/").Expect(t).Envelope(http.StatusNotFound, "not found")
+	c.Assert(t.errors, HasLen, 0)
+
+	New(handler).GET("/").Expect(t).Envelope(http.StatusNotFound, "gone")
+	c.Assert(t.errors, DeepEquals, []string{`fntest: GET /: envelope (404, "not found"), want (404, "gone")`})
+}
+
+func (s *fntestSuite) TestGolden(c *C) {
+	t := &recordT{}
+	handler := fn.NewGroup().Wrap(login)
+	New(handler).POST("/").JSON(&loginRequest{Name: "fn"}).Expect(t).Golden("testdata/login.golden")
+	c.Assert(t.errors, HasLen, 0)
+
+	New(handler).POST("/").JSON(&loginRequest{Name: "go"}).Expect(t).Golden("testdata/login.golden")
+	c.Assert(t.errors, HasLen, 1)
+	c.Assert(t.errors[0], Matches, "(?s)fntest: POST /: body does not match testdata/login.golden.*")
+
+	New(handler).GET("/").Expect(t).Golden("testdata/missing.golden")
+	c.Assert(t.fatal, IsTrue)
+}
+
+func (s *fntestSuite) TestBuildError(c *C) {
+	t := &recordT{}
+	resp := New(fn.Wrap(login)).POST("/").JSON(make(chan int)).Expect(t)
+	c.Assert(resp, IsNil)
+	c.Assert(t.fatal, IsTrue)
+}
@@ -0,0 +1,492 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+	errFormDst = errors.New("form decode destination should be a non-nil pointer to struct")
+	errFormSrc = errors.New("form encode source should be a struct or a pointer to struct")
+)
+
+// defaultMaxFormSliceLen the default max length of slice decoded from the
+// `key[n]` fields
+const defaultMaxFormSliceLen = 1000
+
+// formCodecField represents a struct field mapped by the `form` tag
+//
+// e.g:
+//
+//	type Query struct {
+//	    Page    int      `form:"page"`
+//	    Tags    []string `form:"tags,omitempty"`
+//	    Filter  Filter   `form:"filter"`  // filter.name=foo
+//	    Orders  []Order  `form:"orders"`  // orders[0].field=id
+//	    Pagination          // embedded fields are flattened
+//	}
+type formCodecField struct {
+	index     []int
+	name      string
+	omitEmpty bool
+	embedded  bool
+}
+
+var formCodecFieldsCache sync.Map // map[reflect.Type][]formCodecField
+
+func structFormFields(t reflect.Type) []formCodecField {
+	if v, ok := formCodecFieldsCache.Load(t); ok {
+		return v.([]formCodecField)
+	}
+	var fields []formCodecField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if _, ok := field.Tag.Lookup("file"); ok {
+			continue
+		}
+		tag, tagged := field.Tag.Lookup("form")
+		parts := strings.Split(tag, ",")
+		if parts[0] == "-" {
+			continue
+		}
+		if _, ok := field.Tag.Lookup("cookie"); ok && !tagged {
+			// bound by cookies only, the form can not spoof them
+			continue
+		}
+		ft := field.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if field.Anonymous && !tagged && ft.Kind() == reflect.Struct {
+			fields = append(fields, formCodecField{index: field.Index, embedded: true})
+			continue
+		}
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+		f := formCodecField{index: field.Index, name: parts[0]}
+		if f.name == "" {
+			f.name = field.Name
+		}
+		for _, opt := range parts[1:] {
+			if opt == "omitempty" {
+				f.omitEmpty = true
+			}
+		}
+		fields = append(fields, f)
+	}
+	v, _ := formCodecFieldsCache.LoadOrStore(t, fields)
+	return v.([]formCodecField)
+}
+
+// hasFormTags reports whether the struct or its embedded structs have the
+// fields tagged with `form`
+func hasFormTags(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if tag, ok := field.Tag.Lookup("form"); ok && tag != "-" {
+			return true
+		}
+		ft := field.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if field.Anonymous && ft != t && hasFormTags(ft) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasFormTags reports whether the struct which src is or points to has the
+// fields tagged with `form`, such requests are bound from the form or query
+func HasFormTags(src interface{}) bool {
+	t := reflect.TypeOf(src)
+	if t == nil {
+		return false
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return hasFormTags(t)
+}
+
+// Decode decodes the form values into the struct which dst points to
+func (f *Form) Decode(dst interface{}) error {
+	return f.decode(dst)
+}
+
+// Decode decodes the post form values into the struct which dst points to
+func (f *PostForm) Decode(dst interface{}) error {
+	return f.decode(dst)
+}
+
+// decode decodes the values into the struct which dst points to, the slice
+// index is limited by the container which bound the form
+func (u *uniform) decode(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errFormDst
+	}
+	maxSliceLen := u.maxSliceLen
+	if maxSliceLen <= 0 {
+		maxSliceLen = defaultMaxFormSliceLen
+	}
+	return decodeForm(u.Values, v, maxSliceLen)
+}
+
+// DecodeForm decodes values into the struct which dst points to, fields are
+// mapped by the `form` tag, nested struct fields are keyed by `a.b` and
+// slice elements by `a[0]`, the slice index is limited by the default of
+// Container.SetMaxFormSliceLen
+func DecodeForm(values url.Values, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errFormDst
+	}
+	return decodeForm(values, v, defaultMaxFormSliceLen)
+}
+
+func decodeForm(values url.Values, dst reflect.Value, maxSliceLen int) error {
+	if dst.Elem().Kind() != reflect.Struct {
+		return errFormDst
+	}
+	return newFormDecoder(values, maxSliceLen).decodeStruct("", dst.Elem())
+}
+
+// formDecoder decodes the form values into structs, the keys are indexed once
+// per decode so that the fields are not matched against every key
+type formDecoder struct {
+	values url.Values
+	// nested the keys followed by `.` or `[` in some form keys
+	nested map[string]bool
+	// indexes the max index of the keys followed by `[n]`
+	indexes     map[string]int
+	maxSliceLen int
+}
+
+func newFormDecoder(values url.Values, maxSliceLen int) *formDecoder {
+	d := &formDecoder{
+		values:      values,
+		nested:      map[string]bool{},
+		indexes:     map[string]int{},
+		maxSliceLen: maxSliceLen,
+	}
+	for k := range values {
+		for i := 0; i < len(k); i++ {
+			switch k[i] {
+			case '.':
+				d.nested[k[:i]] = true
+			case '[':
+				d.nested[k[:i]] = true
+				end := strings.IndexByte(k[i+1:], ']')
+				if end < 0 {
+					continue
+				}
+				n, err := strconv.Atoi(k[i+1 : i+1+end])
+				if err != nil || n < 0 {
+					continue
+				}
+				if max, ok := d.indexes[k[:i]]; !ok || n > max {
+					d.indexes[k[:i]] = n
+				}
+			}
+		}
+	}
+	return d
+}
+
+func (d *formDecoder) decodeStruct(prefix string, v reflect.Value) error {
+	for _, f := range structFormFields(v.Type()) {
+		fv := v.FieldByIndex(f.index)
+		if f.embedded {
+			if fv.Kind() == reflect.Ptr {
+				if !d.hasPrefix(prefix) {
+					continue
+				}
+				if fv.IsNil() {
+					if !fv.CanSet() {
+						continue
+					}
+					fv.Set(reflect.New(fv.Type().Elem()))
+				}
+				fv = fv.Elem()
+			}
+			if err := d.decodeStruct(prefix, fv); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.decodeValue(prefix+f.name, fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isFormScalar(t reflect.Type) bool {
+	if t == timeType || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// hasPrefix reports whether any key belongs to the nested prefix which ends
+// with `.`
+func (d *formDecoder) hasPrefix(prefix string) bool {
+	if prefix == "" {
+		return len(d.values) > 0
+	}
+	return d.nested[strings.TrimSuffix(prefix, ".")]
+}
+
+// has reports whether any key is key or nested in key
+func (d *formDecoder) has(key string) bool {
+	return len(d.values[key]) > 0 || d.nested[key]
+}
+
+// sliceLen returns the count of elements keyed by `key[n]`, the index not
+// less than the max slice length is reported as a bad request
+func (d *formDecoder) sliceLen(key string) (int, error) {
+	max, ok := d.indexes[key]
+	if !ok {
+		return 0, nil
+	}
+	if max >= d.maxSliceLen {
+		err := fmt.Errorf("index %d exceeds the limit %d", max, d.maxSliceLen)
+		return 0, ErrorWithStatusCode(&FieldError{Field: key + "[" + strconv.Itoa(max) + "]", Err: err}, http.StatusBadRequest)
+	}
+	return max + 1, nil
+}
+
+func (d *formDecoder) decodeValue(key string, v reflect.Value) error {
+	t := v.Type()
+	switch {
+	case isFormScalar(t):
+		vals := d.values[key]
+		if len(vals) == 0 {
+			return nil
+		}
+		return setFormScalar(key, v, vals[0])
+	case t.Kind() == reflect.Ptr:
+		if isFormScalar(t.Elem()) {
+			if len(d.values[key]) == 0 {
+				return nil
+			}
+		} else if !d.has(key) {
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return d.decodeValue(key, v.Elem())
+	case t.Kind() == reflect.Struct:
+		return d.decodeStruct(key+".", v)
+	case t.Kind() == reflect.Slice:
+		if vals := d.values[key]; len(vals) > 0 && isFormScalar(t.Elem()) {
+			s := reflect.MakeSlice(t, len(vals), len(vals))
+			for i, val := range vals {
+				if err := setFormScalar(key, s.Index(i), val); err != nil {
+					return err
+				}
+			}
+			v.Set(s)
+			return nil
+		}
+		n, err := d.sliceLen(key)
+		if err != nil || n == 0 {
+			return err
+		}
+		s := reflect.MakeSlice(t, n, n)
+		for i := 0; i < n; i++ {
+			if err := d.decodeValue(key+"["+strconv.Itoa(i)+"]", s.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+	return nil
+}
+
+func setFormScalar(key string, v reflect.Value, s string) error {
+	if err := setFieldString(v, s); err != nil {
+		return ErrorWithStatusCode(&FieldError{Field: key, Err: err}, http.StatusBadRequest)
+	}
+	return nil
+}
+
+func setFieldString(v reflect.Value, s string) error {
+	if v.CanAddr() {
+		if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return u.UnmarshalText([]byte(s))
+		}
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
+
+// EncodeForm encodes the struct src into url.Values, the reverse of DecodeForm
+func EncodeForm(src interface{}) (url.Values, error) {
+	v := reflect.ValueOf(src)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, errFormSrc
+	}
+	values := url.Values{}
+	if err := encodeFormStruct(values, "", v); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func encodeFormStruct(values url.Values, prefix string, v reflect.Value) error {
+	for _, f := range structFormFields(v.Type()) {
+		fv := v.FieldByIndex(f.index)
+		if f.embedded {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if err := encodeFormStruct(values, prefix, fv); err != nil {
+				return err
+			}
+			continue
+		}
+		if f.omitEmpty && isEmptyFormValue(fv) {
+			continue
+		}
+		if err := encodeFormValue(values, prefix+f.name, fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isEmptyFormValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+func encodeFormValue(values url.Values, key string, v reflect.Value) error {
+	t := v.Type()
+	switch {
+	case t.Implements(textMarshalerType) && (t.Kind() != reflect.Ptr || !v.IsNil()):
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return &FieldError{Field: key, Err: err}
+		}
+		values.Add(key, string(b))
+	case t == durationType:
+		values.Add(key, time.Duration(v.Int()).String())
+	case isFormScalar(t):
+		values.Add(key, fmt.Sprint(v.Interface()))
+	case t.Kind() == reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return encodeFormValue(values, key, v.Elem())
+	case t.Kind() == reflect.Struct:
+		return encodeFormStruct(values, key+".", v)
+	case t.Kind() == reflect.Slice:
+		if isFormScalar(t.Elem()) {
+			for i := 0; i < v.Len(); i++ {
+				if err := encodeFormValue(values, key, v.Index(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeFormValue(values, key+"["+strconv.Itoa(i)+"]", v.Index(i)); err != nil {
+				return err
+			}
+		}
+	default:
+		return &FieldError{Field: key, Err: fmt.Errorf("unsupported field type %s", t)}
+	}
+	return nil
+}
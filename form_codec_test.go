@@ -0,0 +1,239 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+type formCodecSuite struct{}
+
+var _ = Suite(&formCodecSuite{})
+
+type testPagination struct {
+	Page int `form:"page"`
+	Size int `form:"size,omitempty"`
+}
+
+type testFilter struct {
+	Name  string    `form:"name"`
+	Since time.Time `form:"since,omitempty"`
+}
+
+type testOrder struct {
+	Field string `form:"field"`
+	Desc  bool   `form:"desc"`
+}
+
+type testQuery struct {
+	testPagination
+	Keyword string        `form:"q"`
+	Tags    []string      `form:"tags"`
+	IDs     []int64       `form:"ids"`
+	Filter  testFilter    `form:"filter"`
+	Parent  *testFilter   `form:"parent"`
+	Orders  []testOrder   `form:"orders"`
+	Timeout time.Duration `form:"timeout"`
+	Limit   *int          `form:"limit"`
+	Ignored string        `form:"-"`
+}
+
+func (s *formCodecSuite) TestDecode(c *C) {
+	values, err := url.ParseQuery("page=2&q=fn&tags=a&tags=b&ids[0]=1&ids[1]=2" +
+		"&filter.name=foo&filter.since=2020-01-02T00:00:00Z&orders[1].field=id&orders[1].desc=true" +
+		"&orders[0].field=name&timeout=3s&limit=10&Ignored=x")
+	c.Assert(err, IsNil)
+
+	var q testQuery
+	form := &Form{uniform{Values: values}}
+	c.Assert(form.Decode(&q), IsNil)
+	c.Assert(q.Page, Equals, 2)
+	c.Assert(q.Keyword, Equals, "fn")
+	c.Assert(q.Tags, DeepEquals, []string{"a", "b"})
+	c.Assert(q.IDs, DeepEquals, []int64{1, 2})
+	c.Assert(q.Filter.Name, Equals, "foo")
+	c.Assert(q.Filter.Since.Year(), Equals, 2020)
+	c.Assert(q.Parent, IsNil)
+	c.Assert(q.Orders, DeepEquals, []testOrder{{Field: "name"}, {Field: "id", Desc: true}})
+	c.Assert(q.Timeout, Equals, 3*time.Second)
+	c.Assert(*q.Limit, Equals, 10)
+	c.Assert(q.Ignored, Equals, "")
+}
+
+func (s *formCodecSuite) TestDecodeError(c *C) {
+	var q testQuery
+	err := DecodeForm(url.Values{"orders[0].desc": {"maybe"}}, &q)
+	c.Assert(err, ErrorMatches, "orders\\[0\\].desc: .*invalid syntax")
+	code, _ := UnwrapErrorStatusCode(err)
+	c.Assert(code, Equals, http.StatusBadRequest)
+
+	c.Assert(DecodeForm(url.Values{}, q), Equals, errFormDst)
+
+	// the slice index is capped before allocating
+	err = DecodeForm(url.Values{"orders[2000000000].field": {"id"}}, &q)
+	c.Assert(err, ErrorMatches, "orders\\[2000000000\\]: index 2000000000 exceeds the limit 1000")
+	code, _ = UnwrapErrorStatusCode(err)
+	c.Assert(code, Equals, http.StatusBadRequest)
+	c.Assert(q.Orders, IsNil)
+	c.Assert(DecodeForm(url.Values{"orders[999].field": {"id"}}, &q), IsNil)
+	c.Assert(q.Orders, HasLen, 1000)
+}
+
+func (s *formCodecSuite) TestNestedPrefix(c *C) {
+	// the key only sharing the prefix does not allocate the pointer
+	var q testQuery
+	c.Assert(DecodeForm(url.Values{"parentX": {"1"}, "parent_name": {"foo"}}, &q), IsNil)
+	c.Assert(q.Parent, IsNil)
+	c.Assert(DecodeForm(url.Values{"parent.name": {"foo"}}, &q), IsNil)
+	c.Assert(q.Parent, DeepEquals, &testFilter{Name: "foo"})
+}
+
+func (s *formCodecSuite) TestMaxSliceLen(c *C) {
+	container := NewGroup()
+	container.SetResponseEncoder(defaultResponseEncoder)
+	container.SetErrorEncoder(defaultErrorEncoder)
+	container.SetMaxFormSliceLen(2)
+	bound := container.Wrap(func(q *testQuery) (int, error) {
+		return len(q.Orders), nil
+	})
+	decoded := container.Wrap(func(form *Form) (int, error) {
+		var q testQuery
+		err := form.Decode(&q)
+		return len(q.Orders), err
+	})
+	for _, handler := range []Fn{bound, decoded} {
+		request := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("orders[1].field=id"))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		c.Assert(recorder.Body.String(), Equals, "2\n")
+
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/?orders[2].field=id", nil))
+		c.Assert(recorder.Code, Equals, http.StatusBadRequest)
+		c.Assert(recorder.Body.String(), Matches, `.*index 2 exceeds the limit 2.*\n`)
+	}
+}
+
+func (s *formCodecSuite) TestEncode(c *C) {
+	limit := 5
+	q := &testQuery{
+		testPagination: testPagination{Page: 1},
+		Keyword:        "fn",
+		Tags:           []string{"a", "b"},
+		Filter:         testFilter{Name: "foo"},
+		Orders:         []testOrder{{Field: "id", Desc: true}},
+		Limit:          &limit,
+	}
+	values, err := EncodeForm(q)
+	c.Assert(err, IsNil)
+	c.Assert(values.Get("page"), Equals, "1")
+	c.Assert(values["size"], IsNil)
+	c.Assert(values["tags"], DeepEquals, []string{"a", "b"})
+	c.Assert(values.Get("filter.name"), Equals, "foo")
+	c.Assert(values["filter.since"], IsNil)
+	c.Assert(values.Get("orders[0].desc"), Equals, "true")
+	c.Assert(values.Get("limit"), Equals, "5")
+	c.Assert(values.Get("timeout"), Equals, "0s")
+
+	var decoded testQuery
+	c.Assert(DecodeForm(values, &decoded), IsNil)
+	c.Assert(decoded.Orders, DeepEquals, q.Orders)
+}
+
+func (s *formCodecSuite) TestURLEncodedRequest(c *C) {
+	handler := New().Wrap(func(q *testQuery) (*testQuery, error) {
+		return q, nil
+	})
+	request, err := http.NewRequest(http.MethodPost, "/", bytes.NewBufferString("q=fn&filter.name=foo"))
+	c.Assert(err, IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), Matches, `(?s).*"Keyword":"fn".*"Name":"foo".*`)
+}
+
+func (s *formCodecSuite) TestURLEncodedJSON(c *C) {
+	// the type without form tags is decoded as json, such as `curl -d`
+	handler := New().Wrap(func(req *struct {
+		Username string `json:"username"`
+	}) (string, error) {
+		return req.Username, nil
+	})
+	request := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"username":"a"}`))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), Equals, `"a"`+"\n")
+}
+
+func (s *formCodecSuite) TestQueryRequest(c *C) {
+	handler := New().Wrap(func(q *testQuery) (*testQuery, error) {
+		return q, nil
+	})
+	request := httptest.NewRequest(http.MethodGet, "/?q=fn&page=2", nil)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), Matches, `(?s).*"Page":2.*"Keyword":"fn".*`)
+
+	// the query is not bound into the json request
+	jsonHandler := New().Wrap(func(req *struct{ Name string }) (string, error) {
+		return req.Name, nil
+	})
+	recorder = httptest.NewRecorder()
+	jsonHandler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/?Name=fn", nil))
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), Equals, `""`+"\n")
+}
+
+type testCookieRequest struct {
+	Name string `form:"name"`
+	UID  int    `cookie:"uid"`
+	Lang string `form:"lang" cookie:"lang"`
+}
+
+func (s *formCodecSuite) TestCookieField(c *C) {
+	values, err := EncodeForm(&testCookieRequest{UID: 1, Lang: "en"})
+	c.Assert(err, IsNil)
+	c.Assert(values, DeepEquals, url.Values{"name": {""}, "lang": {"en"}})
+
+	var decoded testCookieRequest
+	c.Assert(DecodeForm(url.Values{"UID": {"1"}, "uid": {"1"}, "lang": {"en"}}, &decoded), IsNil)
+	c.Assert(decoded, DeepEquals, testCookieRequest{Lang: "en"})
+
+	// the cookie field can not be set by the form or query
+	handler := New().Wrap(func(req *testCookieRequest) (*testCookieRequest, error) {
+		return req, nil
+	})
+	request := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("name=x&UID=1"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Body.String(), Equals, `{"Name":"x","UID":0,"Lang":""}`+"\n")
+
+	request = httptest.NewRequest(http.MethodGet, "/?UID=7&name=x", nil)
+	request.AddCookie(&http.Cookie{Name: "uid", Value: "3"})
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Body.String(), Equals, `{"Name":"x","UID":3,"Lang":""}`+"\n")
+}
@@ -14,9 +14,30 @@
 package fn
 
 import (
+	"errors"
+	"net/http"
 	"strconv"
+	"time"
 )
 
+// ErrFieldRequired returned by the MustX accessors when the field is absent
+var ErrFieldRequired = errors.New("field is required")
+
+// ErrFieldEnum returned by the enum accessors when the value is not allowed
+var ErrFieldEnum = errors.New("value is not allowed")
+
+func fieldError(key string, err error) error {
+	return ErrorWithStatusCode(&FieldError{Field: key, Err: err}, http.StatusBadRequest)
+}
+
+// require returns an error naming the field if the value of key is empty
+func (f *uniform) require(key string) error {
+	if f.Get(key) == "" {
+		return fieldError(key, ErrFieldRequired)
+	}
+	return nil
+}
+
 func (f *uniform) Int(key string) int {
 	value := f.Get(key)
 	if value == "" {
@@ -89,6 +110,307 @@ func (f *uniform) Uint64OrDefault(key string, def uint64) uint64 {
 	return v
 }
 
+// IntE returns the int value of key, the error names the field if
+// the value is malformed
+func (f *uniform) IntE(key string) (int, error) {
+	value := f.Get(key)
+	if value == "" {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fieldError(key, err)
+	}
+	return v, nil
+}
+
+// MustInt likes IntE but the field is required
+func (f *uniform) MustInt(key string) (int, error) {
+	if err := f.require(key); err != nil {
+		return 0, err
+	}
+	return f.IntE(key)
+}
+
+// Int64E returns the int64 value of key, the error names the field if
+// the value is malformed
+func (f *uniform) Int64E(key string) (int64, error) {
+	value := f.Get(key)
+	if value == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fieldError(key, err)
+	}
+	return v, nil
+}
+
+// MustInt64 likes Int64E but the field is required
+func (f *uniform) MustInt64(key string) (int64, error) {
+	if err := f.require(key); err != nil {
+		return 0, err
+	}
+	return f.Int64E(key)
+}
+
+// Uint64E returns the uint64 value of key, the error names the field if
+// the value is malformed
+func (f *uniform) Uint64E(key string) (uint64, error) {
+	value := f.Get(key)
+	if value == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fieldError(key, err)
+	}
+	return v, nil
+}
+
+// MustUint64 likes Uint64E but the field is required
+func (f *uniform) MustUint64(key string) (uint64, error) {
+	if err := f.require(key); err != nil {
+		return 0, err
+	}
+	return f.Uint64E(key)
+}
+
+func (f *uniform) Bool(key string) bool {
+	v, _ := f.BoolE(key)
+	return v
+}
+
+func (f *uniform) BoolOrDefault(key string, def bool) bool {
+	v, err := f.BoolE(key)
+	if err != nil || f.Get(key) == "" {
+		return def
+	}
+	return v
+}
+
+// BoolE returns the bool value of key, the error names the field if
+// the value is malformed
+func (f *uniform) BoolE(key string) (bool, error) {
+	value := f.Get(key)
+	if value == "" {
+		return false, nil
+	}
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fieldError(key, err)
+	}
+	return v, nil
+}
+
+// MustBool likes BoolE but the field is required
+func (f *uniform) MustBool(key string) (bool, error) {
+	if err := f.require(key); err != nil {
+		return false, err
+	}
+	return f.BoolE(key)
+}
+
+func (f *uniform) Float64(key string) float64 {
+	v, _ := f.Float64E(key)
+	return v
+}
+
+func (f *uniform) Float64OrDefault(key string, def float64) float64 {
+	v, err := f.Float64E(key)
+	if err != nil || f.Get(key) == "" {
+		return def
+	}
+	return v
+}
+
+// Float64E returns the float64 value of key, the error names the field if
+// the value is malformed
+func (f *uniform) Float64E(key string) (float64, error) {
+	value := f.Get(key)
+	if value == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fieldError(key, err)
+	}
+	return v, nil
+}
+
+// MustFloat64 likes Float64E but the field is required
+func (f *uniform) MustFloat64(key string) (float64, error) {
+	if err := f.require(key); err != nil {
+		return 0, err
+	}
+	return f.Float64E(key)
+}
+
+func (f *uniform) Duration(key string) time.Duration {
+	v, _ := f.DurationE(key)
+	return v
+}
+
+func (f *uniform) DurationOrDefault(key string, def time.Duration) time.Duration {
+	v, err := f.DurationE(key)
+	if err != nil || f.Get(key) == "" {
+		return def
+	}
+	return v
+}
+
+// DurationE returns the duration value of key such as `1m30s`, the error
+// names the field if the value is malformed
+func (f *uniform) DurationE(key string) (time.Duration, error) {
+	value := f.Get(key)
+	if value == "" {
+		return 0, nil
+	}
+	v, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fieldError(key, err)
+	}
+	return v, nil
+}
+
+// MustDuration likes DurationE but the field is required
+func (f *uniform) MustDuration(key string) (time.Duration, error) {
+	if err := f.require(key); err != nil {
+		return 0, err
+	}
+	return f.DurationE(key)
+}
+
+func (f *uniform) Time(key, layout string) time.Time {
+	v, _ := f.TimeE(key, layout)
+	return v
+}
+
+func (f *uniform) TimeOrDefault(key, layout string, def time.Time) time.Time {
+	v, err := f.TimeE(key, layout)
+	if err != nil || f.Get(key) == "" {
+		return def
+	}
+	return v
+}
+
+// TimeE returns the time value of key parsed with layout, the error names
+// the field if the value is malformed
+func (f *uniform) TimeE(key, layout string) (time.Time, error) {
+	value := f.Get(key)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	v, err := time.Parse(layout, value)
+	if err != nil {
+		return time.Time{}, fieldError(key, err)
+	}
+	return v, nil
+}
+
+// MustTime likes TimeE but the field is required
+func (f *uniform) MustTime(key, layout string) (time.Time, error) {
+	if err := f.require(key); err != nil {
+		return time.Time{}, err
+	}
+	return f.TimeE(key, layout)
+}
+
+// MustString returns the value of key, the error names the field if
+// the value is empty
+func (f *uniform) MustString(key string) (string, error) {
+	if err := f.require(key); err != nil {
+		return "", err
+	}
+	return f.Get(key), nil
+}
+
+// Strings returns all values associated with key
+func (f *uniform) Strings(key string) []string {
+	return f.Values[key]
+}
+
+// MustStrings likes Strings but the field is required
+func (f *uniform) MustStrings(key string) ([]string, error) {
+	if err := f.require(key); err != nil {
+		return nil, err
+	}
+	return f.Strings(key), nil
+}
+
+// Ints returns all int values associated with key, malformed values are
+// skipped
+func (f *uniform) Ints(key string) []int {
+	values := f.Values[key]
+	if len(values) == 0 {
+		return nil
+	}
+	v := make([]int, 0, len(values))
+	for _, value := range values {
+		i, err := strconv.Atoi(value)
+		if err == nil {
+			v = append(v, i)
+		}
+	}
+	return v
+}
+
+// IntsE returns all int values associated with key, the error names the
+// field if any value is malformed
+func (f *uniform) IntsE(key string) ([]int, error) {
+	values := f.Values[key]
+	if len(values) == 0 {
+		return nil, nil
+	}
+	v := make([]int, len(values))
+	for i, value := range values {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fieldError(key, err)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+// MustInts likes IntsE but the field is required
+func (f *uniform) MustInts(key string) ([]int, error) {
+	if err := f.require(key); err != nil {
+		return nil, err
+	}
+	return f.IntsE(key)
+}
+
+// Enum returns the value of key if it is one of allowed, otherwise
+// returns the empty string
+func (f *uniform) Enum(key string, allowed ...string) string {
+	v, _ := f.EnumE(key, allowed...)
+	return v
+}
+
+// EnumE returns the value of key, the error names the field if the value
+// is not one of allowed
+func (f *uniform) EnumE(key string, allowed ...string) (string, error) {
+	value := f.Get(key)
+	if value == "" {
+		return "", nil
+	}
+	for _, a := range allowed {
+		if a == value {
+			return value, nil
+		}
+	}
+	return "", fieldError(key, ErrFieldEnum)
+}
+
+// MustEnum likes EnumE but the field is required
+func (f *uniform) MustEnum(key string, allowed ...string) (string, error) {
+	if err := f.require(key); err != nil {
+		return "", err
+	}
+	return f.EnumE(key, allowed...)
+}
+
 // Get gets the first value associated with the given key.
 // If there are no values associated with the key, Get returns
 // the empty string. To access multiple values, use the map
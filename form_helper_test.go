@@ -0,0 +1,80 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"net/url"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+type formHelperSuite struct{}
+
+var _ = Suite(&formHelperSuite{})
+
+func newTestForm() *Form {
+	return &Form{uniform{Values: url.Values{
+		"ok":      {"true"},
+		"price":   {"9.5"},
+		"timeout": {"1m30s"},
+		"day":     {"2020-01-02"},
+		"ids":     {"1", "x", "3"},
+		"tags":    {"a", "b"},
+		"sort":    {"asc"},
+		"bad":     {"x"},
+	}}}
+}
+
+func (s *formHelperSuite) TestAccessors(c *C) {
+	form := newTestForm()
+	c.Assert(form.Bool("ok"), IsTrue)
+	c.Assert(form.BoolOrDefault("bad", true), IsTrue)
+	c.Assert(form.Float64("price"), Equals, 9.5)
+	c.Assert(form.Duration("timeout"), Equals, 90*time.Second)
+	c.Assert(form.DurationOrDefault("missing", time.Second), Equals, time.Second)
+	c.Assert(form.Time("day", "2006-01-02").Day(), Equals, 2)
+	c.Assert(form.Ints("ids"), DeepEquals, []int{1, 3})
+	c.Assert(form.Strings("tags"), DeepEquals, []string{"a", "b"})
+	c.Assert(form.Enum("sort", "asc", "desc"), Equals, "asc")
+	c.Assert(form.Enum("bad", "asc", "desc"), Equals, "")
+}
+
+func (s *formHelperSuite) TestFieldErrors(c *C) {
+	form := newTestForm()
+
+	v, err := form.IntE("missing")
+	c.Assert(err, IsNil)
+	c.Assert(v, Equals, 0)
+
+	_, err = form.MustInt("missing")
+	c.Assert(err, ErrorMatches, "missing: field is required")
+	code, ok := UnwrapErrorStatusCode(err)
+	c.Assert(ok, IsTrue)
+	c.Assert(code, Equals, 400)
+
+	_, err = form.Float64E("bad")
+	c.Assert(err, ErrorMatches, "bad: .*invalid syntax")
+	fe := Unwrap(err).(*FieldError)
+	c.Assert(fe.Field, Equals, "bad")
+
+	_, err = form.IntsE("ids")
+	c.Assert(err, ErrorMatches, "ids: .*")
+	_, err = form.MustEnum("bad", "asc")
+	c.Assert(Unwrap(Unwrap(err)), Equals, ErrFieldEnum)
+
+	d, err := form.MustDuration("timeout")
+	c.Assert(err, IsNil)
+	c.Assert(d, Equals, 90*time.Second)
+}
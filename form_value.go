@@ -0,0 +1,66 @@
+//go:build go1.18
+// +build go1.18
+
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"strconv"
+	"time"
+)
+
+// FormValueType types supported by FormValue, time.Time is parsed as RFC3339
+type FormValueType interface {
+	string | bool | int | int64 | uint64 | float64 | time.Duration | time.Time
+}
+
+// FormValue returns the typed value of key, zero value is returned if the
+// field is absent, the error names the field if the value is malformed
+//
+// e.g:
+// page, err := fn.FormValue[int](form, "page")
+func FormValue[T FormValueType](form interface{ Get(string) string }, key string) (T, error) {
+	var (
+		v     T
+		err   error
+		value = form.Get(key)
+	)
+	if value == "" {
+		return v, nil
+	}
+	switch p := any(&v).(type) {
+	case *string:
+		*p = value
+	case *bool:
+		*p, err = strconv.ParseBool(value)
+	case *int:
+		*p, err = strconv.Atoi(value)
+	case *int64:
+		*p, err = strconv.ParseInt(value, 10, 64)
+	case *uint64:
+		*p, err = strconv.ParseUint(value, 10, 64)
+	case *float64:
+		*p, err = strconv.ParseFloat(value, 64)
+	case *time.Duration:
+		*p, err = time.ParseDuration(value)
+	case *time.Time:
+		*p, err = time.Parse(time.RFC3339, value)
+	}
+	if err != nil {
+		var zero T
+		return zero, fieldError(key, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,47 @@
+//go:build go1.18
+// +build go1.18
+
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"net/url"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+func (s *formHelperSuite) TestFormValue(c *C) {
+	form := newTestForm()
+	ok, err := FormValue[bool](form, "ok")
+	c.Assert(err, IsNil)
+	c.Assert(ok, IsTrue)
+
+	timeout, err := FormValue[time.Duration](form, "timeout")
+	c.Assert(err, IsNil)
+	c.Assert(timeout, Equals, 90*time.Second)
+
+	n, err := FormValue[int](form, "missing")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+
+	_, err = FormValue[int](form, "bad")
+	c.Assert(err, ErrorMatches, "bad: .*")
+
+	cookies := &Cookies{values: url.Values{"uid": {"42"}}}
+	uid, err := FormValue[int64](cookies, "uid")
+	c.Assert(err, IsNil)
+	c.Assert(uid, Equals, int64(42))
+}
@@ -16,6 +16,7 @@ package fn
 import (
 	"net/http"
 	"reflect"
+	"time"
 )
 
 var (
@@ -24,12 +25,30 @@ var (
 
 func init() {
 	globalContainer.RequestPlugin(supportTypes...)
+	for t, v := range containerValuers {
+		globalContainer.supportTypes[t] = v
+	}
 }
 
 // Fn handler interface
 type Fn interface {
 	http.Handler
 	Plugin(before ...PluginFunc) Fn
+	// Use the middlewares to wrap the handler
+	Use(middlewares ...Middleware) Fn
+	// Require the principal to be granted all scopes
+	Require(scopes ...string) Fn
+	// Authorize the request by policy before the adapter runs
+	Authorize(name string, policy Policy) Fn
+	// Timeout the handler after d
+	Timeout(d time.Duration) Fn
+	// Cache set the Cache-Control header of successful responses
+	Cache(p CachePolicy) Fn
+	// CurrentETag evaluate the preconditions of unsafe requests before the
+	// handler runs against the resolved ETag
+	CurrentETag(resolve ETagResolver) Fn
+	// CacheResponse serve GET and HEAD requests from the response cache
+	CacheResponse(cache *ResponseCache) Fn
 }
 
 func wrapCheckType(t reflect.Type) (int, bool) {
@@ -80,9 +99,30 @@ func SetResponseEncoder(c ResponseEncoder) {
 	globalContainer.SetResponseEncoder(c)
 }
 
-// SetMultipartFormMaxMemory set multipart max memory
+// SetMultipartFormMaxMemory set multipart max memory, the default is used if
+// m is not positive
 func SetMultipartFormMaxMemory(m int64) {
-	maxMemory = m
+	globalContainer.SetMultipartFormMaxMemory(m)
+}
+
+// SetMultipartOptions set multipart form limits
+func SetMultipartOptions(o MultipartOptions) {
+	globalContainer.SetMultipartOptions(o)
+}
+
+// SetLenientForm swallow the form parse errors
+func SetLenientForm(lenient bool) {
+	globalContainer.SetLenientForm(lenient)
+}
+
+// SetMaxFormSliceLen set the max length of slice decoded from the form
+func SetMaxFormSliceLen(n int) {
+	globalContainer.SetMaxFormSliceLen(n)
+}
+
+// SetSessionProvider set the provider of Session parameter
+func SetSessionProvider(p SessionProvider) {
+	globalContainer.SetSessionProvider(p)
 }
 
 // RequestPlugin set request plugin func (ctx context.Context, r *http.Request) ({{data}}, error)
@@ -0,0 +1,120 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// ErrNotWrapped returned if Invoke is called with a handler not wrapped by fn
+var ErrNotWrapped = errors.New("fn: handler is not wrapped by fn")
+
+// Invoke call the wrapped handler in process with a synthetic POST request,
+// the plugins, authorization and timeout of handler are applied, req is
+// passed to the handler as the customized type instead of decoding the
+// request body, and the payload is returned without encoding
+//
+// e.g:
+//
+//	resp, err := fn.Invoke(ctx, fn.Wrap(login), &LoginRequest{Name: "fn"})
+func Invoke(ctx context.Context, f Fn, req interface{}) (interface{}, error) {
+	r, err := http.NewRequest(http.MethodPost, "/", nil)
+	if err != nil {
+		return nil, err
+	}
+	return InvokeRequest(r.WithContext(ctx), f, req)
+}
+
+// InvokeRequest is like Invoke but the plugins and valuers read the header,
+// URL and context of r, the middlewares of handler are not applied because
+// there is no response, and the session changes are not saved
+func InvokeRequest(r *http.Request, f Fn, req interface{}) (interface{}, error) {
+	ff, ok := f.(*fn)
+	if !ok {
+		return nil, ErrNotWrapped
+	}
+	var bind func(reflect.Type) (reflect.Value, error)
+	if req != nil {
+		bind = bindValue(reflect.ValueOf(req))
+	}
+	return ff.invokeWith(nil, r, bind)
+}
+
+// bindValue returns a bind function converts the request value to the
+// customized type, a struct value is accepted for the pointer type
+func bindValue(input reflect.Value) func(reflect.Type) (reflect.Value, error) {
+	return func(typ reflect.Type) (reflect.Value, error) {
+		if input.Type().AssignableTo(typ) {
+			return input, nil
+		}
+		if input.Type().AssignableTo(typ.Elem()) {
+			value := reflect.New(typ.Elem())
+			value.Elem().Set(input)
+			return value, nil
+		}
+		return reflect.Value{}, fmt.Errorf("fn: invoke with %s, want %s", input.Type(), typ)
+	}
+}
+
+// invokeWith runs the handler without encoding, the customized type is bound
+// by bind if it is not nil, the response header and session changed by the
+// handler are written to w if it is not nil
+func (f *fn) invokeWith(w http.ResponseWriter, r *http.Request, bind func(reflect.Type) (reflect.Value, error)) (interface{}, error) {
+	ctx, state := withRequestState(r.Context(), f)
+	state.header = http.Header{}
+	state.bind = bind
+	r = r.WithContext(ctx)
+	defer removeMultipartFiles(r)
+
+	ctx, span := f.container.tracer.Start(ctx, f.name, r)
+	ctx, cancel := f.withDeadline(ctx, r)
+	defer cancel()
+
+	ctx, resp, err := f.handle(ctx, r)
+	if w != nil {
+		mergeCallHeader(w.Header(), state.header)
+		if e := saveSession(ctx, f.container, w, state); e != nil && err == nil {
+			err = e
+		}
+	}
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusBadRequest
+		if v, ok := UnwrapErrorStatusCode(err); ok {
+			status = v
+		}
+	}
+	span.SetStatus(status)
+	endSpan(span, err)
+	return resp, err
+}
+
+// mergeCallHeader merges the response header of a call into dst, the cookies
+// are appended and other headers replace the ones of the earlier calls, the
+// content headers of dst are kept
+func mergeCallHeader(dst, src http.Header) {
+	for k, v := range src {
+		switch k {
+		case "Content-Type", "Content-Length", "Content-Encoding":
+		case "Set-Cookie":
+			dst[k] = append(dst[k], v...)
+		default:
+			dst[k] = append([]string(nil), v...)
+		}
+	}
+}
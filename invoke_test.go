@@ -0,0 +1,101 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+type invokeSuite struct{}
+
+var _ = Suite(&invokeSuite{})
+
+type invokeRequest struct {
+	Name string `json:"name"`
+}
+
+type invokeResponse struct {
+	Greeting string
+	Region   string
+}
+
+func (s *invokeSuite) TestInvoke(c *C) {
+	var plugged bool
+	group := NewGroup()
+	group.Plugin(func(ctx context.Context, r *http.Request) (context.Context, error) {
+		plugged = true
+		return ctx, nil
+	})
+	handler := group.Wrap(func(ctx context.Context, header http.Header, req *invokeRequest) (*invokeResponse, error) {
+		if req.Name == "" {
+			return nil, ErrorWithStatusCode(errors.New("name required"), http.StatusUnprocessableEntity)
+		}
+		return &invokeResponse{Greeting: "hello " + req.Name, Region: header.Get("X-Region")}, nil
+	})
+
+	resp, err := Invoke(context.Background(), handler, &invokeRequest{Name: "fn"})
+	c.Assert(err, IsNil)
+	c.Assert(plugged, IsTrue)
+	c.Assert(resp, DeepEquals, &invokeResponse{Greeting: "hello fn"})
+
+	// struct value is accepted for the pointer type
+	resp, err = Invoke(context.Background(), handler, invokeRequest{Name: "go"})
+	c.Assert(err, IsNil)
+	c.Assert(resp.(*invokeResponse).Greeting, Equals, "hello go")
+
+	_, err = Invoke(context.Background(), handler, nil)
+	code, ok := UnwrapErrorStatusCode(err)
+	c.Assert(ok, IsTrue)
+	c.Assert(code, Equals, http.StatusUnprocessableEntity)
+
+	_, err = Invoke(context.Background(), handler, "fn")
+	c.Assert(err, ErrorMatches, "fn: invoke with string, want \\*fn.invokeRequest")
+
+	r, _ := http.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Region", "cn")
+	resp, err = InvokeRequest(r, handler, &invokeRequest{Name: "fn"})
+	c.Assert(err, IsNil)
+	c.Assert(resp.(*invokeResponse).Region, Equals, "cn")
+}
+
+func (s *invokeSuite) TestInvokeUnary(c *C) {
+	handler := New().Wrap(func(req *invokeRequest) (string, error) {
+		return req.Name, nil
+	})
+	resp, err := Invoke(context.Background(), handler, &invokeRequest{Name: "fn"})
+	c.Assert(err, IsNil)
+	c.Assert(resp, Equals, "fn")
+}
+
+func (s *invokeSuite) TestInvokePipeline(c *C) {
+	handler := New().Wrap(func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}).Timeout(10 * time.Millisecond)
+	_, err := Invoke(context.Background(), handler, nil)
+	c.Assert(Unwrap(err), Equals, ErrTimeout)
+
+	guarded := New().Wrap(func() (string, error) { return "ok", nil }).Require("admin")
+	_, err = Invoke(context.Background(), guarded, nil)
+	code, _ := UnwrapErrorStatusCode(err)
+	c.Assert(code, Equals, http.StatusUnauthorized)
+
+	_, err = Invoke(context.Background(), nil, nil)
+	c.Assert(err, Equals, ErrNotWrapped)
+}
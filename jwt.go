@@ -0,0 +1,438 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256" // register SHA256
+	_ "crypto/sha512" // register SHA384 and SHA512
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidToken returned if the token is malformed or its signature
+	// does not match
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenExpired returned if the token is expired or not valid yet
+	ErrTokenExpired = errors.New("token is expired or not valid yet")
+	// ErrUnknownKey returned if no key of the key set matches the token
+	ErrUnknownKey = errors.New("unknown signing key")
+)
+
+// KeySet resolves the verification key of JWT by the `kid` and `alg`
+// header, the key is one of []byte, *rsa.PublicKey and *ecdsa.PublicKey
+type KeySet interface {
+	Key(kid, alg string) (interface{}, error)
+}
+
+// JWK represents a JSON Web Key, only the verification members are parsed
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	K   string `json:"k,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type jwkKey struct {
+	kid string
+	alg string
+	key interface{}
+	// anyKid the key matches the token of any kid
+	anyKid bool
+}
+
+// JWKS represents a JSON Web Key Set
+type JWKS struct {
+	keys []jwkKey
+}
+
+// LoadJWKS loads the key set from a local JWKS file
+func LoadJWKS(path string) (*JWKS, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+// ParseJWKS parses the JSON encoded key set
+func ParseJWKS(data []byte) (*JWKS, error) {
+	var set struct {
+		Keys []JWK `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	jwks := &JWKS{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("jwk %s: %v", k.Kid, err)
+		}
+		jwks.keys = append(jwks.keys, jwkKey{kid: k.Kid, alg: k.Alg, key: key})
+	}
+	return jwks, nil
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func (k *JWK) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "oct":
+		return decodeSegment(k.K)
+	case "RSA":
+		n, err := decodeSegment(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeSegment(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeSegment(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeSegment(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// Key returns the key of kid, the token without kid requires exactly one
+// key matches the algorithm
+func (j *JWKS) Key(kid, alg string) (interface{}, error) {
+	var (
+		key     interface{}
+		matched int
+	)
+	for _, k := range j.keys {
+		if (kid != "" && k.kid != kid && !k.anyKid) || (k.alg != "" && k.alg != alg) {
+			continue
+		}
+		key = k.key
+		matched++
+	}
+	if matched != 1 {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// HMACKeySet returns a key set of a single HMAC secret, the secret verifies
+// the tokens of any kid
+func HMACKeySet(secret []byte) KeySet {
+	return &JWKS{keys: []jwkKey{{key: secret, anyKid: true}}}
+}
+
+// JWTOptions options of the Bearer JWT authenticator
+type JWTOptions struct {
+	Realm string
+	// Issuer the expected `iss` claim, empty means not checked
+	Issuer string
+	// Audience the expected `aud` claim, empty means not checked
+	Audience string
+	// Leeway the clock skew tolerance of `exp` and `nbf`
+	Leeway time.Duration
+	// Algorithms the accepted algorithms, default accepts all supported
+	Algorithms []string
+	// Now returns the current time, default is time.Now
+	Now func() time.Time
+}
+
+type jwtAuthenticator struct {
+	keys KeySet
+	opts JWTOptions
+}
+
+// JWTAuth returns an authenticator of Bearer scheme verifies the JWT signed
+// by HS256/384/512, RS256/384/512, PS256/384/512 or ES256/384/512, the
+// `scope`/`scp` and `roles` claims are mapped to the principal
+func JWTAuth(keys KeySet, opts JWTOptions) Authenticator {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &jwtAuthenticator{keys: keys, opts: opts}
+}
+
+func (j *jwtAuthenticator) Challenge() string {
+	if j.opts.Realm == "" {
+		return "Bearer"
+	}
+	return `Bearer realm="` + j.opts.Realm + `"`
+}
+
+func (j *jwtAuthenticator) invalid(err error) error {
+	return UnauthorizedError(err, j.Challenge()+`, error="invalid_token", error_description="`+err.Error()+`"`)
+}
+
+func (j *jwtAuthenticator) Authenticate(_ context.Context, r *http.Request) (*Principal, error) {
+	auth := r.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return nil, ErrNoCredentials
+	}
+	claims, err := j.verify(strings.TrimSpace(auth[7:]))
+	if err != nil {
+		return nil, j.invalid(err)
+	}
+	p := &Principal{Scheme: "Bearer", Claims: claims}
+	p.Subject, _ = claims["sub"].(string)
+	p.Scopes = claimStrings(claims["scope"], claims["scp"])
+	p.Roles = claimStrings(claims["roles"])
+	return p, nil
+}
+
+func claimStrings(claims ...interface{}) []string {
+	var values []string
+	for _, c := range claims {
+		switch v := c.(type) {
+		case string:
+			values = append(values, strings.Fields(v)...)
+		case []interface{}:
+			for _, s := range v {
+				if s, ok := s.(string); ok {
+					values = append(values, s)
+				}
+			}
+		}
+	}
+	return values
+}
+
+func (j *jwtAuthenticator) acceptAlgorithm(alg string) bool {
+	if len(j.opts.Algorithms) == 0 {
+		return true
+	}
+	for _, a := range j.opts.Algorithms {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
+
+func (j *jwtAuthenticator) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	data, err := decodeSegment(parts[0])
+	if err != nil || json.Unmarshal(data, &header) != nil {
+		return nil, ErrInvalidToken
+	}
+	if !j.acceptAlgorithm(header.Alg) {
+		return nil, ErrInvalidToken
+	}
+	key, err := j.keys.Key(header.Kid, header.Alg)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := decodeSegment(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	data, err = decodeSegment(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	return claims, j.validateClaims(claims)
+}
+
+// tokenError an invalid token with the reason, it unwraps to ErrInvalidToken
+type tokenError struct {
+	reason string
+}
+
+func invalidToken(reason string) error {
+	return &tokenError{reason: reason}
+}
+
+func (e *tokenError) Error() string {
+	return ErrInvalidToken.Error() + ": " + e.reason
+}
+
+func (e *tokenError) Unwrap() error {
+	return ErrInvalidToken
+}
+
+// timeClaim returns the NumericDate claim of name, the present claim of other
+// types is an invalid token
+func timeClaim(claims map[string]interface{}, name string) (time.Time, bool, error) {
+	v, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	n, ok := v.(float64)
+	if !ok {
+		return time.Time{}, false, invalidToken("malformed " + name + " claim")
+	}
+	return time.Unix(int64(n), 0), true, nil
+}
+
+func (j *jwtAuthenticator) validateClaims(claims map[string]interface{}) error {
+	now := j.opts.Now()
+	exp, ok, err := timeClaim(claims, "exp")
+	if err != nil {
+		return err
+	}
+	if ok && now.After(exp.Add(j.opts.Leeway)) {
+		return ErrTokenExpired
+	}
+	nbf, ok, err := timeClaim(claims, "nbf")
+	if err != nil {
+		return err
+	}
+	if ok && now.Add(j.opts.Leeway).Before(nbf) {
+		return ErrTokenExpired
+	}
+	if j.opts.Issuer != "" && claims["iss"] != j.opts.Issuer {
+		return invalidToken("unexpected issuer")
+	}
+	if j.opts.Audience != "" {
+		found := false
+		for _, aud := range claimStrings(claims["aud"]) {
+			if aud == j.opts.Audience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return invalidToken("unexpected audience")
+		}
+	}
+	return nil
+}
+
+func algorithmHash(alg string) (crypto.Hash, bool) {
+	if len(alg) != 5 {
+		return 0, false
+	}
+	switch alg[2:] {
+	case "256":
+		return crypto.SHA256, true
+	case "384":
+		return crypto.SHA384, true
+	case "512":
+		return crypto.SHA512, true
+	}
+	return 0, false
+}
+
+func verifySignature(alg string, key interface{}, signed string, sig []byte) error {
+	hash, ok := algorithmHash(alg)
+	if !ok {
+		return ErrInvalidToken
+	}
+	if alg[:2] == "HS" {
+		secret, ok := key.([]byte)
+		if !ok {
+			return ErrUnknownKey
+		}
+		mac := hmac.New(hash.New, secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return ErrInvalidToken
+		}
+		return nil
+	}
+
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+	switch alg[:2] {
+	case "RS", "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrUnknownKey
+		}
+		var err error
+		if alg[:2] == "RS" {
+			err = rsa.VerifyPKCS1v15(pub, hash, digest, sig)
+		} else {
+			err = rsa.VerifyPSS(pub, hash, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+		if err != nil {
+			return ErrInvalidToken
+		}
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return ErrUnknownKey
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return ErrInvalidToken
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return ErrInvalidToken
+		}
+	default:
+		return ErrInvalidToken
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"bufio"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets the default latency histogram buckets in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// MetricsOptions options of NewMetrics
+type MetricsOptions struct {
+	// Namespace the prefix of metric names, default is fn
+	Namespace string
+	// Buckets the upper bounds of latency histogram, default is DefaultBuckets
+	Buckets []float64
+}
+
+// Metrics collects the request metrics of wrapped handlers labelled by the
+// handler name and status code, and exposes them in the Prometheus text
+// exposition format
+//
+// e.g:
+//
+//	metrics := fn.NewMetrics(fn.MetricsOptions{})
+//	fn.Use(metrics.Middleware())
+//	http.Handle("/metrics", metrics)
+type Metrics struct {
+	namespace string
+	buckets   []float64
+	now       func() time.Time
+
+	mu       sync.Mutex
+	requests map[metricKey]uint64
+	errors   map[metricKey]uint64
+	inFlight map[string]int64
+	duration map[string]*histogram
+}
+
+type metricKey struct {
+	handler string
+	code    int
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewMetrics returns an empty metrics collector
+func NewMetrics(opts MetricsOptions) *Metrics {
+	if opts.Namespace == "" {
+		opts.Namespace = "fn"
+	}
+	if len(opts.Buckets) == 0 {
+		opts.Buckets = DefaultBuckets
+	}
+	buckets := append([]float64(nil), opts.Buckets...)
+	sort.Float64s(buckets)
+	return &Metrics{
+		namespace: opts.Namespace,
+		buckets:   buckets,
+		now:       time.Now,
+		requests:  map[metricKey]uint64{},
+		errors:    map[metricKey]uint64{},
+		inFlight:  map[string]int64{},
+		duration:  map[string]*histogram{},
+	}
+}
+
+// Middleware returns a middleware records the requests of handlers, add it
+// to a container to instrument every handler wrapped by the container
+func (m *Metrics) Middleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			info, ok := RequestInfoFromContext(r.Context())
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			handler := info.Handler
+			start := m.now()
+			m.addInFlight(handler, 1)
+			defer m.addInFlight(handler, -1)
+
+			next.ServeHTTP(w, r)
+
+			info, _ = RequestInfoFromContext(r.Context())
+			m.observe(handler, info, m.now().Sub(start))
+		})
+	}
+}
+
+func (m *Metrics) addInFlight(handler string, delta int64) {
+	m.mu.Lock()
+	m.inFlight[handler] += delta
+	m.mu.Unlock()
+}
+
+func (m *Metrics) observe(handler string, info RequestInfo, elapsed time.Duration) {
+	key := metricKey{handler: handler, code: info.Status}
+	seconds := elapsed.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[key]++
+	if info.Err != nil {
+		m.errors[key]++
+	}
+	h := m.duration[handler]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.duration[handler] = h
+	}
+	for i, upper := range m.buckets {
+		if seconds <= upper {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	m.write(bw)
+	_ = bw.Flush()
+}
+
+func (m *Metrics) write(w *bufio.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := m.namespace + "_requests_total"
+	writeMetaLine(w, name, "counter", "Total number of requests handled.")
+	for _, key := range sortedMetricKeys(m.requests) {
+		writeSample(w, name, m.requests[key], "handler", key.handler, "code", strconv.Itoa(key.code))
+	}
+
+	name = m.namespace + "_errors_total"
+	writeMetaLine(w, name, "counter", "Total number of requests responded with an error.")
+	for _, key := range sortedMetricKeys(m.errors) {
+		writeSample(w, name, m.errors[key], "handler", key.handler, "code", strconv.Itoa(key.code))
+	}
+
+	name = m.namespace + "_requests_in_flight"
+	writeMetaLine(w, name, "gauge", "Number of requests currently being handled.")
+	for _, handler := range sortedHandlers(m.inFlight) {
+		writeSample(w, name, m.inFlight[handler], "handler", handler)
+	}
+
+	name = m.namespace + "_request_duration_seconds"
+	writeMetaLine(w, name, "histogram", "Latency of requests in seconds.")
+	handlers := make([]string, 0, len(m.duration))
+	for handler := range m.duration {
+		handlers = append(handlers, handler)
+	}
+	sort.Strings(handlers)
+	for _, handler := range handlers {
+		h := m.duration[handler]
+		for i, upper := range m.buckets {
+			writeSample(w, name+"_bucket", h.counts[i], "handler", handler, "le", formatFloat(upper))
+		}
+		writeSample(w, name+"_bucket", h.count, "handler", handler, "le", "+Inf")
+		writeSample(w, name+"_sum", h.sum, "handler", handler)
+		writeSample(w, name+"_count", h.count, "handler", handler)
+	}
+}
+
+func sortedMetricKeys(m map[metricKey]uint64) []metricKey {
+	keys := make([]metricKey, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].handler != keys[j].handler {
+			return keys[i].handler < keys[j].handler
+		}
+		return keys[i].code < keys[j].code
+	})
+	return keys
+}
+
+func sortedHandlers(m map[string]int64) []string {
+	handlers := make([]string, 0, len(m))
+	for handler := range m {
+		handlers = append(handlers, handler)
+	}
+	sort.Strings(handlers)
+	return handlers
+}
+
+func writeMetaLine(w *bufio.Writer, name, typ, help string) {
+	w.WriteString("# HELP " + name + " " + help + "\n")
+	w.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+// writeSample writes a sample line, labels are name and value pairs
+func writeSample(w *bufio.Writer, name string, value interface{}, labels ...string) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(labels[i] + "=\"" + labelEscaper.Replace(labels[i+1]) + "\"")
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	switch v := value.(type) {
+	case uint64:
+		w.WriteString(strconv.FormatUint(v, 10))
+	case int64:
+		w.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		w.WriteString(formatFloat(v))
+	}
+	w.WriteByte('\n')
+}
+
+var labelEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
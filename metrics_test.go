@@ -0,0 +1,88 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+type metricsSuite struct{}
+
+var _ = Suite(&metricsSuite{})
+
+func (s *metricsSuite) TestMetrics(c *C) {
+	metrics := NewMetrics(MetricsOptions{Namespace: "api", Buckets: []float64{1, 0.1}})
+	now := time.Unix(0, 0)
+	metrics.now = func() time.Time {
+		now = now.Add(50 * time.Millisecond)
+		return now
+	}
+
+	var inFlight string
+	group := New()
+	group.Use(metrics.Middleware())
+	ok := group.Wrap(func() (string, error) {
+		recorder := httptest.NewRecorder()
+		metrics.ServeHTTP(recorder, nil)
+		inFlight = recorder.Body.String()
+		return "ok", nil
+	})
+	fail := group.Wrap(func() (string, error) {
+		return "", ErrorWithStatusCode(errors.New("bad"), http.StatusBadRequest)
+	})
+
+	request, _ := http.NewRequest(http.MethodGet, "/", nil)
+	ok.ServeHTTP(httptest.NewRecorder(), request)
+	ok.ServeHTTP(httptest.NewRecorder(), request)
+	fail.ServeHTTP(httptest.NewRecorder(), request)
+
+	okName := ok.(*fn).name
+	failName := fail.(*fn).name
+	c.Assert(strings.Contains(inFlight, "api_requests_in_flight{handler=\""+okName+"\"} 1\n"), IsTrue)
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, nil)
+	c.Assert(recorder.Header().Get("Content-Type"), Equals, "text/plain; version=0.0.4; charset=utf-8")
+	body := recorder.Body.String()
+	for _, line := range []string{
+		"# TYPE api_requests_total counter",
+		"api_requests_total{handler=\"" + okName + "\",code=\"200\"} 2",
+		"api_requests_total{handler=\"" + failName + "\",code=\"400\"} 1",
+		"api_errors_total{handler=\"" + failName + "\",code=\"400\"} 1",
+		"api_requests_in_flight{handler=\"" + okName + "\"} 0",
+		"# TYPE api_request_duration_seconds histogram",
+		"api_request_duration_seconds_bucket{handler=\"" + okName + "\",le=\"0.1\"} 2",
+		"api_request_duration_seconds_bucket{handler=\"" + okName + "\",le=\"1\"} 2",
+		"api_request_duration_seconds_bucket{handler=\"" + okName + "\",le=\"+Inf\"} 2",
+		"api_request_duration_seconds_sum{handler=\"" + okName + "\"} 0.1",
+		"api_request_duration_seconds_count{handler=\"" + okName + "\"} 2",
+	} {
+		c.Assert(strings.Contains(body, line+"\n"), IsTrue, Commentf("missing %q in\n%s", line, body))
+	}
+	c.Assert(strings.Contains(body, "api_errors_total{handler=\""+okName), IsFalse)
+}
+
+func (s *metricsSuite) TestLabelEscape(c *C) {
+	metrics := NewMetrics(MetricsOptions{})
+	metrics.observe("a\"b\\c\n", RequestInfo{Status: 200}, time.Second)
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, nil)
+	c.Assert(strings.Contains(recorder.Body.String(), "fn_requests_total{handler=\"a\\\"b\\\\c\\n\",code=\"200\"} 1\n"), IsTrue)
+}
@@ -0,0 +1,36 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import "net/http"
+
+// Middleware wraps the serving of handler, next serves the request with
+// plugins, binding and encoding, RequestInfoFromContext is available to the
+// middleware after next returns
+type Middleware func(next http.Handler) http.Handler
+
+// Use add middlewares to the container, the first middleware is the outermost
+func (c *Container) Use(middlewares ...Middleware) *Container {
+	for _, m := range middlewares {
+		if m != nil {
+			c.middlewares = append(c.middlewares, m)
+		}
+	}
+	return c
+}
+
+// Use add middlewares to the global container
+func Use(middlewares ...Middleware) {
+	globalContainer.Use(middlewares...)
+}
@@ -0,0 +1,58 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/pingcap/check"
+)
+
+type middlewareSuite struct{}
+
+var _ = Suite(&middlewareSuite{})
+
+func (s *middlewareSuite) TestUse(c *C) {
+	var (
+		order []string
+		info  RequestInfo
+	)
+	trace := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+				info, _ = RequestInfoFromContext(r.Context())
+			})
+		}
+	}
+
+	group := New()
+	group.Use(trace("container"))
+	handler := group.Wrap(func() (string, error) {
+		return "", ErrorWithStatusCode(errors.New("gone"), http.StatusGone)
+	}).Use(trace("handler"))
+
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest(http.MethodGet, "/", nil)
+	handler.ServeHTTP(recorder, request)
+	c.Assert(order, DeepEquals, []string{"container", "handler"})
+	c.Assert(recorder.Code, Equals, http.StatusGone)
+	c.Assert(info.Status, Equals, http.StatusGone)
+	c.Assert(info.Bytes, Equals, len("\"gone\"\n"))
+	c.Assert(info.Err, ErrorMatches, "gone")
+	c.Assert(info.Handler, Matches, "github.com/pingcap/fn.*func.*")
+}
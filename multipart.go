@@ -0,0 +1,303 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const defaultMultipartMaxMemory = int64(2 * 1024 * 1024)
+
+var (
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeaderSliceType = reflect.TypeOf([]*multipart.FileHeader(nil))
+	multipartFormType   = reflect.TypeOf((*multipart.Form)(nil))
+
+	// ErrFileTooLarge returned when an uploaded file exceeds the size limit
+	ErrFileTooLarge = errors.New("file too large")
+	// ErrFileType returned when an uploaded file has a disallowed content type
+	ErrFileType = errors.New("file content type not allowed")
+	// ErrBodyTooLarge returned when the multipart body exceeds the size limit
+	ErrBodyTooLarge = errors.New("request body too large")
+)
+
+// MultipartOptions multipart form limits of a container
+type MultipartOptions struct {
+	// MaxMemory bytes of file parts stored in memory, the remainder is
+	// stored on disk in temporary files
+	MaxMemory int64
+	// MaxFileSize the maximum size of each uploaded file, 0 means unlimited,
+	// it is checked after the form has been parsed
+	MaxFileSize int64
+	// MaxBodySize the maximum size of the whole multipart body, 0 means
+	// unlimited, the body is rejected while parsing once it exceeds the limit
+	MaxBodySize int64
+	// AllowedTypes the allowed content types of uploaded files, wildcard
+	// subtypes such as `image/*` are supported, empty means any type
+	AllowedTypes []string
+}
+
+func (o MultipartOptions) clone() MultipartOptions {
+	n := o
+	n.AllowedTypes = append([]string(nil), o.AllowedTypes...)
+	return n
+}
+
+// fileField represents a struct field tagged with `file:"name"`
+//
+// e.g:
+//
+//	type UploadRequest struct {
+//	    Avatar *multipart.FileHeader   `file:"avatar,maxsize=1048576,accept=image/png|image/jpeg"`
+//	    Photos []*multipart.FileHeader `file:"photos"`
+//	}
+type fileField struct {
+	index        []int
+	name         string
+	multiple     bool
+	maxSize      int64
+	allowedTypes []string
+}
+
+var fileFieldsCache sync.Map // map[reflect.Type][]fileField
+
+func parseFileTag(tag string) (fileField, error) {
+	parts := strings.Split(tag, ",")
+	f := fileField{name: parts[0]}
+	for _, opt := range parts[1:] {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 {
+			return f, fmt.Errorf("illegal file tag option `%s`", opt)
+		}
+		switch kv[0] {
+		case "maxsize":
+			size, err := strconv.ParseInt(kv[1], 10, 64)
+			if err != nil {
+				return f, fmt.Errorf("illegal file tag maxsize `%s`", kv[1])
+			}
+			f.maxSize = size
+		case "accept":
+			f.allowedTypes = strings.Split(kv[1], "|")
+		default:
+			return f, fmt.Errorf("unknown file tag option `%s`", kv[0])
+		}
+	}
+	return f, nil
+}
+
+// structFileFields collect `file` tagged fields of struct, panics if
+// a `file` tag is attached to an unsupported field type
+func structFileFields(t reflect.Type) []fileField {
+	if v, ok := fileFieldsCache.Load(t); ok {
+		return v.([]fileField)
+	}
+	var fields []fileField
+	if t.Kind() == reflect.Struct {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if tag, ok := field.Tag.Lookup("file"); ok {
+				f, err := parseFileTag(tag)
+				if err != nil {
+					panic(err.Error() + " (" + t.String() + "." + field.Name + ")")
+				}
+				switch field.Type {
+				case fileHeaderType:
+				case fileHeaderSliceType:
+					f.multiple = true
+				default:
+					panic("file tag only support *multipart.FileHeader or []*multipart.FileHeader (" + t.String() + "." + field.Name + ")")
+				}
+				f.index = field.Index
+				fields = append(fields, f)
+			}
+		}
+	}
+	v, _ := fileFieldsCache.LoadOrStore(t, fields)
+	return v.([]fileField)
+}
+
+// EncodeFiles collects the files of the fields tagged with `file` of the
+// struct src by the part names, the reverse of binding, the nil files are
+// skipped
+func EncodeFiles(src interface{}) (map[string][]*multipart.FileHeader, error) {
+	v := reflect.ValueOf(src)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, errFormSrc
+	}
+	var files map[string][]*multipart.FileHeader
+	for _, f := range structFileFields(v.Type()) {
+		var headers []*multipart.FileHeader
+		switch fv := v.FieldByIndex(f.index).Interface().(type) {
+		case *multipart.FileHeader:
+			headers = []*multipart.FileHeader{fv}
+		case []*multipart.FileHeader:
+			headers = fv
+		}
+		for _, fh := range headers {
+			if fh == nil {
+				continue
+			}
+			if files == nil {
+				files = map[string][]*multipart.FileHeader{}
+			}
+			files[f.name] = append(files[f.name], fh)
+		}
+	}
+	return files, nil
+}
+
+func isMultipartRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+func isURLEncodedRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/x-www-form-urlencoded"
+}
+
+func matchContentType(contentType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, a := range allowed {
+		if a == mediaType || a == "*/*" {
+			return true
+		}
+		if strings.HasSuffix(a, "/*") && strings.HasPrefix(mediaType, a[:len(a)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *MultipartOptions) checkFile(f *fileField, fh *multipart.FileHeader) error {
+	maxSize := o.MaxFileSize
+	if f.maxSize > 0 {
+		maxSize = f.maxSize
+	}
+	if maxSize > 0 && fh.Size > maxSize {
+		return ErrorWithStatusCode(&FieldError{Field: f.name, Err: ErrFileTooLarge}, http.StatusRequestEntityTooLarge)
+	}
+	allowed := o.AllowedTypes
+	if len(f.allowedTypes) > 0 {
+		allowed = f.allowedTypes
+	}
+	if !matchContentType(fh.Header.Get("Content-Type"), allowed) {
+		return ErrorWithStatusCode(&FieldError{Field: f.name, Err: ErrFileType}, http.StatusUnsupportedMediaType)
+	}
+	return nil
+}
+
+// countingBody counts the bytes read from the body under http.MaxBytesReader,
+// which reads one byte past the limit before it fails
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// parseMultipartForm parse multipart form with the container limits
+func (c *Container) parseMultipartForm(r *http.Request) (*multipart.Form, error) {
+	if r.MultipartForm != nil {
+		return r.MultipartForm, nil
+	}
+	limit := c.multipart.MaxBodySize
+	if limit <= 0 {
+		if err := r.ParseMultipartForm(c.multipart.MaxMemory); err != nil {
+			return nil, ErrorWithStatusCode(err, http.StatusBadRequest)
+		}
+		return r.MultipartForm, nil
+	}
+	if r.ContentLength > limit {
+		return nil, ErrorWithStatusCode(ErrBodyTooLarge, http.StatusRequestEntityTooLarge)
+	}
+	body := &countingBody{ReadCloser: r.Body}
+	r.Body = http.MaxBytesReader(nil, body, limit)
+	if err := r.ParseMultipartForm(c.multipart.MaxMemory); err != nil {
+		if body.n > limit {
+			return nil, ErrorWithStatusCode(ErrBodyTooLarge, http.StatusRequestEntityTooLarge)
+		}
+		return nil, ErrorWithStatusCode(err, http.StatusBadRequest)
+	}
+	return r.MultipartForm, nil
+}
+
+// bindMultipart bind multipart form files and values to the struct which dst points to
+func (c *Container) bindMultipart(r *http.Request, dst reflect.Value) error {
+	form, err := c.parseMultipartForm(r)
+	if err != nil {
+		return err
+	}
+	if err := decodeForm(form.Value, dst, c.maxFormSliceLen); err != nil {
+		return err
+	}
+	elem := dst.Elem()
+	fields := structFileFields(elem.Type())
+	for i := range fields {
+		f := &fields[i]
+		headers := form.File[f.name]
+		if len(headers) == 0 {
+			continue
+		}
+		for _, fh := range headers {
+			if err := c.multipart.checkFile(f, fh); err != nil {
+				return err
+			}
+		}
+		if f.multiple {
+			elem.FieldByIndex(f.index).Set(reflect.ValueOf(headers))
+		} else {
+			elem.FieldByIndex(f.index).Set(reflect.ValueOf(headers[0]))
+		}
+	}
+	return nil
+}
+
+func multipartValuer(_ context.Context, c *Container, r *http.Request) (reflect.Value, error) {
+	form, err := c.parseMultipartForm(r)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return reflect.ValueOf(form), nil
+}
+
+// removeMultipartFiles remove temporary files of multipart form after response
+func removeMultipartFiles(r *http.Request) {
+	if r.MultipartForm != nil {
+		_ = r.MultipartForm.RemoveAll()
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"strings"
+
+	. "github.com/pingcap/check"
+)
+
+type multipartSuite struct{}
+
+var _ = Suite(&multipartSuite{})
+
+type uploadRequest struct {
+	Name   string                  `form:"name"`
+	Age    int                     `form:"age"`
+	Avatar *multipart.FileHeader   `file:"avatar,accept=image/png|image/jpeg"`
+	Photos []*multipart.FileHeader `file:"photos"`
+}
+
+type uploadFile struct {
+	field       string
+	filename    string
+	contentType string
+	content     string
+}
+
+func newMultipartRequest(c *C, values map[string]string, files ...uploadFile) *http.Request {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	for k, v := range values {
+		c.Assert(mw.WriteField(k, v), IsNil)
+	}
+	for _, f := range files {
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", `form-data; name="`+f.field+`"; filename="`+f.filename+`"`)
+		h.Set("Content-Type", f.contentType)
+		w, err := mw.CreatePart(h)
+		c.Assert(err, IsNil)
+		_, err = w.Write([]byte(f.content))
+		c.Assert(err, IsNil)
+	}
+	c.Assert(mw.Close(), IsNil)
+	request, err := http.NewRequest(http.MethodPost, "/upload", body)
+	c.Assert(err, IsNil)
+	request.Header.Set("Content-Type", mw.FormDataContentType())
+	return request
+}
+
+func (s *multipartSuite) TestBindFiles(c *C) {
+	var got *uploadRequest
+	handler := NewGroup().Wrap(func(req *uploadRequest) (string, error) {
+		got = req
+		return "ok", nil
+	})
+	request := newMultipartRequest(c, map[string]string{"name": "foo", "age": "18"},
+		uploadFile{"avatar", "a.png", "image/png", "png"},
+		uploadFile{"photos", "1.jpg", "image/jpeg", "1"},
+		uploadFile{"photos", "2.jpg", "image/jpeg", "2"},
+	)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(got.Name, Equals, "foo")
+	c.Assert(got.Age, Equals, 18)
+	c.Assert(got.Avatar.Filename, Equals, "a.png")
+	c.Assert(len(got.Photos), Equals, 2)
+	c.Assert(got.Photos[1].Filename, Equals, "2.jpg")
+}
+
+func (s *multipartSuite) TestFileChecks(c *C) {
+	group := NewGroup()
+	group.SetMultipartOptions(MultipartOptions{MaxFileSize: 4})
+	handler := group.Wrap(func(req *uploadRequest) (string, error) {
+		return "ok", nil
+	})
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newMultipartRequest(c, nil, uploadFile{"avatar", "a.gif", "image/gif", "gif"}))
+	c.Assert(recorder.Code, Equals, http.StatusUnsupportedMediaType)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newMultipartRequest(c, nil, uploadFile{"photos", "1.jpg", "image/jpeg", "too large"}))
+	c.Assert(recorder.Code, Equals, http.StatusRequestEntityTooLarge)
+}
+
+func (s *multipartSuite) TestMaxBodySize(c *C) {
+	group := NewGroup()
+	group.SetErrorEncoder(defaultErrorEncoder)
+	group.SetMultipartOptions(MultipartOptions{MaxBodySize: 256})
+	handler := group.Wrap(func(req *uploadRequest) (string, error) {
+		return "ok", nil
+	})
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newMultipartRequest(c, nil, uploadFile{"photos", "1.jpg", "image/jpeg", "1"}))
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+
+	content := strings.Repeat("x", 512)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newMultipartRequest(c, nil, uploadFile{"photos", "1.jpg", "image/jpeg", content}))
+	c.Assert(recorder.Code, Equals, http.StatusRequestEntityTooLarge)
+	c.Assert(recorder.Body.String(), Equals, `"request body too large"`+"\n")
+
+	// the body of unknown length is rejected while parsing
+	request := newMultipartRequest(c, nil, uploadFile{"photos", "1.jpg", "image/jpeg", content})
+	request.ContentLength = -1
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, Equals, http.StatusRequestEntityTooLarge)
+}
+
+func (s *multipartSuite) TestRemoveTempFiles(c *C) {
+	group := NewGroup()
+	group.SetMultipartFormMaxMemory(0)
+	c.Assert(group.multipart.MaxMemory, Equals, defaultMultipartMaxMemory)
+	group.SetMultipartFormMaxMemory(1)
+
+	var photo *multipart.FileHeader
+	handler := group.Wrap(func(req *uploadRequest) (string, error) {
+		photo = req.Photos[0]
+		f, err := photo.Open()
+		if err != nil {
+			return "", err
+		}
+		if _, ok := f.(*os.File); !ok {
+			return "", errors.New("not stored on disk")
+		}
+		return "ok", f.Close()
+	})
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newMultipartRequest(c, nil, uploadFile{"photos", "1.jpg", "image/jpeg", "on disk"}))
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+
+	// the temporary file is removed after the response
+	_, err := photo.Open()
+	c.Assert(os.IsNotExist(err), IsTrue)
+}
+
+func (s *multipartSuite) TestIllegalFileTag(c *C) {
+	type illegal struct {
+		Avatar string `file:"avatar"`
+	}
+	c.Assert(func() {
+		NewGroup().Wrap(func(*illegal) (string, error) { return "", nil })
+	}, PanicMatches, "file tag only support .*")
+}
+
+func (s *multipartSuite) TestMatchContentType(c *C) {
+	c.Assert(matchContentType("image/png", nil), IsTrue)
+	c.Assert(matchContentType("image/png", []string{"image/*"}), IsTrue)
+	c.Assert(matchContentType("text/plain; charset=utf-8", []string{"text/plain"}), IsTrue)
+	c.Assert(matchContentType("text/plain", []string{"image/*"}), IsFalse)
+}
@@ -0,0 +1,13 @@
+module github.com/pingcap/fn/otelfn
+
+go 1.16
+
+require (
+	github.com/pingcap/check v0.0.0-20200212061837-5e12011dc712
+	github.com/pingcap/fn v0.0.0
+	go.opentelemetry.io/otel v1.7.0
+	go.opentelemetry.io/otel/sdk v1.7.0
+	go.opentelemetry.io/otel/trace v1.7.0
+)
+
+replace github.com/pingcap/fn => ../
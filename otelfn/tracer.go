@@ -0,0 +1,104 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package otelfn adapts OpenTelemetry tracing to fn
+//
+// e.g:
+//
+//	fn.SetTracer(otelfn.NewTracer(otelfn.Options{}))
+package otelfn
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pingcap/fn"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/pingcap/fn/otelfn"
+
+// Options options of NewTracer
+type Options struct {
+	// TracerProvider default is otel.GetTracerProvider()
+	TracerProvider trace.TracerProvider
+	// Propagator extracts the remote parent from request headers, default
+	// is the W3C trace context propagator
+	Propagator propagation.TextMapPropagator
+}
+
+type tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+type span struct {
+	span   trace.Span
+	server bool
+}
+
+// NewTracer returns a fn.Tracer starts OpenTelemetry spans, the server span
+// of request continues the trace of the `traceparent` header
+func NewTracer(opts Options) fn.Tracer {
+	if opts.TracerProvider == nil {
+		opts.TracerProvider = otel.GetTracerProvider()
+	}
+	if opts.Propagator == nil {
+		opts.Propagator = propagation.TraceContext{}
+	}
+	return &tracer{
+		tracer:     opts.TracerProvider.Tracer(instrumentationName),
+		propagator: opts.Propagator,
+	}
+}
+
+func (t *tracer) Start(ctx context.Context, name string, r *http.Request) (context.Context, fn.Span) {
+	if r == nil {
+		ctx, s := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindInternal))
+		return ctx, &span{span: s}
+	}
+	ctx = t.propagator.Extract(ctx, propagation.HeaderCarrier(r.Header))
+	ctx, s := t.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.method", r.Method),
+			attribute.String("http.target", r.URL.RequestURI()),
+		),
+	)
+	return ctx, &span{span: s, server: true}
+}
+
+// SetStatus records the status code, the server errors mark the span failed
+func (s *span) SetStatus(code int) {
+	s.span.SetAttributes(attribute.Int("http.status_code", code))
+	if code >= http.StatusInternalServerError {
+		s.span.SetStatus(codes.Error, http.StatusText(code))
+	}
+}
+
+// RecordError records the error, the client errors responded by the server
+// span are recorded without marking it failed
+func (s *span) RecordError(err error) {
+	s.span.RecordError(err)
+	if !s.server {
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+func (s *span) End() {
+	s.span.End()
+}
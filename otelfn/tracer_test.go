@@ -0,0 +1,112 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otelfn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/fn"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestOtelfn(t *testing.T) {
+	TestingT(t)
+}
+
+type tracerSuite struct {
+	exporter *tracetest.InMemoryExporter
+	group    *fn.Container
+}
+
+var _ = Suite(&tracerSuite{})
+
+func (s *tracerSuite) SetUpTest(c *C) {
+	s.exporter = tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(s.exporter))
+	s.group = fn.New().SetTracer(NewTracer(Options{TracerProvider: provider}))
+}
+
+func (s *tracerSuite) spans() map[string]tracetest.SpanStub {
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range s.exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	return spans
+}
+
+func (s *tracerSuite) TestRemoteParent(c *C) {
+	var handlerSpan trace.SpanContext
+	handler := s.group.Wrap(func(ctx context.Context) (string, error) {
+		handlerSpan = trace.SpanContextFromContext(ctx)
+		return "ok", nil
+	})
+	request, _ := http.NewRequest(http.MethodGet, "/hello?a=1", nil)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	spans := s.exporter.GetSpans()
+	c.Assert(spans, HasLen, 4)
+	root := spans[len(spans)-1]
+	c.Assert(root.SpanKind, Equals, trace.SpanKindServer)
+	c.Assert(root.SpanContext.TraceID().String(), Equals, "4bf92f3577b34da6a3ce929d0e0e4736")
+	c.Assert(root.Parent.SpanID().String(), Equals, "00f067aa0ba902b7")
+	c.Assert(root.Parent.IsRemote(), IsTrue)
+	c.Assert(root.Status.Code, Equals, codes.Unset)
+	c.Assert(root.Attributes, DeepEquals, []attribute.KeyValue{
+		attribute.String("http.method", "GET"),
+		attribute.String("http.target", "/hello?a=1"),
+		attribute.Int("http.status_code", 200),
+	})
+
+	named := s.spans()
+	for _, name := range []string{fn.SpanAuthorize, fn.SpanHandler, fn.SpanEncode} {
+		c.Assert(named[name].Parent.SpanID(), Equals, root.SpanContext.SpanID())
+		c.Assert(named[name].SpanKind, Equals, trace.SpanKindInternal)
+	}
+	c.Assert(handlerSpan.SpanID(), Equals, named[fn.SpanHandler].SpanContext.SpanID())
+}
+
+func (s *tracerSuite) TestErrors(c *C) {
+	clientErr := s.group.Wrap(func() (string, error) {
+		return "", errors.New("bad request")
+	})
+	serverErr := s.group.Wrap(func() (string, error) {
+		return "", fn.ErrorWithStatusCode(errors.New("broken"), http.StatusInternalServerError)
+	})
+	request, _ := http.NewRequest(http.MethodGet, "/", nil)
+
+	clientErr.ServeHTTP(httptest.NewRecorder(), request)
+	spans := s.exporter.GetSpans()
+	root := spans[len(spans)-1]
+	c.Assert(root.Parent.IsValid(), IsFalse)
+	c.Assert(root.Status.Code, Equals, codes.Unset)
+	c.Assert(root.Events, HasLen, 1)
+	c.Assert(root.Events[0].Name, Equals, "exception")
+	c.Assert(s.spans()[fn.SpanHandler].Status, DeepEquals, sdktrace.Status{Code: codes.Error, Description: "bad request"})
+
+	s.exporter.Reset()
+	serverErr.ServeHTTP(httptest.NewRecorder(), request)
+	spans = s.exporter.GetSpans()
+	root = spans[len(spans)-1]
+	c.Assert(root.Status, DeepEquals, sdktrace.Status{Code: codes.Error, Description: "Internal Server Error"})
+}
@@ -0,0 +1,211 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+)
+
+// ErrBrokerClosed returned if the broker is closed
+var ErrBrokerClosed = errors.New("broker closed")
+
+// defaultMaxAttempts the deliveries of a message before it is dead-lettered
+const defaultMaxAttempts = 10
+
+// Message a transport neutral message of queues, the header and payload are
+// bound to the handler like the header and body of http request
+type Message struct {
+	ID      string
+	Topic   string
+	Header  http.Header
+	Payload []byte
+	// Attempt the delivery count of message, starts from 1
+	Attempt int
+}
+
+// Delivery a message delivered by broker, it should be acknowledged once
+type Delivery interface {
+	Message() *Message
+	// Ack acknowledges the message is processed
+	Ack() error
+	// Nack rejects the message, the message is delivered again if requeue
+	Nack(requeue bool) error
+}
+
+// Broker delivers the messages of topics
+type Broker interface {
+	// Consume returns the deliveries of topic, the channel is closed after
+	// ctx is done
+	Consume(ctx context.Context, topic string) (<-chan Delivery, error)
+	// Publish sends the message to topic
+	Publish(ctx context.Context, topic string, msg *Message) error
+}
+
+type messageKey struct{}
+
+// MessageFromContext returns the message dispatched to handler
+func MessageFromContext(ctx context.Context) (*Message, bool) {
+	msg, ok := ctx.Value(messageKey{}).(*Message)
+	return msg, ok
+}
+
+// Dispatcher dispatches the messages of topics to the handlers wrapped by the
+// container, the plugins, authorization and timeout of handlers are applied
+//
+// The returned error decides the acknowledgement, nil acks the message, the
+// error with status code 4xx nacks the message without requeue because the
+// message can not succeed, and other errors nack the message with requeue
+// until it reaches the max attempts. The panic of handler is an error with
+// status code 500
+//
+// e.g:
+//
+//	d := fn.NewDispatcher(fn.NewGroup())
+//	d.Register("user.created", sendWelcomeMail)
+//	err := d.Run(ctx, broker)
+type Dispatcher struct {
+	container   *Container
+	handlers    map[string]*fn
+	maxAttempts int
+}
+
+// NewDispatcher returns an empty dispatcher, a message is dead-lettered after
+// 10 attempts
+func NewDispatcher(c *Container) *Dispatcher {
+	return &Dispatcher{container: c, handlers: map[string]*fn{}, maxAttempts: defaultMaxAttempts}
+}
+
+// MaxAttempts set the deliveries of a message before it is nacked without
+// requeue, 0 requeues the message without limit
+func (d *Dispatcher) MaxAttempts(n int) *Dispatcher {
+	d.maxAttempts = n
+	return d
+}
+
+// Register registers f to topic, f is a handler wrapped by fn or a function
+// wrapped by the container, it panics if the topic is registered
+func (d *Dispatcher) Register(topic string, f interface{}) *Dispatcher {
+	if _, ok := d.handlers[topic]; ok {
+		panic("topic " + topic + " is registered")
+	}
+	ff, ok := f.(*fn)
+	if !ok {
+		ff = d.container.Wrap(f).(*fn)
+	}
+	d.handlers[topic] = ff
+	return d
+}
+
+// Dispatch invokes the handler of message topic, the message is bound as a
+// POST request to `/{topic}` with the message header, the payload is json
+// unless the `Content-Type` header says otherwise
+func (d *Dispatcher) Dispatch(ctx context.Context, msg *Message) (interface{}, error) {
+	f, ok := d.handlers[msg.Topic]
+	if !ok {
+		return nil, ErrorWithStatusCode(errors.New("no handler of topic "+msg.Topic), http.StatusNotFound)
+	}
+	r, err := http.NewRequest(http.MethodPost, "/"+url.PathEscape(msg.Topic), bytes.NewReader(msg.Payload))
+	if err != nil {
+		return nil, ErrorWithStatusCode(err, http.StatusBadRequest)
+	}
+	for k, vs := range msg.Header {
+		for _, v := range vs {
+			r.Header.Add(k, v)
+		}
+	}
+	if r.Header.Get("Content-Type") == "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	r = r.WithContext(context.WithValue(ctx, messageKey{}, msg))
+	return f.invokeWith(nil, r, func(typ reflect.Type) (reflect.Value, error) {
+		return bindMessage(f.container, r, typ)
+	})
+}
+
+// bindMessage decode the payload like the request body, the malformed payload
+// is reported as a bad request so that it is not requeued
+func bindMessage(c *Container, r *http.Request, typ reflect.Type) (reflect.Value, error) {
+	value := reflect.New(typ.Elem())
+	err := c.decodeBody(r, value)
+	if err == nil {
+		err = bindCookies(r, value)
+	}
+	if err != nil {
+		if _, ok := UnwrapErrorStatusCode(err); !ok {
+			err = ErrorWithStatusCode(err, http.StatusBadRequest)
+		}
+	}
+	return value, err
+}
+
+// Run consumes the registered topics until ctx is done, the messages of a
+// topic are dispatched in order, the error of Consume is returned
+func (d *Dispatcher) Run(ctx context.Context, b Broker) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for topic := range d.handlers {
+		deliveries, err := b.Consume(ctx, topic)
+		if err != nil {
+			cancel()
+			wg.Wait()
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for delivery := range deliveries {
+				_ = d.handle(ctx, delivery)
+			}
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// handle dispatches the delivery and acknowledges it by the error
+func (d *Dispatcher) handle(ctx context.Context, delivery Delivery) error {
+	msg := delivery.Message()
+	err := d.dispatchRecovered(ctx, msg)
+	if err == nil {
+		return delivery.Ack()
+	}
+	if code, ok := UnwrapErrorStatusCode(err); ok && code >= 400 && code < 500 {
+		return delivery.Nack(false)
+	}
+	if d.maxAttempts > 0 && msg.Attempt >= d.maxAttempts {
+		return delivery.Nack(false)
+	}
+	return delivery.Nack(true)
+}
+
+// dispatchRecovered dispatches the message, the panic is returned as an error
+// so that it does not stop consuming the topic
+func (d *Dispatcher) dispatchRecovered(ctx context.Context, msg *Message) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = ErrorWithStatusCode(fmt.Errorf("panic: %v", p), http.StatusInternalServerError)
+		}
+	}()
+	_, err = d.Dispatch(ctx, msg)
+	return err
+}
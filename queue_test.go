@@ -0,0 +1,204 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+type queueSuite struct{}
+
+var _ = Suite(&queueSuite{})
+
+type userCreated struct {
+	Name string `json:"name"`
+}
+
+func (s *queueSuite) TestDispatch(c *C) {
+	d := NewDispatcher(NewGroup())
+	d.Register("user.created", func(ctx context.Context, header http.Header, event *userCreated) (*userCreated, error) {
+		msg, ok := MessageFromContext(ctx)
+		if !ok || msg.ID != "1" {
+			return nil, errors.New("message not in context")
+		}
+		return &userCreated{Name: event.Name + "@" + header.Get("X-Tenant")}, nil
+	})
+
+	resp, err := d.Dispatch(context.Background(), &Message{
+		ID:      "1",
+		Topic:   "user.created",
+		Header:  http.Header{"X-Tenant": {"pingcap"}},
+		Payload: []byte(`{"name":"fn"}`),
+	})
+	c.Assert(err, IsNil)
+	c.Assert(resp, DeepEquals, &userCreated{Name: "fn@pingcap"})
+
+	_, err = d.Dispatch(context.Background(), &Message{ID: "1", Topic: "user.created", Payload: []byte("{")})
+	code, ok := UnwrapErrorStatusCode(err)
+	c.Assert(ok, IsTrue)
+	c.Assert(code, Equals, http.StatusBadRequest)
+
+	_, err = d.Dispatch(context.Background(), &Message{Topic: "user.deleted"})
+	code, _ = UnwrapErrorStatusCode(err)
+	c.Assert(code, Equals, http.StatusNotFound)
+
+	c.Assert(func() { d.Register("user.created", func() (*userCreated, error) { return nil, nil }) }, PanicMatches, ".*registered")
+}
+
+func (s *queueSuite) TestDispatchPlugin(c *C) {
+	group := NewGroup()
+	group.Plugin(func(ctx context.Context, r *http.Request) (context.Context, error) {
+		if r.Header.Get("Authorization") == "" {
+			return ctx, ErrorWithStatusCode(errors.New("unauthorized"), http.StatusUnauthorized)
+		}
+		return ctx, nil
+	})
+	d := NewDispatcher(group).Register("ping", func() (*userCreated, error) { return nil, nil })
+
+	_, err := d.Dispatch(context.Background(), &Message{Topic: "ping"})
+	code, _ := UnwrapErrorStatusCode(err)
+	c.Assert(code, Equals, http.StatusUnauthorized)
+
+	_, err = d.Dispatch(context.Background(), &Message{Topic: "ping", Header: http.Header{"Authorization": {"token"}}})
+	c.Assert(err, IsNil)
+}
+
+func (s *queueSuite) TestRun(c *C) {
+	var (
+		mu       sync.Mutex
+		attempts = map[string]int{}
+		done     = make(chan struct{}, 8)
+	)
+	d := NewDispatcher(NewGroup())
+	d.Register("order", func(ctx context.Context, event *userCreated) (*userCreated, error) {
+		msg, _ := MessageFromContext(ctx)
+		mu.Lock()
+		attempts[event.Name] = msg.Attempt
+		mu.Unlock()
+		defer func() { done <- struct{}{} }()
+		switch {
+		case event.Name == "invalid":
+			return nil, ErrorWithStatusCode(errors.New("invalid order"), http.StatusUnprocessableEntity)
+		case event.Name == "flaky" && msg.Attempt == 1:
+			return nil, errors.New("database unavailable")
+		}
+		return event, nil
+	})
+
+	broker := NewMemoryBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- d.Run(ctx, broker) }()
+
+	for _, name := range []string{"ok", "invalid", "flaky"} {
+		err := broker.Publish(ctx, "order", &Message{Payload: []byte(`{"name":"` + name + `"}`)})
+		c.Assert(err, IsNil)
+	}
+	// the flaky message is delivered twice
+	for i := 0; i < 4; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			c.Fatal("timeout waiting for deliveries")
+		}
+	}
+	cancel()
+	c.Assert(<-result, IsNil)
+
+	c.Assert(attempts, DeepEquals, map[string]int{"ok": 1, "invalid": 1, "flaky": 2})
+	acked := broker.Acked("order")
+	c.Assert(acked, HasLen, 2)
+	c.Assert(acked[0].ID, Equals, "1")
+	c.Assert(acked[1].ID, Equals, "3")
+	c.Assert(acked[1].Attempt, Equals, 2)
+	dead := broker.Dead("order")
+	c.Assert(dead, HasLen, 1)
+	c.Assert(dead[0].ID, Equals, "2")
+}
+
+func (s *queueSuite) TestMemoryBrokerClosed(c *C) {
+	broker := NewMemoryBroker()
+	c.Assert(broker.Close(), IsNil)
+	c.Assert(broker.Publish(context.Background(), "order", &Message{}), Equals, ErrBrokerClosed)
+	err := NewDispatcher(New()).Register("order", func() (*userCreated, error) { return nil, nil }).Run(context.Background(), broker)
+	c.Assert(err, Equals, ErrBrokerClosed)
+}
+
+func (s *queueSuite) TestMaxAttempts(c *C) {
+	done := make(chan int, 8)
+	d := NewDispatcher(NewGroup()).MaxAttempts(3)
+	d.Register("order", func(ctx context.Context, header http.Header) (*userCreated, error) {
+		msg, _ := MessageFromContext(ctx)
+		defer func() { done <- msg.Attempt }()
+		if header.Get("X-Tenant") != "pingcap" {
+			return nil, errors.New("header not canonicalized")
+		}
+		panic("boom")
+	})
+
+	broker := NewMemoryBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- d.Run(ctx, broker) }()
+
+	err := broker.Publish(ctx, "order", &Message{Header: http.Header{"x-tenant": {"pingcap"}}})
+	c.Assert(err, IsNil)
+	// the panicked message is requeued until it reaches the max attempts
+	for i := 1; i <= 3; i++ {
+		select {
+		case attempt := <-done:
+			c.Assert(attempt, Equals, i)
+		case <-time.After(5 * time.Second):
+			c.Fatal("timeout waiting for deliveries")
+		}
+	}
+	cancel()
+	c.Assert(<-result, IsNil)
+	c.Assert(broker.Acked("order"), HasLen, 0)
+	dead := broker.Dead("order")
+	c.Assert(dead, HasLen, 1)
+	c.Assert(dead[0].Attempt, Equals, 3)
+}
+
+func (s *queueSuite) TestMemoryBrokerRequeueFull(c *C) {
+	broker := NewMemoryBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i := 0; i < 1024; i++ {
+		c.Assert(broker.Publish(ctx, "order", &Message{}), IsNil)
+	}
+	deliveries, err := broker.Consume(ctx, "order")
+	c.Assert(err, IsNil)
+	delivery := <-deliveries
+	// the queue is refilled while the message is processed
+	queue := broker.topic("order").queue
+	for len(queue) < cap(queue) {
+		c.Assert(broker.Publish(ctx, "order", &Message{}), IsNil)
+	}
+
+	nacked := make(chan error, 1)
+	go func() { nacked <- delivery.Nack(true) }()
+	select {
+	case err := <-nacked:
+		c.Assert(err, IsNil)
+	case <-time.After(5 * time.Second):
+		c.Fatal("nack blocked on the full queue")
+	}
+}
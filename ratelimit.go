@@ -0,0 +1,316 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited returned if the request exceeds the rate limit
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// RateLimitRule allows Limit requests per Period
+type RateLimitRule struct {
+	Limit  int
+	Period time.Duration
+	// Burst the capacity of token bucket, default is Limit
+	Burst int
+}
+
+// RateLimitResult the result of taking a request from the limiter
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset the duration until the quota is fully restored
+	Reset time.Duration
+	// RetryAfter the duration until the next request is allowed
+	RetryAfter time.Duration
+}
+
+// RateLimitStore stores the limiter state by key, the implementation should
+// take the request atomically so that the store can be shared by processes
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, rule RateLimitRule) (RateLimitResult, error)
+}
+
+// RateLimitKeyFunc returns the key of request, the requests of the same key
+// share a quota, the empty key is not limited
+type RateLimitKeyFunc func(ctx context.Context, r *http.Request) (string, error)
+
+// RateLimitOptions options of the RateLimit plugin
+type RateLimitOptions struct {
+	Rule RateLimitRule
+	// Name separates the limiters sharing a store
+	Name string
+	// Key default is KeyByIP
+	Key RateLimitKeyFunc
+	// Store default is an in-memory token bucket store of
+	// DefaultRateLimitStoreCapacity keys
+	Store RateLimitStore
+}
+
+// KeyByIP keys the request by the remote IP
+func KeyByIP() RateLimitKeyFunc {
+	return func(_ context.Context, r *http.Request) (string, error) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return r.RemoteAddr, nil
+		}
+		return host, nil
+	}
+}
+
+// KeyByHeader keys the request by the header value, e.g: X-Real-IP
+func KeyByHeader(name string) RateLimitKeyFunc {
+	return func(_ context.Context, r *http.Request) (string, error) {
+		return r.Header.Get(name), nil
+	}
+}
+
+// KeyByRoute keys the request by the method and path
+func KeyByRoute() RateLimitKeyFunc {
+	return func(_ context.Context, r *http.Request) (string, error) {
+		return r.Method + " " + r.URL.Path, nil
+	}
+}
+
+// KeyByPrincipal keys the request by the authenticated principal, the
+// unauthenticated requests fallback to KeyByIP
+func KeyByPrincipal() RateLimitKeyFunc {
+	byIP := KeyByIP()
+	return func(ctx context.Context, r *http.Request) (string, error) {
+		if p, ok := PrincipalFromContext(ctx); ok {
+			return "principal:" + p.Subject, nil
+		}
+		return byIP(ctx, r)
+	}
+}
+
+// RateLimit returns a plugin limits the request rate, the `RateLimit-*`
+// headers are set on the response and 429 with `Retry-After` is responded
+// if the limit is exceeded
+func RateLimit(opts RateLimitOptions) PluginFunc {
+	if opts.Rule.Limit <= 0 || opts.Rule.Period <= 0 {
+		panic("rate limit requires positive limit and period")
+	}
+	if opts.Key == nil {
+		opts.Key = KeyByIP()
+	}
+	if opts.Store == nil {
+		opts.Store = NewTokenBucketStore(DefaultRateLimitStoreCapacity)
+	}
+	return func(ctx context.Context, r *http.Request) (context.Context, error) {
+		key, err := opts.Key(ctx, r)
+		if err != nil {
+			return ctx, err
+		}
+		if key == "" {
+			return ctx, nil
+		}
+		result, err := opts.Store.Take(ctx, opts.Name+"|"+key, opts.Rule)
+		if err != nil {
+			if _, ok := UnwrapErrorStatusCode(err); ok {
+				return ctx, err
+			}
+			return ctx, ErrorWithStatusCode(err, http.StatusInternalServerError)
+		}
+		if header := ResponseHeader(ctx); header != nil {
+			header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+			if !result.Allowed {
+				header.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			}
+		}
+		if !result.Allowed {
+			return ctx, ErrorWithStatusCode(ErrRateLimited, http.StatusTooManyRequests)
+		}
+		return ctx, nil
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// DefaultRateLimitStoreCapacity the default max keys of the in-memory stores
+const DefaultRateLimitStoreCapacity = 65536
+
+// memoryStore the in-memory store base, the idle entries are evicted
+// periodically and the least recently used entry is evicted if the keys
+// exceed the capacity
+type memoryStore struct {
+	mu       sync.Mutex
+	capacity int
+	// ll the entries ordered by the last take, the front is the most recent
+	ll      *list.List
+	entries map[string]*list.Element
+	now     func() time.Time
+	takes   int
+}
+
+type memoryEntry struct {
+	key string
+	// token bucket
+	tokens float64
+	// sliding window
+	window   time.Time
+	previous int
+	current  int
+
+	updated time.Time
+	// idle the entry equals a new one after idle, then it can be evicted
+	idle time.Duration
+}
+
+const memoryStoreSweepInterval = 1024
+
+func newMemoryStore(capacity int) memoryStore {
+	if capacity <= 0 {
+		capacity = DefaultRateLimitStoreCapacity
+	}
+	return memoryStore{capacity: capacity, ll: list.New(), entries: map[string]*list.Element{}, now: time.Now}
+}
+
+// entry returns the entry of key, the caller must hold the lock
+func (m *memoryStore) entry(key string, now time.Time, idle time.Duration, create func() *memoryEntry) *memoryEntry {
+	m.takes++
+	if m.takes%memoryStoreSweepInterval == 0 {
+		for elem := m.ll.Front(); elem != nil; {
+			next := elem.Next()
+			if e := elem.Value.(*memoryEntry); now.Sub(e.updated) > e.idle {
+				m.ll.Remove(elem)
+				delete(m.entries, e.key)
+			}
+			elem = next
+		}
+	}
+	if elem, ok := m.entries[key]; ok {
+		m.ll.MoveToFront(elem)
+		e := elem.Value.(*memoryEntry)
+		e.idle = idle
+		return e
+	}
+	e := create()
+	e.key, e.idle = key, idle
+	m.entries[key] = m.ll.PushFront(e)
+	if m.ll.Len() > m.capacity {
+		oldest := m.ll.Back()
+		m.ll.Remove(oldest)
+		delete(m.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return e
+}
+
+type tokenBucketStore struct {
+	memoryStore
+}
+
+// NewTokenBucketStore returns an in-memory store of token bucket algorithm,
+// the bucket of Burst tokens is refilled at Limit tokens per Period, at most
+// capacity keys are kept, default is DefaultRateLimitStoreCapacity
+func NewTokenBucketStore(capacity int) RateLimitStore {
+	return &tokenBucketStore{newMemoryStore(capacity)}
+}
+
+func (s *tokenBucketStore) Take(_ context.Context, key string, rule RateLimitRule) (RateLimitResult, error) {
+	capacity := float64(rule.Burst)
+	if rule.Burst <= 0 {
+		capacity = float64(rule.Limit)
+	}
+	rate := float64(rule.Limit) / rule.Period.Seconds() // tokens per second
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	// the bucket is full again after refilling from empty
+	e := s.entry(key, now, seconds(capacity/rate), func() *memoryEntry {
+		return &memoryEntry{tokens: capacity, updated: now}
+	})
+	e.tokens = math.Min(capacity, e.tokens+now.Sub(e.updated).Seconds()*rate)
+	e.updated = now
+
+	result := RateLimitResult{Limit: int(capacity)}
+	if e.tokens >= 1 {
+		e.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - e.tokens) / rate)
+	}
+	result.Remaining = int(e.tokens)
+	result.Reset = seconds((capacity - e.tokens) / rate)
+	return result, nil
+}
+
+type slidingWindowStore struct {
+	memoryStore
+}
+
+// NewSlidingWindowStore returns an in-memory store of sliding window
+// algorithm, the count of previous window is weighted by its overlap, at most
+// capacity keys are kept, default is DefaultRateLimitStoreCapacity
+func NewSlidingWindowStore(capacity int) RateLimitStore {
+	return &slidingWindowStore{newMemoryStore(capacity)}
+}
+
+func (s *slidingWindowStore) Take(_ context.Context, key string, rule RateLimitRule) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	window := now.Truncate(rule.Period)
+	// the counts are reset after two windows
+	e := s.entry(key, now, 2*rule.Period, func() *memoryEntry {
+		return &memoryEntry{window: window}
+	})
+	e.updated = now
+	switch {
+	case window.Sub(e.window) >= 2*rule.Period:
+		e.previous, e.current = 0, 0
+	case window.Sub(e.window) >= rule.Period:
+		e.previous, e.current = e.current, 0
+	}
+	e.window = window
+
+	elapsed := now.Sub(window)
+	weight := 1 - elapsed.Seconds()/rule.Period.Seconds()
+	estimated := float64(e.previous)*weight + float64(e.current)
+
+	result := RateLimitResult{Limit: rule.Limit, Reset: rule.Period - elapsed}
+	if estimated+1 <= float64(rule.Limit) {
+		e.current++
+		estimated++
+		result.Allowed = true
+	} else if e.current >= rule.Limit || e.previous == 0 {
+		result.RetryAfter = rule.Period - elapsed
+	} else {
+		// the weight of previous window decreases until a request is allowed
+		need := 1 - (float64(rule.Limit)-float64(e.current)-1)/float64(e.previous)
+		result.RetryAfter = seconds(need*rule.Period.Seconds()) - elapsed
+	}
+	result.Remaining = int(math.Max(0, float64(rule.Limit)-estimated))
+	return result, nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,145 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+type rateLimitSuite struct{}
+
+var _ = Suite(&rateLimitSuite{})
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	return f.now
+}
+
+func (s *rateLimitSuite) TestTokenBucket(c *C) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	store := NewTokenBucketStore(0).(*tokenBucketStore)
+	store.now = clock.Now
+	rule := RateLimitRule{Limit: 2, Period: time.Second}
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		result, err := store.Take(ctx, "k", rule)
+		c.Assert(err, IsNil)
+		c.Assert(result.Allowed, IsTrue)
+		c.Assert(result.Remaining, Equals, 1-i)
+	}
+	result, _ := store.Take(ctx, "k", rule)
+	c.Assert(result.Allowed, IsFalse)
+	c.Assert(result.RetryAfter, Equals, 500*time.Millisecond)
+
+	clock.now = clock.now.Add(500 * time.Millisecond)
+	result, _ = store.Take(ctx, "k", rule)
+	c.Assert(result.Allowed, IsTrue)
+
+	result, _ = store.Take(ctx, "other", rule)
+	c.Assert(result.Allowed, IsTrue)
+}
+
+func (s *rateLimitSuite) TestEviction(c *C) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	store := NewTokenBucketStore(2).(*tokenBucketStore)
+	store.now = clock.Now
+	rule := RateLimitRule{Limit: 1, Period: time.Second, Burst: 10}
+
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		result, _ := store.Take(ctx, "k", rule)
+		c.Assert(result.Allowed, IsTrue)
+	}
+	// the bucket refilling is not evicted after two periods
+	clock.now = clock.now.Add(3 * time.Second)
+	store.takes = memoryStoreSweepInterval - 1
+	result, _ := store.Take(ctx, "k", rule)
+	c.Assert(result.Remaining, Equals, 2)
+
+	// the full bucket is evicted
+	clock.now = clock.now.Add(11 * time.Second)
+	store.takes = memoryStoreSweepInterval - 1
+	_, _ = store.Take(ctx, "other", rule)
+	c.Assert(store.entries, HasLen, 1)
+
+	// the least recently used key is evicted over the capacity
+	_, _ = store.Take(ctx, "k", rule)
+	_, _ = store.Take(ctx, "third", rule)
+	c.Assert(store.entries, HasLen, 2)
+	_, ok := store.entries["other"]
+	c.Assert(ok, IsFalse)
+}
+
+func (s *rateLimitSuite) TestSlidingWindow(c *C) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	store := NewSlidingWindowStore(0).(*slidingWindowStore)
+	store.now = clock.Now
+	rule := RateLimitRule{Limit: 4, Period: 10 * time.Second}
+
+	ctx := context.Background()
+	for i := 0; i < 4; i++ {
+		result, _ := store.Take(ctx, "k", rule)
+		c.Assert(result.Allowed, IsTrue)
+	}
+	result, _ := store.Take(ctx, "k", rule)
+	c.Assert(result.Allowed, IsFalse)
+	c.Assert(result.RetryAfter, Equals, 10*time.Second)
+
+	// 4 requests of previous window are weighted by 0.5
+	clock.now = clock.now.Add(15 * time.Second)
+	for i := 0; i < 2; i++ {
+		result, _ = store.Take(ctx, "k", rule)
+		c.Assert(result.Allowed, IsTrue)
+	}
+	result, _ = store.Take(ctx, "k", rule)
+	c.Assert(result.Allowed, IsFalse)
+	c.Assert(result.RetryAfter, Equals, 2500*time.Millisecond)
+}
+
+func (s *rateLimitSuite) TestPlugin(c *C) {
+	group := New()
+	handler := group.Wrap(func() (string, error) { return "ok", nil }).Plugin(RateLimit(RateLimitOptions{
+		Rule: RateLimitRule{Limit: 1, Period: time.Minute},
+		Key:  KeyByHeader("X-Client"),
+	}))
+
+	serve := func(client string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("X-Client", client)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := serve("a")
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("RateLimit-Limit"), Equals, "1")
+	c.Assert(recorder.Header().Get("RateLimit-Remaining"), Equals, "0")
+	c.Assert(recorder.Header().Get("RateLimit-Reset"), Equals, "60")
+
+	recorder = serve("a")
+	c.Assert(recorder.Code, Equals, http.StatusTooManyRequests)
+	c.Assert(recorder.Header().Get("Retry-After"), Equals, "60")
+
+	c.Assert(serve("b").Code, Equals, http.StatusOK)
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestID the ID of request injected by RequestIDPlugin
+type RequestID string
+
+// RequestIDOptions options of RequestIDPlugin
+type RequestIDOptions struct {
+	// Header the request and response header, default is `X-Request-ID`
+	Header string
+	// Generate generates the ID if the request carries no valid ID, default
+	// generates 16 random bytes in hex
+	Generate func() string
+	// IgnoreIncoming always generates the ID instead of reading the header
+	IgnoreIncoming bool
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carries the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, RequestID(id))
+}
+
+// RequestIDFromContext returns the request ID stored by RequestIDPlugin, it
+// is available to ErrorEncoder and ResponseEncoder
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(RequestID)
+	return string(id), ok
+}
+
+func generateRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// validRequestID rejects the incoming ID which is too long or contains
+// characters other than printable ASCII
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestIDPlugin returns a plugin reads or generates the request ID, stores
+// it in the context, injects it as RequestID parameter and echoes it on the
+// response header. The header carries the ID of every response including the
+// failures of later plugins, authorization, handler and timeout, whatever the
+// error encoder is, so the plugin should be registered first
+func RequestIDPlugin(opts RequestIDOptions) PluginFunc {
+	if opts.Header == "" {
+		opts.Header = "X-Request-ID"
+	}
+	if opts.Generate == nil {
+		opts.Generate = generateRequestID
+	}
+	return func(ctx context.Context, r *http.Request) (context.Context, error) {
+		var id string
+		if !opts.IgnoreIncoming {
+			id = r.Header.Get(opts.Header)
+		}
+		if !validRequestID(id) {
+			id = opts.Generate()
+		}
+		if state := requestStateFromContext(ctx); state != nil {
+			state.header.Set(opts.Header, id)
+			state.info.RequestID = id
+		}
+		return WithRequestID(ctx, id), nil
+	}
+}
+
+func requestIDValuer(ctx context.Context, _ *http.Request) (RequestID, error) {
+	id, _ := RequestIDFromContext(ctx)
+	return RequestID(id), nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+type requestIDSuite struct{}
+
+var _ = Suite(&requestIDSuite{})
+
+func (s *requestIDSuite) TestRequestID(c *C) {
+	group := New()
+	group.RequestPlugin(requestIDValuer)
+	group.Plugin(RequestIDPlugin(RequestIDOptions{}))
+	handler := group.Wrap(func(id RequestID) (RequestID, error) {
+		return id, nil
+	})
+
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest(http.MethodGet, "/", nil)
+	handler.ServeHTTP(recorder, request)
+	id := recorder.Header().Get("X-Request-ID")
+	c.Assert(id, HasLen, 32)
+	c.Assert(recorder.Body.String(), Equals, "\""+id+"\"\n")
+
+	recorder = httptest.NewRecorder()
+	request.Header.Set("X-Request-ID", "abc-123")
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Header().Get("X-Request-ID"), Equals, "abc-123")
+
+	recorder = httptest.NewRecorder()
+	request.Header.Set("X-Request-ID", "bad id")
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Header().Get("X-Request-ID"), HasLen, 32)
+}
+
+func (s *requestIDSuite) TestFailureHeader(c *C) {
+	// the response header carries the ID of the failures of default encoder
+	group := New()
+	group.Plugin(RequestIDPlugin(RequestIDOptions{Generate: func() string { return "generated" }}))
+	group.Plugin(func(ctx context.Context, r *http.Request) (context.Context, error) {
+		if r.URL.Path == "/denied" {
+			return ctx, ErrorWithStatusCode(errors.New("denied"), http.StatusUnauthorized)
+		}
+		return ctx, nil
+	})
+	group.SetErrorEncoder(defaultErrorEncoder)
+	failed := group.Wrap(func() (string, error) {
+		return "", ErrorWithStatusCode(errors.New("not found"), http.StatusNotFound)
+	})
+	slow := group.Wrap(func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}).Timeout(10 * time.Millisecond)
+
+	for _, tc := range []struct {
+		path    string
+		handler http.Handler
+		status  int
+	}{
+		{"/denied", failed, http.StatusUnauthorized},
+		{"/", failed, http.StatusNotFound},
+		{"/", slow, http.StatusGatewayTimeout},
+	} {
+		recorder := httptest.NewRecorder()
+		tc.handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		c.Assert(recorder.Code, Equals, tc.status)
+		c.Assert(recorder.Header().Get("X-Request-ID"), Equals, "generated")
+		c.Assert(recorder.Body.String(), Not(Equals), "")
+	}
+}
+
+func (s *requestIDSuite) TestErrorEnvelope(c *C) {
+	group := New()
+	group.Plugin(RequestIDPlugin(RequestIDOptions{Generate: func() string { return "generated" }}))
+	group.SetErrorEncoder(EnvelopeErrorEncoder)
+	handler := group.Wrap(func() (string, error) {
+		return "", ErrorWithStatusCode(errors.New("not found"), http.StatusNotFound)
+	})
+
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest(http.MethodGet, "/", nil)
+	handler.ServeHTTP(recorder, request)
+	var envelope ErrorEnvelope
+	c.Assert(json.Unmarshal(recorder.Body.Bytes(), &envelope), IsNil)
+	c.Assert(envelope, DeepEquals, ErrorEnvelope{Code: http.StatusNotFound, Message: "not found", RequestID: "generated"})
+}
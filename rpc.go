@@ -0,0 +1,240 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	RPCParseError     = -32700
+	RPCInvalidRequest = -32600
+	RPCMethodNotFound = -32601
+	RPCInvalidParams  = -32602
+	RPCInternalError  = -32603
+	// RPCServerError the code of errors returned by handlers
+	RPCServerError = -32000
+)
+
+const rpcVersion = "2.0"
+
+// RPCError the JSON-RPC error object, the handler returns it to respond the
+// code and data as is
+type RPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return e.Message
+}
+
+// rpcErrorData the data of error converted from the handler error
+type rpcErrorData struct {
+	Status int `json:"status"`
+}
+
+type rpcRequest struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type rpcResponse struct {
+	Version string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// RPC a JSON-RPC 2.0 endpoint dispatches the calls to the handlers wrapped
+// by the container, the plugins, authorization and timeout of handlers are
+// applied, and the `params` is bound to the customized type
+//
+// The response headers and sessions changed by the handlers are written to
+// the response in the order of calls, the cookies of all calls are sent and
+// other headers of a later call replace the ones of earlier calls. Each call
+// of a batch loads the session from the request, so it does not see the
+// session changed by an earlier call
+//
+// e.g:
+//
+//	rpc := fn.NewRPC(fn.NewGroup())
+//	rpc.Register("user.login", login)
+//	http.Handle("/rpc", rpc)
+type RPC struct {
+	container *Container
+	methods   map[string]*fn
+}
+
+// NewRPC returns an empty JSON-RPC endpoint
+func NewRPC(c *Container) *RPC {
+	return &RPC{container: c, methods: map[string]*fn{}}
+}
+
+// Register registers f by method name, f is a handler wrapped by fn or a
+// function wrapped by the container, it panics if the method is registered
+func (rpc *RPC) Register(method string, f interface{}) *RPC {
+	if _, ok := rpc.methods[method]; ok {
+		panic("rpc method " + method + " is registered")
+	}
+	ff, ok := f.(*fn)
+	if !ok {
+		ff = rpc.container.Wrap(f).(*fn)
+	}
+	rpc.methods[method] = ff
+	return rpc
+}
+
+// ServeHTTP dispatches the single or batch request, the notifications are
+// not responded and 204 is responded if there is no response
+func (rpc *RPC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeRPC(w, rpcFailure(nil, &RPCError{Code: RPCParseError, Message: err.Error()}))
+		return
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil {
+			writeRPC(w, rpcFailure(nil, &RPCError{Code: RPCParseError, Message: err.Error()}))
+			return
+		}
+		if len(batch) == 0 {
+			writeRPC(w, rpcFailure(nil, &RPCError{Code: RPCInvalidRequest, Message: "empty batch"}))
+			return
+		}
+		responses := make([]*rpcResponse, 0, len(batch))
+		for _, raw := range batch {
+			if resp := rpc.call(w, r, raw); resp != nil {
+				responses = append(responses, resp)
+			}
+		}
+		if len(responses) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeRPC(w, responses)
+		return
+	}
+	if resp := rpc.call(w, r, body); resp != nil {
+		writeRPC(w, resp)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// call dispatches a request, nil is returned for notifications, the response
+// header and session changed by the handler are written to w
+func (rpc *RPC) call(w http.ResponseWriter, r *http.Request, raw json.RawMessage) *rpcResponse {
+	var req rpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		if _, ok := err.(*json.SyntaxError); ok {
+			return rpcFailure(nil, &RPCError{Code: RPCParseError, Message: err.Error()})
+		}
+		return rpcFailure(nil, &RPCError{Code: RPCInvalidRequest, Message: err.Error()})
+	}
+	if req.Version != rpcVersion || req.Method == "" {
+		return rpcFailure(req.ID, &RPCError{Code: RPCInvalidRequest, Message: "invalid request"})
+	}
+	notification := req.ID == nil
+
+	f, ok := rpc.methods[req.Method]
+	if !ok {
+		if notification {
+			return nil
+		}
+		return rpcFailure(req.ID, &RPCError{Code: RPCMethodNotFound, Message: "method not found: " + req.Method})
+	}
+	cr := r.WithContext(r.Context())
+	cr.Body = http.NoBody
+	result, err := f.invokeWith(w, cr, bindParams(req.Params))
+	if notification {
+		return nil
+	}
+	if err != nil {
+		return rpcFailure(req.ID, toRPCError(err))
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return rpcFailure(req.ID, &RPCError{Code: RPCInternalError, Message: err.Error()})
+	}
+	return &rpcResponse{Version: rpcVersion, Result: data, ID: req.ID}
+}
+
+// bindParams decodes the params to the customized type, the by-position
+// params is accepted if it contains one object
+func bindParams(params json.RawMessage) func(reflect.Type) (reflect.Value, error) {
+	return func(typ reflect.Type) (reflect.Value, error) {
+		value := reflect.New(typ.Elem())
+		data := bytes.TrimSpace(params)
+		if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+			return value, nil
+		}
+		if data[0] == '[' {
+			var positional []json.RawMessage
+			if err := json.Unmarshal(data, &positional); err != nil || len(positional) != 1 {
+				return value, &RPCError{Code: RPCInvalidParams, Message: "params should be an object or an array of one object"}
+			}
+			data = positional[0]
+		}
+		if err := json.Unmarshal(data, value.Interface()); err != nil {
+			return value, &RPCError{Code: RPCInvalidParams, Message: err.Error()}
+		}
+		return value, nil
+	}
+}
+
+// toRPCError converts the handler error, the status code of the error is
+// carried by the data
+func toRPCError(err error) *RPCError {
+	for e := err; e != nil; e = Unwrap(e) {
+		if rpcErr, ok := e.(*RPCError); ok {
+			return rpcErr
+		}
+	}
+	status := http.StatusBadRequest
+	if v, ok := UnwrapErrorStatusCode(err); ok {
+		status = v
+	}
+	code := RPCServerError
+	if status >= http.StatusInternalServerError {
+		code = RPCInternalError
+	}
+	return &RPCError{Code: code, Message: err.Error(), Data: &rpcErrorData{Status: status}}
+}
+
+func rpcFailure(id json.RawMessage, err *RPCError) *rpcResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &rpcResponse{Version: rpcVersion, Error: err, ID: id}
+}
+
+func writeRPC(w http.ResponseWriter, v interface{}) {
+	body, err := encodeJSON(v)
+	if err != nil {
+		body, _ = encodeJSON(rpcFailure(nil, &RPCError{Code: RPCInternalError, Message: err.Error()}))
+	}
+	_, _ = w.Write(body)
+}
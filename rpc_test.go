@@ -0,0 +1,183 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+type rpcSuite struct {
+	rpc      *RPC
+	notified int
+}
+
+var _ = Suite(&rpcSuite{})
+
+type rpcAddRequest struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+func (s *rpcSuite) SetUpTest(c *C) {
+	s.notified = 0
+	s.rpc = NewRPC(NewGroup())
+	s.rpc.Register("add", func(req *rpcAddRequest) (int, error) {
+		return req.A + req.B, nil
+	})
+	s.rpc.Register("notify", func() (*struct{}, error) {
+		s.notified++
+		return nil, nil
+	})
+	s.rpc.Register("region", func(ctx context.Context, header http.Header) (string, error) {
+		return header.Get("X-Region"), nil
+	})
+	s.rpc.Register("fail", func() (string, error) {
+		return "", ErrorWithStatusCode(errors.New("gone"), http.StatusGone)
+	})
+	s.rpc.Register("broken", func() (string, error) {
+		return "", ErrorWithStatusCode(errors.New("broken"), http.StatusInternalServerError)
+	})
+	s.rpc.Register("custom", func() (string, error) {
+		return "", &RPCError{Code: 42, Message: "custom", Data: "detail"}
+	})
+	s.rpc.Register("admin", Wrap(func() (string, error) { return "ok", nil }).Require("admin"))
+}
+
+func (s *rpcSuite) post(c *C, body string) *httptest.ResponseRecorder {
+	request, err := http.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body))
+	c.Assert(err, IsNil)
+	request.Header.Set("X-Region", "cn")
+	recorder := httptest.NewRecorder()
+	s.rpc.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (s *rpcSuite) TestCall(c *C) {
+	cases := []struct {
+		req  string
+		resp string
+	}{
+		{`{"jsonrpc":"2.0","method":"add","params":{"a":1,"b":2},"id":1}`, `{"jsonrpc":"2.0","result":3,"id":1}`},
+		{`{"jsonrpc":"2.0","method":"add","params":[{"a":2,"b":2}],"id":"x"}`, `{"jsonrpc":"2.0","result":4,"id":"x"}`},
+		{`{"jsonrpc":"2.0","method":"add","id":2}`, `{"jsonrpc":"2.0","result":0,"id":2}`},
+		{`{"jsonrpc":"2.0","method":"notify","id":3}`, `{"jsonrpc":"2.0","result":null,"id":3}`},
+		{`{"jsonrpc":"2.0","method":"region","id":4}`, `{"jsonrpc":"2.0","result":"cn","id":4}`},
+		{`{"jsonrpc":"2.0","method":"add","params":[1,2],"id":5}`, `{"jsonrpc":"2.0","error":{"code":-32602,"message":"params should be an object or an array of one object"},"id":5}`},
+		{`{"jsonrpc":"2.0","method":"add","params":{"a":"x"},"id":6}`, `{"jsonrpc":"2.0","error":{"code":-32602,"message":"json: cannot unmarshal string into Go struct field rpcAddRequest.a of type int"},"id":6}`},
+		{`{"jsonrpc":"2.0","method":"fail","id":7}`, `{"jsonrpc":"2.0","error":{"code":-32000,"message":"gone","data":{"status":410}},"id":7}`},
+		{`{"jsonrpc":"2.0","method":"broken","id":8}`, `{"jsonrpc":"2.0","error":{"code":-32603,"message":"broken","data":{"status":500}},"id":8}`},
+		{`{"jsonrpc":"2.0","method":"custom","id":9}`, `{"jsonrpc":"2.0","error":{"code":42,"message":"custom","data":"detail"},"id":9}`},
+		{`{"jsonrpc":"2.0","method":"admin","id":10}`, `{"jsonrpc":"2.0","error":{"code":-32000,"message":"unauthenticated","data":{"status":401}},"id":10}`},
+		{`{"jsonrpc":"2.0","method":"missing","id":11}`, `{"jsonrpc":"2.0","error":{"code":-32601,"message":"method not found: missing"},"id":11}`},
+		{`{"jsonrpc":"1.0","method":"add","id":12}`, `{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request"},"id":12}`},
+		{`{"jsonrpc":"2.0","method":1}`, `{"jsonrpc":"2.0","error":{"code":-32600,"message":"json: cannot unmarshal number into Go struct field rpcRequest.method of type string"},"id":null}`},
+		{`{"jsonrpc"`, `{"jsonrpc":"2.0","error":{"code":-32700,"message":"unexpected end of JSON input"},"id":null}`},
+		{`[]`, `{"jsonrpc":"2.0","error":{"code":-32600,"message":"empty batch"},"id":null}`},
+	}
+	for _, cas := range cases {
+		recorder := s.post(c, cas.req)
+		c.Assert(recorder.Code, Equals, http.StatusOK)
+		c.Assert(strings.TrimSpace(recorder.Body.String()), Equals, cas.resp, Commentf(cas.req))
+	}
+}
+
+func (s *rpcSuite) TestBatch(c *C) {
+	recorder := s.post(c, `[
+		{"jsonrpc":"2.0","method":"add","params":{"a":1,"b":1},"id":1},
+		{"jsonrpc":"2.0","method":"notify"},
+		1,
+		{"jsonrpc":"2.0","method":"missing","id":2}
+	]`)
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(strings.TrimSpace(recorder.Body.String()), Equals, `[`+
+		`{"jsonrpc":"2.0","result":2,"id":1},`+
+		`{"jsonrpc":"2.0","error":{"code":-32600,"message":"json: cannot unmarshal number into Go value of type fn.rpcRequest"},"id":null},`+
+		`{"jsonrpc":"2.0","error":{"code":-32601,"message":"method not found: missing"},"id":2}`+
+		`]`)
+	c.Assert(s.notified, Equals, 1)
+}
+
+func (s *rpcSuite) TestNotification(c *C) {
+	recorder := s.post(c, `{"jsonrpc":"2.0","method":"notify"}`)
+	c.Assert(recorder.Code, Equals, http.StatusNoContent)
+	c.Assert(recorder.Body.Len(), Equals, 0)
+
+	recorder = s.post(c, `[{"jsonrpc":"2.0","method":"notify"},{"jsonrpc":"2.0","method":"missing"}]`)
+	c.Assert(recorder.Code, Equals, http.StatusNoContent)
+	c.Assert(s.notified, Equals, 2)
+}
+
+func (s *rpcSuite) TestRegister(c *C) {
+	c.Assert(func() { s.rpc.Register("add", func() (string, error) { return "", nil }) }, PanicMatches, "rpc method add is registered")
+}
+
+func (s *rpcSuite) TestHeaderAndSession(c *C) {
+	group := NewGroup()
+	group.SetSessionProvider(NewCookieSessionProvider(CookieSessionOptions{MaxAge: time.Hour}, []byte("secret")))
+	rpc := NewRPC(group)
+	rpc.Register("login", func(ctx context.Context, session Session) (string, error) {
+		session.Set("uid", "42")
+		ResponseHeader(ctx).Set("X-Limit", "login")
+		return "ok", nil
+	})
+	rpc.Register("whoami", func(ctx context.Context, session Session) (string, error) {
+		ResponseHeader(ctx).Set("X-Limit", "whoami")
+		ResponseHeader(ctx).Set("Content-Type", "text/plain")
+		return session.Get("uid"), nil
+	})
+	rpc.Register("limited", func(ctx context.Context) (string, error) {
+		ResponseHeader(ctx).Set("Retry-After", "1")
+		return "", ErrorWithStatusCode(errors.New("too many requests"), http.StatusTooManyRequests)
+	})
+
+	serve := func(body string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body))
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		recorder := httptest.NewRecorder()
+		rpc.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := serve(`{"jsonrpc":"2.0","method":"login","id":1}`)
+	c.Assert(recorder.Header().Get("X-Limit"), Equals, "login")
+	cookies := recorder.Result().Cookies()
+	c.Assert(cookies, HasLen, 1)
+	c.Assert(cookies[0].Name, Equals, "fn_session")
+
+	recorder = serve(`{"jsonrpc":"2.0","method":"whoami","id":1}`, cookies[0])
+	c.Assert(strings.TrimSpace(recorder.Body.String()), Equals, `{"jsonrpc":"2.0","result":"42","id":1}`)
+	c.Assert(recorder.Header().Get("Content-Type"), Equals, "application/json; charset=utf-8")
+
+	// the headers of failed calls are written
+	recorder = serve(`{"jsonrpc":"2.0","method":"limited","id":1}`)
+	c.Assert(recorder.Header().Get("Retry-After"), Equals, "1")
+
+	// the later call of batch replaces the headers and the cookies are appended
+	recorder = serve(`[{"jsonrpc":"2.0","method":"login","id":1},{"jsonrpc":"2.0","method":"whoami","id":2}]`)
+	c.Assert(recorder.Header().Get("X-Limit"), Equals, "whoami")
+	c.Assert(recorder.Result().Cookies(), HasLen, 1)
+	// the session changed by the earlier call is not seen
+	c.Assert(recorder.Body.String(), Matches, `.*"result":"","id":2.*\n`)
+	recorder = serve(`[{"jsonrpc":"2.0","method":"login","id":1},{"jsonrpc":"2.0","method":"login","id":2}]`)
+	c.Assert(recorder.Result().Cookies(), HasLen, 2)
+}
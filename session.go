@@ -0,0 +1,251 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	sessionType = reflect.TypeOf((*Session)(nil)).Elem()
+
+	errNoSessionProvider = errors.New("session provider is not configured")
+)
+
+// Session represents the values of a client session, the mutations made by
+// handler are persisted on the response
+type Session interface {
+	Get(key string) string
+	Set(key, value string)
+	Delete(key string)
+	// Clear remove all values, the session is destroyed if it is empty on save
+	Clear()
+	Keys() []string
+	// Changed reports whether the session was mutated
+	Changed() bool
+}
+
+// SessionProvider load and save the session of request
+type SessionProvider interface {
+	Load(ctx context.Context, r *http.Request) (Session, error)
+	Save(ctx context.Context, w http.ResponseWriter, s Session) error
+}
+
+type mapSession struct {
+	values  map[string]string
+	changed bool
+}
+
+// NewSession returns a session contains values, it is useful for
+// implementing SessionProvider
+func NewSession(values map[string]string) Session {
+	if values == nil {
+		values = map[string]string{}
+	}
+	return &mapSession{values: values}
+}
+
+func (s *mapSession) Get(key string) string {
+	return s.values[key]
+}
+
+func (s *mapSession) Set(key, value string) {
+	s.values[key] = value
+	s.changed = true
+}
+
+func (s *mapSession) Delete(key string) {
+	if _, ok := s.values[key]; ok {
+		delete(s.values, key)
+		s.changed = true
+	}
+}
+
+func (s *mapSession) Clear() {
+	s.values = map[string]string{}
+	s.changed = true
+}
+
+func (s *mapSession) Keys() []string {
+	keys := make([]string, 0, len(s.values))
+	for k := range s.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *mapSession) Changed() bool {
+	return s.changed
+}
+
+// CookieSessionOptions options of the signed cookie session
+type CookieSessionOptions struct {
+	// Name the cookie name, default is `fn_session`
+	Name string
+	// Path the cookie path, default is `/`
+	Path   string
+	Domain string
+	// MaxAge the lifetime of session, 0 means a browser session
+	MaxAge   time.Duration
+	Secure   bool
+	SameSite http.SameSite
+}
+
+type cookieSessionProvider struct {
+	opts CookieSessionOptions
+	keys [][]byte
+}
+
+type cookieSessionPayload struct {
+	Values  map[string]string `json:"v"`
+	Expires int64             `json:"e,omitempty"`
+}
+
+// NewCookieSessionProvider returns a session provider stores the values in
+// a HMAC-SHA256 signed cookie, the first key signs the cookie and all keys
+// verify it, so that the keys can be rotated
+func NewCookieSessionProvider(opts CookieSessionOptions, keys ...[]byte) SessionProvider {
+	if len(keys) == 0 {
+		panic("cookie session requires at least one key")
+	}
+	if opts.Name == "" {
+		opts.Name = "fn_session"
+	}
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	return &cookieSessionProvider{opts: opts, keys: keys}
+}
+
+func (p *cookieSessionProvider) sign(key []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(p.opts.Name + "|" + payload))
+	return mac.Sum(nil)
+}
+
+func (p *cookieSessionProvider) verify(value string) (*cookieSessionPayload, bool) {
+	i := strings.LastIndexByte(value, '.')
+	if i < 0 {
+		return nil, false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(value[i+1:])
+	if err != nil {
+		return nil, false
+	}
+	valid := false
+	for _, key := range p.keys {
+		if hmac.Equal(sig, p.sign(key, value[:i])) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(value[:i])
+	if err != nil {
+		return nil, false
+	}
+	payload := &cookieSessionPayload{}
+	if err := json.Unmarshal(data, payload); err != nil {
+		return nil, false
+	}
+	if payload.Expires > 0 && time.Now().Unix() > payload.Expires {
+		return nil, false
+	}
+	return payload, true
+}
+
+// Load returns an empty session if the cookie is absent, tampered or expired
+func (p *cookieSessionProvider) Load(_ context.Context, r *http.Request) (Session, error) {
+	cookie, err := r.Cookie(p.opts.Name)
+	if err != nil {
+		return NewSession(nil), nil
+	}
+	payload, ok := p.verify(cookie.Value)
+	if !ok {
+		return NewSession(nil), nil
+	}
+	return NewSession(payload.Values), nil
+}
+
+func (p *cookieSessionProvider) Save(_ context.Context, w http.ResponseWriter, s Session) error {
+	if !s.Changed() {
+		return nil
+	}
+	cookie := &http.Cookie{
+		Name:     p.opts.Name,
+		Path:     p.opts.Path,
+		Domain:   p.opts.Domain,
+		Secure:   p.opts.Secure,
+		HttpOnly: true,
+		SameSite: p.opts.SameSite,
+	}
+	keys := s.Keys()
+	if len(keys) == 0 {
+		cookie.MaxAge = -1
+		http.SetCookie(w, cookie)
+		return nil
+	}
+	payload := cookieSessionPayload{Values: make(map[string]string, len(keys))}
+	for _, k := range keys {
+		payload.Values[k] = s.Get(k)
+	}
+	if p.opts.MaxAge > 0 {
+		cookie.MaxAge = int(p.opts.MaxAge / time.Second)
+		payload.Expires = time.Now().Add(p.opts.MaxAge).Unix()
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	value := base64.RawURLEncoding.EncodeToString(data)
+	cookie.Value = value + "." + base64.RawURLEncoding.EncodeToString(p.sign(p.keys[0], value))
+	http.SetCookie(w, cookie)
+	return nil
+}
+
+func sessionValuer(ctx context.Context, c *Container, r *http.Request) (reflect.Value, error) {
+	state := requestStateFromContext(ctx)
+	if c.sessionProvider == nil || state == nil {
+		return reflect.Value{}, ErrorWithStatusCode(errNoSessionProvider, http.StatusInternalServerError)
+	}
+	if state.session == nil {
+		s, err := c.sessionProvider.Load(ctx, r)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		state.session = s
+	}
+	return reflect.ValueOf(state.session), nil
+}
+
+// saveSession persist the session loaded during the request
+func saveSession(ctx context.Context, c *Container, w http.ResponseWriter, state *requestState) error {
+	if state.session == nil {
+		return nil
+	}
+	return c.sessionProvider.Save(ctx, w, state.session)
+}
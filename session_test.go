@@ -0,0 +1,111 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+type sessionSuite struct{}
+
+var _ = Suite(&sessionSuite{})
+
+func (s *sessionSuite) TestCookieSession(c *C) {
+	group := NewGroup()
+	group.SetSessionProvider(NewCookieSessionProvider(CookieSessionOptions{MaxAge: time.Hour}, []byte("secret")))
+	login := group.Wrap(func(session Session) (string, error) {
+		session.Set("uid", "42")
+		return "", nil
+	})
+	logout := group.Wrap(func(session Session) (string, error) {
+		session.Clear()
+		return "", nil
+	})
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodPost, "/login", nil)
+	c.Assert(err, IsNil)
+	login.ServeHTTP(recorder, request)
+	cookies := recorder.Result().Cookies()
+	c.Assert(len(cookies), Equals, 1)
+	c.Assert(cookies[0].Name, Equals, "fn_session")
+	c.Assert(cookies[0].HttpOnly, IsTrue)
+	c.Assert(cookies[0].MaxAge, Equals, 3600)
+
+	var loaded Session
+	whoami := group.Wrap(func(session Session) (string, error) {
+		loaded = session
+		return session.Get("uid"), nil
+	})
+	recorder = httptest.NewRecorder()
+	request, err = http.NewRequest(http.MethodGet, "/whoami", nil)
+	c.Assert(err, IsNil)
+	request.AddCookie(cookies[0])
+	whoami.ServeHTTP(recorder, request)
+	c.Assert(loaded.Get("uid"), Equals, "42")
+	// unchanged session is not written again
+	c.Assert(len(recorder.Result().Cookies()), Equals, 0)
+
+	// tampered cookie yields an empty session
+	recorder = httptest.NewRecorder()
+	request, err = http.NewRequest(http.MethodGet, "/whoami", nil)
+	c.Assert(err, IsNil)
+	request.AddCookie(&http.Cookie{Name: "fn_session", Value: "eyJ2Ijp7InVpZCI6IjEifX0.AAAA"})
+	whoami.ServeHTTP(recorder, request)
+	c.Assert(loaded.Get("uid"), Equals, "")
+
+	recorder = httptest.NewRecorder()
+	request, err = http.NewRequest(http.MethodPost, "/logout", nil)
+	c.Assert(err, IsNil)
+	request.AddCookie(cookies[0])
+	logout.ServeHTTP(recorder, request)
+	cookies = recorder.Result().Cookies()
+	c.Assert(len(cookies), Equals, 1)
+	c.Assert(cookies[0].MaxAge, Equals, -1)
+}
+
+func (s *sessionSuite) TestKeyRotation(c *C) {
+	old := NewCookieSessionProvider(CookieSessionOptions{}, []byte("old"))
+	rotated := NewCookieSessionProvider(CookieSessionOptions{}, []byte("new"), []byte("old"))
+
+	session := NewSession(nil)
+	session.Set("uid", "1")
+	recorder := httptest.NewRecorder()
+	c.Assert(old.Save(context.Background(), recorder, session), IsNil)
+
+	request, err := http.NewRequest(http.MethodGet, "/", nil)
+	c.Assert(err, IsNil)
+	request.AddCookie(recorder.Result().Cookies()[0])
+	loaded, err := rotated.Load(context.Background(), request)
+	c.Assert(err, IsNil)
+	c.Assert(loaded.Get("uid"), Equals, "1")
+}
+
+func (s *sessionSuite) TestNoSessionProvider(c *C) {
+	group := NewGroup()
+	group.SetSessionProvider(nil)
+	handler := group.Wrap(func(session Session) (string, error) {
+		return "", nil
+	})
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/", nil)
+	c.Assert(err, IsNil)
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, Equals, http.StatusInternalServerError)
+}
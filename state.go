@@ -0,0 +1,108 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+)
+
+type requestStateKey struct{}
+
+// requestState the state of a request shared by middlewares, plugins,
+// valuers and fn
+type requestState struct {
+	header  http.Header
+	session Session
+	info    RequestInfo
+	// bind binds the customized type instead of decoding the request body,
+	// it is set by Invoke and RPC
+	bind func(typ reflect.Type) (reflect.Value, error)
+}
+
+// RequestInfo the information of request served by fn, the middlewares
+// read it by RequestInfoFromContext after the next handler returns
+type RequestInfo struct {
+	// Handler the name of wrapped function
+	Handler string
+	// RequestID the ID of RequestIDPlugin
+	RequestID string
+	// Status the status code of response
+	Status int
+	// Bytes the length of response body
+	Bytes int
+	// Err the error responded
+	Err error
+}
+
+func withRequestState(ctx context.Context, f *fn) (context.Context, *requestState) {
+	state := &requestState{info: RequestInfo{Handler: f.name}}
+	return context.WithValue(ctx, requestStateKey{}, state), state
+}
+
+// write the response and record the status and length
+func (s *requestState) write(w http.ResponseWriter, status int, body []byte) {
+	s.info.Status = status
+	s.info.Bytes = len(body)
+	w.WriteHeader(status)
+	if len(body) > 0 {
+		_, _ = w.Write(body)
+	}
+}
+
+// fork returns a copy of state for the handler runs on another goroutine,
+// the response header is copied
+func (s *requestState) fork() *requestState {
+	header := make(http.Header, len(s.header))
+	for k, v := range s.header {
+		header[k] = append([]string(nil), v...)
+	}
+	return &requestState{header: header, session: s.session, info: s.info, bind: s.bind}
+}
+
+// merge the response header and session of forked state
+func (s *requestState) merge(forked *requestState) {
+	for k := range s.header {
+		if _, ok := forked.header[k]; !ok {
+			delete(s.header, k)
+		}
+	}
+	for k, v := range forked.header {
+		s.header[k] = v
+	}
+	s.session = forked.session
+}
+
+func requestStateFromContext(ctx context.Context) *requestState {
+	state, _ := ctx.Value(requestStateKey{}).(*requestState)
+	return state
+}
+
+// ResponseHeader returns the response header of the request handled by fn,
+// plugins and handlers can set headers by it, nil is returned outside fn
+func ResponseHeader(ctx context.Context) http.Header {
+	if state := requestStateFromContext(ctx); state != nil {
+		return state.header
+	}
+	return nil
+}
+
+// RequestInfoFromContext returns the information of request served by fn
+func RequestInfoFromContext(ctx context.Context) (RequestInfo, bool) {
+	if state := requestStateFromContext(ctx); state != nil {
+		return state.info, true
+	}
+	return RequestInfo{}, false
+}
@@ -0,0 +1,151 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrTimeout returned if the handler has not returned before the deadline
+var ErrTimeout = errors.New("handler timeout")
+
+// grpcTimeoutUnits the units of `grpc-timeout` header
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// parseRequestTimeout parse the client supplied timeout, `X-Request-Timeout`
+// accepts a duration such as `1.5s` or the seconds, `grpc-timeout` accepts
+// at most 8 digits followed by an unit such as `100m`
+func parseRequestTimeout(r *http.Request) (time.Duration, bool) {
+	if v := r.Header.Get("X-Request-Timeout"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d, true
+		}
+		if s, err := strconv.ParseFloat(v, 64); err == nil && s > 0 {
+			return seconds(s), true
+		}
+	}
+	if v := r.Header.Get("grpc-timeout"); len(v) >= 2 && len(v) <= 9 {
+		unit, ok := grpcTimeoutUnits[v[len(v)-1]]
+		if !ok {
+			return 0, false
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(v[:len(v)-1]), 10, 64)
+		if err == nil && n > 0 {
+			return time.Duration(n) * unit, true
+		}
+	}
+	return 0, false
+}
+
+// effectiveTimeout returns the timeout of handler, the handler option overrides
+// the container option
+func (f *fn) effectiveTimeout() time.Duration {
+	if f.timeout > 0 {
+		return f.timeout
+	}
+	return f.container.timeout
+}
+
+// withDeadline derive the deadline context of request, the client supplied
+// timeout is capped by the configured timeout
+func (f *fn) withDeadline(ctx context.Context, r *http.Request) (context.Context, context.CancelFunc) {
+	d := f.effectiveTimeout()
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	if v, ok := parseRequestTimeout(r); ok && v < d {
+		d = v
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+type invokeResult struct {
+	payload   interface{}
+	err       error
+	panicked  bool
+	recovered interface{}
+}
+
+// invoke binds the request and calls the handler, 504 is returned if the
+// handler has not returned before the deadline. The request is bound on the
+// serving goroutine, and the handler runs with a private copy of the request
+// state like http.TimeoutHandler, the copy is merged only if the handler
+// returns in time, so an abandoned handler never touches the state of the
+// responded request
+func (f *fn) invoke(ctx context.Context, r *http.Request) (interface{}, error) {
+	call, err := f.adapter.bind(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	state := requestStateFromContext(ctx)
+	if f.effectiveTimeout() <= 0 || state == nil {
+		return call(ctx)
+	}
+
+	private := state.fork()
+	callCtx := context.WithValue(ctx, requestStateKey{}, private)
+	done := make(chan invokeResult, 1)
+	go func() {
+		var result invokeResult
+		defer func() {
+			if p := recover(); p != nil {
+				result.panicked, result.recovered = true, p
+			}
+			done <- result
+		}()
+		result.payload, result.err = call(callCtx)
+	}()
+
+	select {
+	case result := <-done:
+		if result.panicked {
+			// re-panic on the serving goroutine like a handler without timeout
+			panic(result.recovered)
+		}
+		state.merge(private)
+		if result.err != nil && ctx.Err() == context.DeadlineExceeded {
+			if _, ok := UnwrapErrorStatusCode(result.err); !ok {
+				return nil, ErrorWithStatusCode(ErrTimeout, http.StatusGatewayTimeout)
+			}
+		}
+		return result.payload, result.err
+	case <-ctx.Done():
+		// the session is owned by the abandoned handler, it is not saved
+		state.session = nil
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, ErrorWithStatusCode(ErrTimeout, http.StatusGatewayTimeout)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// Timeout returns a handler times out after d, it overrides the container
+// timeout
+func (f *fn) Timeout(d time.Duration) Fn {
+	ff := f.with()
+	ff.timeout = d
+	return ff
+}
@@ -0,0 +1,142 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+type timeoutSuite struct{}
+
+var _ = Suite(&timeoutSuite{})
+
+func (s *timeoutSuite) TestParseRequestTimeout(c *C) {
+	cases := []struct {
+		header, value string
+		expected      time.Duration
+		ok            bool
+	}{
+		{"X-Request-Timeout", "1.5s", 1500 * time.Millisecond, true},
+		{"X-Request-Timeout", "2", 2 * time.Second, true},
+		{"X-Request-Timeout", "-1s", 0, false},
+		{"grpc-timeout", "100m", 100 * time.Millisecond, true},
+		{"grpc-timeout", "1H", time.Hour, true},
+		{"grpc-timeout", "123456789S", 0, false},
+		{"grpc-timeout", "10x", 0, false},
+	}
+	for _, t := range cases {
+		request, _ := http.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set(t.header, t.value)
+		d, ok := parseRequestTimeout(request)
+		c.Assert(ok, Equals, t.ok, Commentf("%s: %s", t.header, t.value))
+		c.Assert(d, Equals, t.expected)
+	}
+}
+
+func (s *timeoutSuite) TestTimeout(c *C) {
+	group := New()
+	group.Timeout(time.Second)
+	var deadline int64 // the handler may outlive the request
+	handler := group.Wrap(func(ctx context.Context) (string, error) {
+		d, ok := ctx.Deadline()
+		c.Assert(ok, IsTrue)
+		atomic.StoreInt64(&deadline, int64(time.Until(d)))
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(20 * time.Millisecond):
+			return "ok", nil
+		}
+	})
+
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest(http.MethodGet, "/", nil)
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(time.Duration(atomic.LoadInt64(&deadline)) > 500*time.Millisecond, IsTrue)
+
+	// the client supplied timeout is shorter
+	recorder = httptest.NewRecorder()
+	request.Header.Set("X-Request-Timeout", "5ms")
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, Equals, http.StatusGatewayTimeout)
+
+	// the client supplied timeout is capped
+	recorder = httptest.NewRecorder()
+	request.Header.Set("X-Request-Timeout", "1h")
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(time.Duration(atomic.LoadInt64(&deadline)) <= time.Second, IsTrue)
+}
+
+func (s *timeoutSuite) TestHandlerIgnoresDeadline(c *C) {
+	release := make(chan struct{})
+	defer close(release)
+	handler := New().Wrap(func() (string, error) {
+		<-release
+		return "late", nil
+	}).Timeout(10 * time.Millisecond)
+
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest(http.MethodGet, "/", nil)
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, Equals, http.StatusGatewayTimeout)
+	c.Assert(recorder.Body.String(), Equals, "\"handler timeout\"\n")
+}
+
+func (s *timeoutSuite) TestPanic(c *C) {
+	handler := New().Wrap(func() (string, error) {
+		panic("boom")
+	}).Timeout(time.Second)
+	request, _ := http.NewRequest(http.MethodGet, "/", nil)
+	c.Assert(func() { handler.ServeHTTP(httptest.NewRecorder(), request) }, PanicMatches, "boom")
+}
+
+func (s *timeoutSuite) TestAbandonedHandler(c *C) {
+	release, done := make(chan struct{}), make(chan struct{})
+	handler := New().Wrap(func(ctx context.Context) (string, error) {
+		ResponseHeader(ctx).Set("X-Early", "1")
+		<-release
+		ResponseHeader(ctx).Set("X-Late", "1")
+		close(done)
+		return "late", nil
+	}).Timeout(10 * time.Millisecond)
+
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest(http.MethodGet, "/", nil)
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, Equals, http.StatusGatewayTimeout)
+	close(release)
+	<-done
+	// the header of abandoned handler is dropped
+	c.Assert(recorder.Header().Get("X-Early"), Equals, "")
+	c.Assert(recorder.Header().Get("X-Late"), Equals, "")
+
+	// the header of handler returns in time is merged
+	handler = New().Wrap(func(ctx context.Context) (string, error) {
+		ResponseHeader(ctx).Set("X-Early", "1")
+		return "ok", nil
+	}).Timeout(time.Second)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("X-Early"), Equals, "1")
+	c.Assert(recorder.Header().Get("Content-Type"), Equals, "application/json; charset=utf-8")
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"net/http"
+)
+
+// Span names of the stages of serving a request, the server span is named
+// by the handler name
+const (
+	SpanPlugin    = "fn.plugin"
+	SpanAuthorize = "fn.authorize"
+	SpanBind      = "fn.bind"
+	SpanHandler   = "fn.handler"
+	SpanEncode    = "fn.encode"
+)
+
+// Tracer starts the spans of serving a request
+type Tracer interface {
+	// Start starts a span as a child of the span in ctx, r is non-nil for the
+	// server span of request, and the tracer should extract the remote parent
+	// from the W3C `traceparent` header of it
+	Start(ctx context.Context, name string, r *http.Request) (context.Context, Span)
+}
+
+// Span an operation started by Tracer
+type Span interface {
+	// SetStatus records the status code of response
+	SetStatus(code int)
+	// RecordError records the error and marks the span failed
+	RecordError(err error)
+	// End finishes the span
+	End()
+}
+
+type noopTracer struct{}
+
+type noopSpan struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string, _ *http.Request) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (noopSpan) SetStatus(int)     {}
+func (noopSpan) RecordError(error) {}
+func (noopSpan) End()              {}
+
+// SetTracer set the tracer of container, default is a no-op tracer
+func (c *Container) SetTracer(t Tracer) *Container {
+	if t == nil {
+		t = noopTracer{}
+	}
+	c.tracer = t
+	return c
+}
+
+// SetTracer set the tracer of global container
+func SetTracer(t Tracer) {
+	globalContainer.SetTracer(t)
+}
+
+// startSpan starts a child span of the span in ctx
+func (c *Container) startSpan(ctx context.Context, name string) (context.Context, Span) {
+	return c.tracer.Start(ctx, name, nil)
+}
+
+// endSpan records the error of stage and finishes the span
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
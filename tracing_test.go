@@ -0,0 +1,126 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	. "github.com/pingcap/check"
+)
+
+type tracingSuite struct{}
+
+var _ = Suite(&tracingSuite{})
+
+type spanKey struct{}
+
+type recordedSpan struct {
+	tracer *recordTracer
+	name   string
+	parent string
+	remote string
+	status int
+	err    error
+}
+
+func (s *recordedSpan) SetStatus(code int)    { s.status = code }
+func (s *recordedSpan) RecordError(err error) { s.err = err }
+func (s *recordedSpan) End() {
+	s.tracer.mu.Lock()
+	s.tracer.ended = append(s.tracer.ended, s)
+	s.tracer.mu.Unlock()
+}
+
+type recordTracer struct {
+	mu    sync.Mutex
+	ended []*recordedSpan
+}
+
+func (t *recordTracer) Start(ctx context.Context, name string, r *http.Request) (context.Context, Span) {
+	span := &recordedSpan{tracer: t, name: name}
+	if parent, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+		span.parent = parent.name
+	}
+	if r != nil {
+		span.remote = r.Header.Get("traceparent")
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func (t *recordTracer) span(name string) *recordedSpan {
+	for _, s := range t.ended {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+type tracingRequest struct {
+	Name string `json:"name"`
+}
+
+func (s *tracingSuite) TestSpans(c *C) {
+	tracer := &recordTracer{}
+	var handlerParent string
+	group := New().SetTracer(tracer)
+	group.Plugin(func(ctx context.Context, r *http.Request) (context.Context, error) {
+		return ctx, nil
+	})
+	handler := group.Wrap(func(ctx context.Context, req *tracingRequest) (string, error) {
+		handlerParent = ctx.Value(spanKey{}).(*recordedSpan).name
+		return "", ErrorWithStatusCode(errors.New("conflict"), http.StatusConflict)
+	})
+	name := handler.(*fn).name
+
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	request, _ := http.NewRequest(http.MethodPost, "/", nil)
+	request.Header.Set("traceparent", traceparent)
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	var names []string
+	for _, span := range tracer.ended {
+		names = append(names, span.name)
+	}
+	c.Assert(names, DeepEquals, []string{SpanPlugin, SpanAuthorize, SpanBind, SpanHandler, SpanEncode, name})
+	for _, span := range tracer.ended[:5] {
+		c.Assert(span.parent, Equals, name)
+	}
+	c.Assert(handlerParent, Equals, SpanHandler)
+	c.Assert(tracer.span(SpanHandler).err, ErrorMatches, "conflict")
+
+	root := tracer.span(name)
+	c.Assert(root.remote, Equals, traceparent)
+	c.Assert(root.status, Equals, http.StatusConflict)
+	c.Assert(root.err, ErrorMatches, "conflict")
+}
+
+func (s *tracingSuite) TestBindError(c *C) {
+	tracer := &recordTracer{}
+	handler := New().SetTracer(tracer).Wrap(func(req *tracingRequest) (string, error) {
+		return req.Name, nil
+	})
+	request, _ := http.NewRequest(http.MethodPost, "/", nil)
+	request.Body = http.NoBody
+	request.ContentLength = 1
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	c.Assert(tracer.span(SpanBind).err, NotNil)
+	c.Assert(tracer.span(SpanHandler), IsNil)
+	c.Assert(tracer.span(handler.(*fn).name).status, Equals, http.StatusBadRequest)
+}
@@ -16,7 +16,6 @@ package fn
 import (
 	"context"
 	"io"
-	"mime/multipart"
 	"net/http"
 	"net/url"
 	"reflect"
@@ -29,6 +28,11 @@ var (
 	requestType = reflect.TypeOf((*http.Request)(nil))
 	errorType   = reflect.TypeOf((*error)(nil)).Elem()
 
+	formType        = reflect.TypeOf(Form{})
+	formPtrType     = reflect.TypeOf((*Form)(nil))
+	postFormType    = reflect.TypeOf(PostForm{})
+	postFormPtrType = reflect.TypeOf((*PostForm)(nil))
+
 	defaultErrorEncoder = func(ctx context.Context, err error) interface{} {
 		return err.Error()
 	}
@@ -38,27 +42,37 @@ var (
 	}
 )
 
-type contextValuer func(ctx context.Context, r *http.Request) (reflect.Value, error)
+type contextValuer func(ctx context.Context, c *Container, r *http.Request) (reflect.Value, error)
 
 // BenchmarkIsBuiltinType-8   	100000000	        23.1 ns/op	       0 B/op	       0 allocs/op
 var supportTypes = []interface{}{
-	bodyValuer,        // request.Body
-	headerValuer,      // request.Header
-	formValuer,        // request.Form
-	postFromValuer,    // request.PostFrom
-	formPtrValuer,     // request.Form
-	postFromPtrValuer, // request.PostFrom
-	urlValuer,         // request.URL
-	multipartValuer,   // request.MultipartForm
-	requestValuer,     // raw request
+	bodyValuer,         // request.Body
+	headerValuer,       // request.Header
+	urlValuer,          // request.URL
+	cookiesValuer,      // request.Cookies
+	cookiesPtrValuer,   // request.Cookies
+	principalValuer,    // authenticated principal
+	principalPtrValuer, // authenticated principal
+	requestIDValuer,    // request ID
+	requestValuer,      // raw request
 }
 
-//var supportRequestTypes = map[reflect.Type]contextValuer{}
+// containerValuers builtin valuers depend on the container configuration
+var containerValuers = map[reflect.Type]contextValuer{
+	formType:          formValuer,        // request.Form
+	postFormType:      postFromValuer,    // request.PostFrom
+	formPtrType:       formPtrValuer,     // request.Form
+	postFormPtrType:   postFromPtrValuer, // request.PostFrom
+	multipartFormType: multipartValuer,   // request.MultipartForm
+	sessionType:       sessionValuer,     // Container.sessionProvider
+}
 
-var maxMemory = int64(2 * 1024 * 1024)
+//var supportRequestTypes = map[reflect.Type]contextValuer{}
 
 type uniform struct {
 	url.Values
+	// maxSliceLen the max slice length of Decode, default if not positive
+	maxSliceLen int
 }
 
 // Form parse `request.Form`
@@ -83,44 +97,51 @@ func headerValuer(_ context.Context, r *http.Request) (http.Header, error) {
 	return r.Header, nil
 }
 
-func multipartValuer(_ context.Context, r *http.Request) (*multipart.Form, error) {
-	err := r.ParseMultipartForm(maxMemory)
-	if err != nil {
-		return nil, err
+// parseForm parse the request form, the parse error is reported as a bad
+// request unless the container is lenient
+func (c *Container) parseForm(r *http.Request) error {
+	err := r.ParseForm()
+	if err == nil {
+		return nil
+	}
+	if !c.lenientForm {
+		return ErrorWithStatusCode(err, http.StatusBadRequest)
 	}
-	return r.MultipartForm, nil
+	if r.Form == nil {
+		r.Form = url.Values{}
+	}
+	if r.PostForm == nil {
+		r.PostForm = url.Values{}
+	}
+	return nil
 }
 
-func formValuer(_ context.Context, r *http.Request) (Form, error) {
-	err := r.ParseForm()
-	if err != nil {
-		return Form{}, nil
+func formValuer(_ context.Context, c *Container, r *http.Request) (reflect.Value, error) {
+	if err := c.parseForm(r); err != nil {
+		return reflect.Value{}, err
 	}
-	return Form{uniform{r.Form}}, nil
+	return reflect.ValueOf(Form{uniform{r.Form, c.maxFormSliceLen}}), nil
 }
 
-func formPtrValuer(_ context.Context, r *http.Request) (*Form, error) {
-	err := r.ParseForm()
-	if err != nil {
-		return nil, nil
+func formPtrValuer(_ context.Context, c *Container, r *http.Request) (reflect.Value, error) {
+	if err := c.parseForm(r); err != nil {
+		return reflect.Value{}, err
 	}
-	return &Form{uniform{r.Form}}, nil
+	return reflect.ValueOf(&Form{uniform{r.Form, c.maxFormSliceLen}}), nil
 }
 
-func postFromValuer(_ context.Context, r *http.Request) (PostForm, error) {
-	err := r.ParseForm()
-	if err != nil {
-		return PostForm{}, nil
+func postFromValuer(_ context.Context, c *Container, r *http.Request) (reflect.Value, error) {
+	if err := c.parseForm(r); err != nil {
+		return reflect.Value{}, err
 	}
-	return PostForm{uniform{r.PostForm}}, nil
+	return reflect.ValueOf(PostForm{uniform{r.PostForm, c.maxFormSliceLen}}), nil
 }
 
-func postFromPtrValuer(_ context.Context, r *http.Request) (*PostForm, error) {
-	err := r.ParseForm()
-	if err != nil {
-		return nil, nil
+func postFromPtrValuer(_ context.Context, c *Container, r *http.Request) (reflect.Value, error) {
+	if err := c.parseForm(r); err != nil {
+		return reflect.Value{}, err
 	}
-	return &PostForm{uniform{r.PostForm}}, nil
+	return reflect.ValueOf(&PostForm{uniform{r.PostForm, c.maxFormSliceLen}}), nil
 }
 
 func requestValuer(_ context.Context, r *http.Request) (*http.Request, error) {
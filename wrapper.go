@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"reflect"
+	"time"
 )
 
 type (
@@ -31,60 +32,200 @@ type (
 	fn struct {
 		container *Container
 		adapter   adapter
+		name      string
+		scopes    []string
+		policies  []namedPolicy
+		timeout   time.Duration
+		cache     string
+		responses *ResponseCache
+		// currentETag resolves the ETag which the preconditions of unsafe
+		// requests are evaluated against
+		currentETag ETagResolver
 	}
 )
 
-func failure(ctx context.Context, c *Container, w http.ResponseWriter, err error) {
+func failure(ctx context.Context, c *Container, w http.ResponseWriter, state *requestState, err error) {
 	statusCode := http.StatusBadRequest
 	if v, ok := UnwrapErrorStatusCode(err); ok {
 		statusCode = v
 	}
-	w.WriteHeader(statusCode)
-	_ = json.NewEncoder(w).Encode(c.errorEncoder(ctx, err))
+	if challenges, ok := UnwrapErrorChallenges(err); ok {
+		for _, c := range challenges {
+			w.Header().Add("WWW-Authenticate", c)
+		}
+	}
+	state.info.Err = err
+	body, e := encodeJSON(c.errorEncoder(ctx, err))
+	if e != nil {
+		statusCode, body = http.StatusInternalServerError, nil
+	}
+	state.write(w, statusCode, body)
 }
 
-func success(ctx context.Context, c *Container, w http.ResponseWriter, data interface{}) {
+func (f *fn) success(ctx context.Context, w http.ResponseWriter, r *http.Request, state *requestState, data interface{}) {
+	c := f.container
 	if reflect.ValueOf(data).Kind() == reflect.Ptr && reflect.ValueOf(data).IsNil() {
-		w.WriteHeader(http.StatusNoContent)
-	} else {
-		_ = json.NewEncoder(w).Encode(c.responseEncoder(ctx, data))
+		f.setCacheControl(w.Header())
+		state.write(w, http.StatusNoContent, nil)
+		return
+	}
+	body, err := encodeJSON(c.responseEncoder(ctx, data))
+	if err != nil {
+		failure(ctx, c, w, state, ErrorWithStatusCode(err, http.StatusInternalServerError))
+		return
+	}
+	status, err := f.conditional(w, r, data, body)
+	if err != nil {
+		failure(ctx, c, w, state, err)
+		return
 	}
+	if status == http.StatusNotModified {
+		body = nil
+	}
+	state.write(w, status, body)
+}
+
+// encodeJSON encode v like json.Encoder, the body ends with a newline
+func encodeJSON(v interface{}) ([]byte, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(body, '\n'), nil
 }
 
 func (f *fn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if opts := f.container.compress; opts != nil {
+		cw := newCompressWriter(w, r, opts)
+		f.serveHTTP(cw, r)
+		// not deferred, the response of panicked handler is aborted
+		_ = cw.Close()
+		return
+	}
+	f.serveHTTP(w, r)
+}
+
+// serveHTTP serve the request through the middlewares
+func (f *fn) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, state := withRequestState(r.Context(), f)
+	middlewares := f.container.middlewares
+	if len(middlewares) == 0 {
+		f.serve(ctx, state, w, r)
+		return
+	}
+	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.serve(r.Context(), state, w, r)
+	})
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	h.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// serve the request with plugins, binding and encoding
+func (f *fn) serve(ctx context.Context, state *requestState, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	var (
-		ctx  = r.Context()
-		err  error
-		resp interface{}
-	)
+	state.header = w.Header()
+	defer removeMultipartFiles(r)
+
+	ctx, span := f.container.tracer.Start(ctx, f.name, r)
+	defer func() {
+		span.SetStatus(state.info.Status)
+		endSpan(span, state.info.Err)
+	}()
+	ctx, cancel := f.withDeadline(ctx, r)
+	defer cancel()
 
+	if f.responses != nil && isCacheable(r) {
+		f.serveCached(ctx, state, w, r)
+		return
+	}
+	ctx, resp, err := f.handle(ctx, r)
+	f.respond(ctx, state, w, r, resp, err)
+}
+
+// respond saves the session and encodes the payload or error
+func (f *fn) respond(ctx context.Context, state *requestState, w http.ResponseWriter, r *http.Request, resp interface{}, err error) {
+	if e := saveSession(ctx, f.container, w, state); e != nil && err == nil {
+		err = e
+	}
+	encodeCtx, encodeSpan := f.container.startSpan(ctx, SpanEncode)
+	if err != nil {
+		failure(encodeCtx, f.container, w, state, err)
+	} else {
+		f.success(encodeCtx, w, r, state, resp)
+	}
+	encodeSpan.End()
+}
+
+// handle runs plugins, authorization, preconditions and the handler, the
+// context derived by plugins is returned for encoding
+func (f *fn) handle(ctx context.Context, r *http.Request) (context.Context, interface{}, error) {
+	ctx, err := f.prepare(ctx, r)
+	if err != nil {
+		return ctx, nil, err
+	}
+	if err := f.checkPrecondition(ctx, r); err != nil {
+		return ctx, nil, err
+	}
+	resp, err := f.invoke(ctx, r)
+	return ctx, resp, err
+}
+
+// prepare runs plugins and authorization, the context derived by plugins is
+// returned
+func (f *fn) prepare(ctx context.Context, r *http.Request) (context.Context, error) {
 	for _, b := range f.container.plugins {
-		ctx, err = b(ctx, r)
+		// the plugin derives the context of request, so the span is not
+		// attached to the context passed to it
+		_, span := f.container.startSpan(ctx, SpanPlugin)
+		next, err := b(ctx, r)
+		endSpan(span, err)
+		if next != nil {
+			ctx = next
+		}
 		if err != nil {
-			failure(ctx, f.container, w, err)
-			return
+			return ctx, err
 		}
 	}
-	resp, err = f.adapter.invoke(ctx, w, r)
-	if err != nil {
-		failure(ctx, f.container, w, err)
-		return
-	}
-	success(ctx, f.container, w, resp)
+	authCtx, span := f.container.startSpan(ctx, SpanAuthorize)
+	err := f.authorize(authCtx, r)
+	endSpan(span, err)
+	return ctx, err
 }
 
-//
 func (f *fn) Plugin(before ...PluginFunc) Fn {
 	ff := f.clone()
 	ff.container.Plugin(before...)
 	return ff
 }
 
+// Use returns a handler wrapped by the middlewares
+func (f *fn) Use(middlewares ...Middleware) Fn {
+	ff := f.clone()
+	ff.container.Use(middlewares...)
+	return ff
+}
+
 func (f *fn) clone() *fn {
 	c := f.container.Clone()
+	ff := f.with()
+	ff.container = c
+	ff.adapter = f.adapter.clone(c)
+	return ff
+}
+
+// with returns a copy of handler shares the container and adapter
+func (f *fn) with() *fn {
 	return &fn{
-		container: c,
-		adapter:   f.adapter.clone(c),
+		container:   f.container,
+		adapter:     f.adapter,
+		name:        f.name,
+		scopes:      append([]string(nil), f.scopes...),
+		policies:    append([]namedPolicy(nil), f.policies...),
+		timeout:     f.timeout,
+		cache:       f.cache,
+		responses:   f.responses,
+		currentETag: f.currentETag,
 	}
 }
@@ -291,6 +291,28 @@ func (s *fnSuite) TestRequestPluginWithContext(c *C) {
 	c.Assert(reflect.DeepEqual(b, []byte("5\n")), IsTrue)
 }
 
+func (s *fnSuite) TestFormParseError(c *C) {
+	newRequest := func() *http.Request {
+		request, err := http.NewRequest(http.MethodPost, "/", bytes.NewBufferString("a=%zz"))
+		c.Assert(err, IsNil)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return request
+	}
+
+	group := NewGroup()
+	handler := group.Wrap(func(form *Form) (string, error) {
+		return form.Get("a"), nil
+	})
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newRequest())
+	c.Assert(recorder.Code, Equals, http.StatusBadRequest)
+
+	group.SetLenientForm(true)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newRequest())
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+}
+
 func BenchmarkSimplePlainAdapterInvoke(b *testing.B) {
 	handler := Wrap(withNone)
 	request, err := http.NewRequest(http.MethodGet, "", nil)
@@ -0,0 +1,324 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	defaultWSMaxMessageSize = int64(1 << 20)
+
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+// WebSocket close codes
+const (
+	WSCloseNormal        = 1000
+	WSCloseProtocolError = 1002
+	WSCloseInvalidData   = 1007
+	WSCloseTooLarge      = 1009
+	WSCloseInternalError = 1011
+)
+
+var (
+	// ErrWSClosed returned if the connection is closed by the peer
+	ErrWSClosed = errors.New("websocket closed")
+	// ErrWSHandshake returned if the request is not a websocket handshake
+	ErrWSHandshake = errors.New("websocket handshake expected")
+	// ErrWSMessageTooLarge returned if the message exceeds the size limit
+	ErrWSMessageTooLarge = errors.New("websocket message too large")
+	// ErrWSOrigin returned if the origin of handshake is not allowed
+	ErrWSOrigin   = errors.New("websocket origin not allowed")
+	errWSProtocol = errors.New("websocket protocol error")
+)
+
+// wsConn a server side websocket connection
+type wsConn struct {
+	conn    net.Conn
+	rw      *bufio.ReadWriter
+	maxSize int64
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// upgrade runs the plugins of container and upgrades the request, the error
+// before upgrade is responded by the error encoder
+func (c *Container) upgrade(w http.ResponseWriter, r *http.Request, name string) (context.Context, *wsConn, bool) {
+	state := &requestState{header: w.Header(), info: RequestInfo{Handler: name}}
+	ctx := context.WithValue(r.Context(), requestStateKey{}, state)
+	fail := func(err error) (context.Context, *wsConn, bool) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		failure(ctx, c, w, state, err)
+		return nil, nil, false
+	}
+
+	if !isWSHandshake(r) {
+		return fail(ErrorWithStatusCode(ErrWSHandshake, http.StatusBadRequest))
+	}
+	checkOrigin := c.checkOrigin
+	if checkOrigin == nil {
+		checkOrigin = isSameOrigin
+	}
+	if !checkOrigin(r) {
+		return fail(ErrorWithStatusCode(ErrWSOrigin, http.StatusForbidden))
+	}
+	for _, b := range c.plugins {
+		next, err := b(ctx, r)
+		if next != nil {
+			ctx = next
+		}
+		if err != nil {
+			return fail(err)
+		}
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return fail(ErrorWithStatusCode(errors.New("websocket upgrade not supported"), http.StatusInternalServerError))
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return fail(ErrorWithStatusCode(err, http.StatusInternalServerError))
+	}
+
+	sum := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + wsGUID))
+	header := w.Header()
+	header.Del("Content-Type")
+	header.Set("Upgrade", "websocket")
+	header.Set("Connection", "Upgrade")
+	header.Set("Sec-WebSocket-Accept", base64.StdEncoding.EncodeToString(sum[:]))
+	_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	_ = header.Write(rw)
+	_, _ = rw.WriteString("\r\n")
+	if err := rw.Flush(); err != nil {
+		_ = conn.Close()
+		return nil, nil, false
+	}
+	state.info.Status = http.StatusSwitchingProtocols
+	return ctx, &wsConn{conn: conn, rw: rw, maxSize: defaultWSMaxMessageSize}, true
+}
+
+// CheckOrigin set the origin check of websocket handshake, the default check
+// allows the request without `Origin` header or from the same host
+func (c *Container) CheckOrigin(check func(r *http.Request) bool) *Container {
+	c.checkOrigin = check
+	return c
+}
+
+// isSameOrigin reports whether the host of `Origin` header is the request host
+func isSameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func isWSHandshake(r *http.Request) bool {
+	return r.Method == http.MethodGet &&
+		headerContainsToken(r.Header, "Connection", "upgrade") &&
+		headerContainsToken(r.Header, "Upgrade", "websocket") &&
+		r.Header.Get("Sec-WebSocket-Version") == "13" &&
+		r.Header.Get("Sec-WebSocket-Key") != ""
+}
+
+func headerContainsToken(header http.Header, key, token string) bool {
+	for _, v := range header[http.CanonicalHeaderKey(key)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readMessage reads a data message, the control frames are handled, and
+// ErrWSClosed is returned after the close handshake
+func (c *wsConn) readMessage() (int, []byte, error) {
+	var (
+		opcode  = -1
+		message []byte
+	)
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch op {
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			code := WSCloseNormal
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			_ = c.close(code, "")
+			return 0, nil, ErrWSClosed
+		case wsContinuation:
+			if opcode < 0 {
+				return 0, nil, c.fail(WSCloseProtocolError, errWSProtocol)
+			}
+		case wsText, wsBinary:
+			if opcode >= 0 {
+				return 0, nil, c.fail(WSCloseProtocolError, errWSProtocol)
+			}
+			opcode = op
+		default:
+			return 0, nil, c.fail(WSCloseProtocolError, errWSProtocol)
+		}
+		if int64(len(message)+len(payload)) > c.maxSize {
+			return 0, nil, c.fail(WSCloseTooLarge, ErrWSMessageTooLarge)
+		}
+		message = append(message, payload...)
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+// readFrame reads a frame masked by the client
+func (c *wsConn) readFrame() (bool, int, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.rw, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := head[0]&0x80 != 0
+	opcode := int(head[0] & 0x0f)
+	if head[0]&0x70 != 0 || head[1]&0x80 == 0 {
+		// reserved bits without extension, or unmasked client frame
+		return false, 0, nil, c.fail(WSCloseProtocolError, errWSProtocol)
+	}
+	length := int64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+	if opcode >= wsClose && (length > 125 || !fin) {
+		return false, 0, nil, c.fail(WSCloseProtocolError, errWSProtocol)
+	}
+	if length < 0 || length > c.maxSize {
+		return false, 0, nil, c.fail(WSCloseTooLarge, ErrWSMessageTooLarge)
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.rw, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.rw, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// writeFrame writes an unmasked frame
+func (c *wsConn) writeFrame(opcode int, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrWSClosed
+	}
+	head := []byte{0x80 | byte(opcode)}
+	switch n := len(payload); {
+	case n <= 125:
+		head = append(head, byte(n))
+	case n <= 0xffff:
+		head = append(head, 126, byte(n>>8), byte(n))
+	default:
+		head = append(head, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(head[2:], uint64(n))
+	}
+	if _, err := c.rw.Write(head); err != nil {
+		return err
+	}
+	if _, err := c.rw.Write(payload); err != nil {
+		return err
+	}
+	return c.rw.Flush()
+}
+
+// writeMessage writes a text message
+func (c *wsConn) writeMessage(data []byte) error {
+	return c.writeFrame(wsText, data)
+}
+
+// close sends the close frame and closes the connection
+func (c *wsConn) close(code int, reason string) error {
+	if len(reason) > 123 {
+		// the payload of control frame is at most 125 bytes
+		reason = reason[:123]
+	}
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	err := c.writeFrame(wsClose, payload)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	if e := c.conn.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// fail closes the connection with code and returns err
+func (c *wsConn) fail(code int, err error) error {
+	_ = c.close(code, err.Error())
+	return err
+}
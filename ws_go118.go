@@ -0,0 +1,158 @@
+//go:build go1.18
+// +build go1.18
+
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+)
+
+// Conn a websocket connection receives In messages and sends Out messages,
+// the messages are json text frames
+type Conn[In, Out any] struct {
+	ctx       context.Context
+	ws        *wsConn
+	container *Container
+	// request the handshake request carries the messages to decode
+	request *http.Request
+}
+
+// Receive reads the next message, ErrWSClosed is returned if the peer closes
+// the connection. The message is decoded by the container like a json request
+// body, the `cookie` fields are bound from the handshake, and the message not
+// decoded is reported as a bad request
+func (c *Conn[In, Out]) Receive() (*In, error) {
+	_, data, err := c.ws.readMessage()
+	if err != nil {
+		return nil, err
+	}
+	r := c.request.WithContext(c.ctx)
+	r.Body = ioutil.NopCloser(bytes.NewReader(data))
+	r.ContentLength = int64(len(data))
+	value, err := c.container.decodeRequest(c.ctx, r, reflect.TypeOf((*In)(nil)))
+	if err != nil {
+		if _, ok := UnwrapErrorStatusCode(err); !ok {
+			err = ErrorWithStatusCode(err, http.StatusBadRequest)
+		}
+		return nil, err
+	}
+	return value.Interface().(*In), nil
+}
+
+// Send writes the message encoded by the response encoder of container
+func (c *Conn[In, Out]) Send(out *Out) error {
+	data, err := encodeJSON(c.container.responseEncoder(c.ctx, out))
+	if err != nil {
+		return err
+	}
+	return c.ws.writeMessage(data)
+}
+
+// SendError writes the error encoded by the error encoder of container
+func (c *Conn[In, Out]) SendError(err error) error {
+	data, e := encodeJSON(c.container.errorEncoder(c.ctx, err))
+	if e != nil {
+		return e
+	}
+	return c.ws.writeMessage(data)
+}
+
+// Close sends the close frame with code and closes the connection
+func (c *Conn[In, Out]) Close(code int, reason string) error {
+	return c.ws.close(code, reason)
+}
+
+// WrapWS returns a handler upgrades the request to websocket and calls f with
+// the connection, the plugins of container are applied once before upgrade,
+// the connection is closed after f returns, nil container is the global one
+//
+// e.g:
+//
+//	http.Handle("/chat", fn.WrapWS(nil, func(ctx context.Context, conn *fn.Conn[Message, Message]) error {
+//	    for {
+//	        msg, err := conn.Receive()
+//	        if err != nil {
+//	            return err
+//	        }
+//	        if err := conn.Send(msg); err != nil {
+//	            return err
+//	        }
+//	    }
+//	}))
+func WrapWS[In, Out any](c *Container, f func(ctx context.Context, conn *Conn[In, Out]) error) http.Handler {
+	return wrapWS(c, funcName(reflect.ValueOf(f)), f)
+}
+
+// WrapWSMessage returns a websocket handler calls f for each message, the
+// response or error of f is sent back like the http response, the message
+// not decoded is responded with the error and the connection is kept
+func WrapWSMessage[In, Out any](c *Container, f func(ctx context.Context, req *In) (*Out, error)) http.Handler {
+	return wrapWS(c, funcName(reflect.ValueOf(f)), func(ctx context.Context, conn *Conn[In, Out]) error {
+		for {
+			req, err := conn.Receive()
+			if err != nil {
+				if _, ok := UnwrapErrorStatusCode(err); !ok {
+					// the connection is broken or closed
+					return err
+				}
+				if err := conn.SendError(err); err != nil {
+					return err
+				}
+				continue
+			}
+			resp, err := f(ctx, req)
+			if err != nil {
+				err = conn.SendError(err)
+			} else {
+				err = conn.Send(resp)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	})
+}
+
+func wrapWS[In, Out any](c *Container, name string, f func(ctx context.Context, conn *Conn[In, Out]) error) http.Handler {
+	if c == nil {
+		c = globalContainer
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, ws, ok := c.upgrade(w, r, name)
+		if !ok {
+			return
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		// the messages are json regardless of the handshake headers
+		request := r.WithContext(ctx)
+		request.Header = make(http.Header, len(r.Header))
+		for k, v := range r.Header {
+			request.Header[k] = v
+		}
+		request.Header.Set("Content-Type", "application/json")
+		err := f(ctx, &Conn[In, Out]{ctx: ctx, ws: ws, container: c, request: request})
+		if err == nil || err == ErrWSClosed {
+			_ = ws.close(WSCloseNormal, "")
+			return
+		}
+		_ = ws.close(WSCloseInternalError, err.Error())
+	})
+}
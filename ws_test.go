@@ -0,0 +1,259 @@
+//go:build go1.18
+// +build go1.18
+
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fn
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/pingcap/check"
+)
+
+type wsSuite struct{}
+
+var _ = Suite(&wsSuite{})
+
+type wsMessage struct {
+	Text string `json:"text"`
+}
+
+// wsClient a minimal websocket client
+type wsClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialWS(c *C, server *httptest.Server, header http.Header) (*wsClient, *http.Response) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	c.Assert(err, IsNil)
+	request, _ := http.NewRequest(http.MethodGet, server.URL+"/ws", nil)
+	request.Header.Set("Connection", "keep-alive, Upgrade")
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Sec-WebSocket-Version", "13")
+	request.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for k, v := range header {
+		request.Header[k] = v
+	}
+	c.Assert(request.Write(conn), IsNil)
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, request)
+	c.Assert(err, IsNil)
+	return &wsClient{conn: conn, r: r}, resp
+}
+
+func (w *wsClient) writeFrame(c *C, fin bool, opcode byte, payload []byte) {
+	head := []byte{opcode, 0x80}
+	if fin {
+		head[0] |= 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		head[1] |= byte(n)
+	case n <= 0xffff:
+		head[1] |= 126
+		head = append(head, byte(n>>8), byte(n))
+	default:
+		head[1] |= 127
+		ext := make([]byte, 8)
+		binary.BigEndian.PutUint64(ext, uint64(n))
+		head = append(head, ext...)
+	}
+	mask := []byte{1, 2, 3, 4}
+	masked := make([]byte, len(payload))
+	for i := range payload {
+		masked[i] = payload[i] ^ mask[i%4]
+	}
+	_, err := w.conn.Write(append(append(head, mask...), masked...))
+	c.Assert(err, IsNil)
+}
+
+func (w *wsClient) readFrame(c *C) (byte, []byte) {
+	head := make([]byte, 2)
+	_, err := io.ReadFull(w.r, head)
+	c.Assert(err, IsNil)
+	c.Assert(head[1]&0x80, Equals, byte(0))
+	length := int(head[1] & 0x7f)
+	if length == 126 {
+		ext := make([]byte, 2)
+		_, err = io.ReadFull(w.r, ext)
+		c.Assert(err, IsNil)
+		length = int(binary.BigEndian.Uint16(ext))
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(w.r, payload)
+	c.Assert(err, IsNil)
+	return head[0] & 0x0f, payload
+}
+
+func (s *wsSuite) TestMessage(c *C) {
+	group := NewGroup()
+	group.SetResponseEncoder(defaultResponseEncoder)
+	group.SetErrorEncoder(defaultErrorEncoder)
+	group.Plugin(func(ctx context.Context, r *http.Request) (context.Context, error) {
+		if r.Header.Get("X-Token") != "secret" {
+			return ctx, ErrorWithStatusCode(errors.New("bad token"), http.StatusUnauthorized)
+		}
+		ResponseHeader(ctx).Set("X-Plugin", "once")
+		return ctx, nil
+	})
+	handler := WrapWSMessage(group, func(ctx context.Context, req *wsMessage) (*wsMessage, error) {
+		if req.Text == "" {
+			return nil, errors.New("empty")
+		}
+		return &wsMessage{Text: strings.ToUpper(req.Text)}, nil
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	_, resp := dialWS(c, server, nil)
+	c.Assert(resp.StatusCode, Equals, http.StatusUnauthorized)
+
+	client, resp := dialWS(c, server, http.Header{"X-Token": {"secret"}})
+	defer client.conn.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusSwitchingProtocols)
+	c.Assert(resp.Header.Get("Sec-WebSocket-Accept"), Equals, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=")
+	c.Assert(resp.Header.Get("X-Plugin"), Equals, "once")
+
+	client.writeFrame(c, true, wsText, []byte(`{"text":"hello"}`))
+	op, payload := client.readFrame(c)
+	c.Assert(op, Equals, byte(wsText))
+	c.Assert(string(payload), Equals, "{\"text\":\"HELLO\"}\n")
+
+	// fragmented message with a ping in between
+	client.writeFrame(c, false, wsText, []byte(`{"text":`))
+	client.writeFrame(c, true, wsPing, []byte("p"))
+	client.writeFrame(c, true, wsContinuation, []byte(`"frag"}`))
+	op, payload = client.readFrame(c)
+	c.Assert(op, Equals, byte(wsPong))
+	c.Assert(string(payload), Equals, "p")
+	_, payload = client.readFrame(c)
+	c.Assert(string(payload), Equals, "{\"text\":\"FRAG\"}\n")
+
+	client.writeFrame(c, true, wsText, []byte(`{"text":""}`))
+	_, payload = client.readFrame(c)
+	c.Assert(string(payload), Equals, "\"empty\"\n")
+
+	client.writeFrame(c, true, wsText, []byte(`not json`))
+	_, payload = client.readFrame(c)
+	c.Assert(string(payload), Matches, "\"invalid character.*\"\n")
+
+	big := strings.Repeat("x", 200)
+	client.writeFrame(c, true, wsText, []byte(`{"text":"`+big+`"}`))
+	_, payload = client.readFrame(c)
+	c.Assert(string(payload), Equals, "{\"text\":\""+strings.ToUpper(big)+"\"}\n")
+
+	client.writeFrame(c, true, wsClose, []byte{0x03, 0xe8})
+	op, payload = client.readFrame(c)
+	c.Assert(op, Equals, byte(wsClose))
+	c.Assert(binary.BigEndian.Uint16(payload), Equals, uint16(WSCloseNormal))
+}
+
+func (s *wsSuite) TestConn(c *C) {
+	handler := WrapWS(New(), func(ctx context.Context, conn *Conn[wsMessage, wsMessage]) error {
+		if err := conn.Send(&wsMessage{Text: "welcome"}); err != nil {
+			return err
+		}
+		msg, err := conn.Receive()
+		if err != nil {
+			return err
+		}
+		return errors.New("bye " + msg.Text)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	client, resp := dialWS(c, server, nil)
+	defer client.conn.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusSwitchingProtocols)
+	_, payload := client.readFrame(c)
+	c.Assert(string(payload), Equals, "{\"text\":\"welcome\"}\n")
+
+	client.writeFrame(c, true, wsText, []byte(`{"text":"fn"}`))
+	op, payload := client.readFrame(c)
+	c.Assert(op, Equals, byte(wsClose))
+	c.Assert(binary.BigEndian.Uint16(payload), Equals, uint16(WSCloseInternalError))
+	c.Assert(string(payload[2:]), Equals, "bye fn")
+}
+
+func (s *wsSuite) TestHandshake(c *C) {
+	handler := WrapWS(New(), func(ctx context.Context, conn *Conn[wsMessage, wsMessage]) error {
+		return nil
+	})
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest(http.MethodGet, "/ws", nil)
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), Equals, "\"websocket handshake expected\"\n")
+}
+
+func (s *wsSuite) TestProtocolError(c *C) {
+	handler := WrapWS(New(), func(ctx context.Context, conn *Conn[wsMessage, wsMessage]) error {
+		_, err := conn.Receive()
+		return err
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	client, _ := dialWS(c, server, nil)
+	defer client.conn.Close()
+	// unmasked frame
+	_, err := client.conn.Write([]byte{0x81, 0x00})
+	c.Assert(err, IsNil)
+	op, payload := client.readFrame(c)
+	c.Assert(op, Equals, byte(wsClose))
+	c.Assert(binary.BigEndian.Uint16(payload), Equals, uint16(WSCloseProtocolError))
+}
+
+func (s *wsSuite) TestOrigin(c *C) {
+	type message struct {
+		Text string `json:"text"`
+		User string `cookie:"user"`
+	}
+	group := New()
+	handler := WrapWS(group, func(ctx context.Context, conn *Conn[message, message]) error {
+		msg, err := conn.Receive()
+		if err != nil {
+			return err
+		}
+		return conn.Send(msg)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	_, resp := dialWS(c, server, http.Header{"Origin": {"http://evil.example"}})
+	c.Assert(resp.StatusCode, Equals, http.StatusForbidden)
+
+	// the message is decoded by the container, the cookie is of handshake
+	client, resp := dialWS(c, server, http.Header{"Origin": {server.URL}, "Cookie": {"user=alice"}})
+	defer client.conn.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusSwitchingProtocols)
+	client.writeFrame(c, true, wsText, []byte(`{"text":"hi"}`))
+	_, payload := client.readFrame(c)
+	c.Assert(string(payload), Equals, "{\"text\":\"hi\",\"User\":\"alice\"}\n")
+
+	group.CheckOrigin(func(r *http.Request) bool { return true })
+	client, resp = dialWS(c, server, http.Header{"Origin": {"http://evil.example"}})
+	defer client.conn.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusSwitchingProtocols)
+}